@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// attachmentTimeout bounds both the download from Slack and the upload of
+// each attachment
+const attachmentTimeout = 30 * time.Second
+
+var attachmentHTTPClient = &http.Client{Timeout: attachmentTimeout}
+
+var errAttachmentTooLarge = errors.New("attachment is over the size limit")
+
+// attachmentsMetadataChars is how much of the modal's private_metadata, which
+// Slack limits to 3000 characters, the attachments may take up
+const attachmentsMetadataChars = 2000
+
+// collectAttachments turns the files of a message the shortcut was used on
+// into links for the issue body.  With ATTACHMENT_UPLOAD_URL set each file is
+// downloaded with the bot token and uploaded there; otherwise, or if that
+// fails, the file's Slack permalink is used.  Files of a type not in
+// ATTACHMENT_TYPES or larger than ATTACHMENT_MAX_BYTES are left out, as are
+// any that don't fit in the modal's metadata.
+func collectAttachments(ctx context.Context, slackClient SlackAPI, files []SlackFile, config Config) []IssueAttachment {
+	var attachments []IssueAttachment
+	metadataChars := 0
+	for i, file := range files {
+		if !attachmentTypeAllowed(file.Mimetype, config) {
+			InfoContext(ctx, "Skipping attachment %s: type %q is not allowed", file.Name, file.Mimetype)
+			continue
+		}
+		if config.AttachmentMaxBytes > 0 && file.Size > config.AttachmentMaxBytes {
+			InfoContext(ctx, "Skipping attachment %s: %d bytes is over the %d byte limit", file.Name, file.Size, config.AttachmentMaxBytes)
+			continue
+		}
+
+		attachment := IssueAttachment{Name: file.Name, URL: file.Permalink}
+		if config.AttachmentUploadURL != "" {
+			uploaded, err := uploadAttachment(ctx, slackClient, file, config)
+			if err != nil {
+				WarnContext(ctx, "Error uploading attachment %s, linking it in Slack instead: %v", file.Name, err)
+			} else {
+				attachment.URL = uploaded
+				attachment.Image = strings.HasPrefix(file.Mimetype, "image/")
+			}
+		}
+		if attachment.URL == "" {
+			WarnContext(ctx, "Skipping attachment %s: it has no permalink", file.Name)
+			continue
+		}
+
+		encoded, _ := json.Marshal(attachment)
+		if metadataChars+len(encoded)+1 > attachmentsMetadataChars {
+			WarnContext(ctx, "Skipping %d attachments from %s on: too many for the modal", len(files)-i, file.Name)
+			break
+		}
+		metadataChars += len(encoded) + 1
+		attachments = append(attachments, attachment)
+	}
+	return attachments
+}
+
+// attachmentTypeAllowed reports whether mimetype matches one of the
+// ATTACHMENT_TYPES patterns, such as "image/*".
+func attachmentTypeAllowed(mimetype string, config Config) bool {
+	for _, pattern := range config.AttachmentTypes {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(mimetype)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadAttachment copies a Slack file to ATTACHMENT_UPLOAD_URL with an HTTP
+// PUT to <upload URL>/<file ID>/<name> and returns its public URL.
+func uploadAttachment(ctx context.Context, slackClient SlackAPI, file SlackFile, config Config) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, attachmentTimeout)
+	defer cancel()
+
+	// Slack's reported size is checked before downloading; the limit stops a
+	// file that turns out larger from being read into memory
+	var data bytes.Buffer
+	var w io.Writer = &data
+	if config.AttachmentMaxBytes > 0 {
+		w = &limitedWriter{w: &data, n: config.AttachmentMaxBytes}
+	}
+	if err := slackClient.GetFileContext(ctx, file.URLPrivateDownload, w); err != nil {
+		if errors.Is(err, errAttachmentTooLarge) {
+			return "", fmt.Errorf("download is over the %d byte limit", config.AttachmentMaxBytes)
+		}
+		return "", fmt.Errorf("error downloading file from Slack: %v", err)
+	}
+
+	filePath := url.PathEscape(file.ID) + "/" + url.PathEscape(file.Name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimRight(config.AttachmentUploadURL, "/")+"/"+filePath, &data)
+	if err != nil {
+		return "", fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	if file.Mimetype != "" {
+		req.Header.Set("Content-Type", file.Mimetype)
+	}
+
+	resp, err := attachmentHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending HTTP request to attachment storage: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("attachment upload failed with status %d", resp.StatusCode)
+	}
+
+	DebugContext(ctx, "Uploaded attachment %s (%d bytes)", file.Name, data.Len())
+	return strings.TrimRight(firstNonEmpty(config.AttachmentPublicURL, config.AttachmentUploadURL), "/") + "/" + filePath, nil
+}
+
+// describeFiles stands in for the text of a message that only has files, so
+// that a title can still be generated from it.
+func describeFiles(files []SlackFile) string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	return "Files shared in Slack: " + strings.Join(names, ", ")
+}
+
+// limitedWriter passes at most n bytes on to w and fails the write that would
+// go past them.
+type limitedWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		return 0, errAttachmentTooLarge
+	}
+	n, err := l.w.Write(p)
+	l.n -= n
+	return n, err
+}
+
+// withAttachments appends the attachments section to an issue description.
+func withAttachments(description string, attachments []IssueAttachment) string {
+	section := attachmentsMarkdown(attachments)
+	if section == "" {
+		return description
+	}
+	if description == "" {
+		return section
+	}
+	return description + "\n\n" + section
+}
+
+// attachmentsMarkdown renders attachments as an issue body section: images
+// are embedded, other files linked.
+func attachmentsMarkdown(attachments []IssueAttachment) string {
+	if len(attachments) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("### Attachments\n")
+	for _, attachment := range attachments {
+		name := strings.NewReplacer("[", "\\[", "]", "\\]").Replace(attachment.Name)
+		if attachment.Image {
+			fmt.Fprintf(&b, "\n- ![%s](%s)", name, attachment.URL)
+		} else {
+			fmt.Fprintf(&b, "\n- [%s](%s)", name, attachment.URL)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func subscribeToBlockActions(ctx context.Context, rdb *redis.Client, slackClient SlackAPI, config Config) error {
+	handler := func(ctx context.Context, payload string) error {
+		return handleBlockAction(ctx, rdb, slackClient, payload, currentConfig())
+	}
+	return consumeChannel(ctx, rdb, config.RedisBlockActionChannel, "block-actions", config,
+		withIdempotency(rdb, "block-actions", config, payloadKey("trigger_id"), handler))
+}
+
+func handleBlockAction(ctx context.Context, rdb RedisClient, slackClient SlackAPI, payload string, config Config) error {
+	var event BlockActionEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return fmt.Errorf("error unmarshaling block action: %v", err)
+	}
+
+	// Only handle block_actions interactions
+	if event.Type != "block_actions" {
+		ignoreEvent(ctx)
+		return nil
+	}
+
+	for _, action := range event.Actions {
+		switch action.ActionID {
+		case retryFailedCommandActionID:
+			if err := retryFailedCommand(ctx, rdb, slackClient, event, action, config); err != nil {
+				return err
+			}
+		case createIssueAnywayActionID:
+			if err := handleCreateAnyway(ctx, rdb, event, action, config); err != nil {
+				return err
+			}
+		case commentOnExistingActionID:
+			if err := handleCommentOnExisting(ctx, rdb, event, action, config); err != nil {
+				return err
+			}
+		case repoSelectActionID:
+			if err := handleRepoSelected(ctx, rdb, event, action, config); err != nil {
+				return err
+			}
+		case issueTemplateActionID:
+			if err := handleTemplateSelected(ctx, rdb, slackClient, event, action, config); err != nil {
+				return err
+			}
+		case includeThreadActionID:
+			if err := handleIncludeThreadToggled(ctx, rdb, slackClient, event, config); err != nil {
+				return err
+			}
+		default:
+			DebugContext(ctx, "Ignoring block action: %s", action.ActionID)
+		}
+	}
+
+	return nil
+}
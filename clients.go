@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// SlackAPI is the part of the Slack Web API the handlers use.  *slack.Client
+// implements it; tests use an in-memory fake.
+type SlackAPI interface {
+	OpenView(triggerID string, view slack.ModalViewRequest) (*slack.ViewResponse, error)
+	UpdateView(view slack.ModalViewRequest, externalID, hash, viewID string) (*slack.ViewResponse, error)
+	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	GetConversationHistory(params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error)
+	GetConversationReplies(params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error)
+	GetUserInfo(user string) (*slack.User, error)
+	GetPermalink(params *slack.PermalinkParameters) (string, error)
+	GetFileContext(ctx context.Context, downloadURL string, writer io.Writer) error
+}
+
+// Queue sends messages to the other services: Redis lists for Poppit and
+// SlackLiner, and pub/sub for TimeBomb.
+type Queue interface {
+	RPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
+}
+
+// Store holds the service's own state in Redis: the issue index, retries,
+// pending issues, repo details, GitHub logins, idempotency keys and dead letters.
+type Store interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	GetDel(ctx context.Context, key string) *redis.StringCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	HGet(ctx context.Context, key, field string) *redis.StringCmd
+	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd
+	LRem(ctx context.Context, key string, count int64, value interface{}) *redis.IntCmd
+}
+
+// RedisClient is everything the handlers need from Redis.  Consuming channels
+// and streams still takes a *redis.Client; see transport.go.
+type RedisClient interface {
+	Queue
+	Store
+}
+
+var (
+	_ SlackAPI    = (*slack.Client)(nil)
+	_ RedisClient = (*redis.Client)(nil)
+)
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// shellCommand builds a command line for Poppit from discrete arguments.
+// Poppit executes each entry of PoppitCommand.Commands through a shell, so every
+// argument is rendered with shellQuote — the single quoting routine for all
+// commands we send — and user-supplied values can never escape the argument
+// they were placed in.
+type shellCommand struct {
+	args []string
+}
+
+// newShellCommand starts a command with the given program name and arguments.
+func newShellCommand(name string, args ...string) *shellCommand {
+	return &shellCommand{args: append([]string{name}, args...)}
+}
+
+// Arg appends positional arguments.
+func (c *shellCommand) Arg(args ...string) *shellCommand {
+	c.args = append(c.args, args...)
+	return c
+}
+
+// Flag appends a flag followed by its value as two separate arguments.
+func (c *shellCommand) Flag(name, value string) *shellCommand {
+	c.args = append(c.args, name, value)
+	return c
+}
+
+// Args returns the unquoted argument vector.
+func (c *shellCommand) Args() []string {
+	return append([]string(nil), c.args...)
+}
+
+// String renders the command as a shell command line with every argument quoted.
+func (c *shellCommand) String() string {
+	quoted := make([]string, len(c.args))
+	for i, arg := range c.args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellSafePattern matches arguments that need no quoting in a POSIX shell.
+var shellSafePattern = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes arg so a POSIX shell reads it back as exactly one word.
+// Arguments made only of safe characters are left bare to keep commands
+// readable; everything else is wrapped in single quotes, with each embedded
+// single quote closed, backslash-escaped and reopened.  NUL bytes cannot be
+// represented in a shell word and are dropped.
+func shellQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "\x00", "")
+	if arg == "" {
+		return "''"
+	}
+	if shellSafePattern.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// repoFullNamePattern matches a GitHub "owner/repo" name.
+var repoFullNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*/[A-Za-z0-9._-]+$`)
+
+// validateRepoFullName rejects repository names that are not a plain
+// "owner/repo" pair, e.g. values from the external select that look like flags.
+func validateRepoFullName(repoFullName string) error {
+	if !repoFullNamePattern.MatchString(repoFullName) {
+		return fmt.Errorf("invalid repository name: %q", repoFullName)
+	}
+	return nil
+}
+
+// validateIssueURL rejects anything that is not a GitHub issue URL.
+func validateIssueURL(issueURL string) error {
+	if !strings.HasPrefix(issueURL, "https://github.com/") || !strings.Contains(issueURL, "/issues/") ||
+		strings.ContainsAny(issueURL, " \t\r\n") {
+		return fmt.Errorf("invalid issue URL format: %s", issueURL)
+	}
+	return nil
+}
+
+// poppitSentAtKey is the metadata field stamped with the time a command was
+// pushed.  Poppit echoes metadata back with the output, so the round trip can
+// be measured.
+const poppitSentAtKey = "sent_at"
+
+// pushPoppitCommand queues cmd on the given Poppit list, tagged with the
+// correlation ID carried by ctx.
+func pushPoppitCommand(ctx context.Context, rdb RedisClient, list string, cmd PoppitCommand) error {
+	if cmd.Metadata == nil {
+		cmd.Metadata = make(map[string]interface{})
+	}
+	cmd.Metadata[poppitSentAtKey] = time.Now().UTC().Format(time.RFC3339Nano)
+	if id := correlationID(ctx); id != "" {
+		cmd.Metadata[correlationIDKey] = id
+	}
+
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Poppit command: %v", err)
+	}
+
+	if err := rdb.RPush(ctx, list, payload).Err(); err != nil {
+		return fmt.Errorf("failed to push command to Poppit: %v", err)
+	}
+	return nil
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
-	"log"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -16,6 +20,7 @@ type Config struct {
 	RedisViewSubmissionChannel string
 	RedisReactionChannel       string
 	RedisMessageActionChannel  string
+	RedisBlockActionChannel    string
 	RedisSlackLinerList        string
 	RedisPoppitList            string
 	RedisPoppitBuilderList     string
@@ -23,180 +28,355 @@ type Config struct {
 	RedisGitHubWebhookChannel  string
 	RedisSlackReactionsList    string
 	RedisTimeBombChannel       string
+	RedisIssueIndexPrefix      string
+	RedisIssueThreadPrefix     string
+	IssueThreadTTL             int
+	IssueSourceFooter          string
+	RedisFailedCommandPrefix   string
+	RedisRepoDetailsPrefix     string
+	RedisTranscriptPrefix      string
+	RepoDetailsTTL             int
+	RedisGitHubLoginsKey       string
+	GitHubLogins               map[string]string
+	GitHubLinkAdmins           []string
+	Presets                    []issuePreset
+	ConfirmationRoutes         []confirmationRoute
+	DuplicateCheck             bool
+	RedisPendingIssuePrefix    string
+	RedisDeadLetterPrefix      string
+	PendingIssueTTL            int
+	RedisStreamChannels        []string
+	RedisIdempotencyPrefix     string
+	IdempotencyTTL             int
+	RedisStreamGroupPrefix     string
+	RedisStreamConsumer        string
+	RedisStreamClaimIdle       int
+	RedisStreamMaxDeliveries   int
 	SlackBotToken              string
 	SlackLinerURL              string
+	AttachmentUploadURL        string
+	AttachmentPublicURL        string
+	AttachmentMaxBytes         int
+	AttachmentTypes            []string
 	GitHubOrg                  string
 	WorkingDir                 string
 	ConfirmationChannelID      string
 	ConfirmationTTL            int
 	ConfirmationSearchLimit    int
+	FailedCommandTTL           int
 	ProjectID                  string
 	ProjectOrg                 string
 	AgentWorkingDir            string
 	LogLevel                   string
+	LogFormat                  string
+	HTTPAddr                   string
+	DrainTimeout               int
+
+	// file is the config file the values were read from
+	file string
+	// settings records where each value came from, for "config check"
+	settings []configSetting
+	// loadProblems are values that could not be parsed; see Validate
+	loadProblems []error
 }
 
 // fileConfig mirrors the fields in config.sample.yaml.
 // Only non-secret settings are read from the file; secrets remain in env vars.
 type fileConfig struct {
-	RedisAddr                  string `yaml:"redis_addr"`
-	RedisChannel               string `yaml:"redis_channel"`
-	RedisViewSubmissionChannel string `yaml:"redis_view_submission_channel"`
-	RedisReactionChannel       string `yaml:"redis_reaction_channel"`
-	RedisMessageActionChannel  string `yaml:"redis_message_action_channel"`
-	RedisSlackLinerList        string `yaml:"redis_slackliner_list"`
-	RedisPoppitList            string `yaml:"redis_poppit_list"`
-	RedisPoppitBuilderList     string `yaml:"redis_poppit_builder_list"`
-	RedisPoppitOutputChannel   string `yaml:"redis_poppit_output_channel"`
-	RedisGitHubWebhookChannel  string `yaml:"redis_github_webhook_channel"`
-	RedisSlackReactionsList    string `yaml:"redis_slack_reactions_list"`
-	RedisTimeBombChannel       string `yaml:"redis_timebomb_channel"`
-	SlackLinerURL              string `yaml:"slackliner_url"`
-	GitHubOrg                  string `yaml:"github_org"`
-	WorkingDir                 string `yaml:"working_dir"`
-	ConfirmationChannelID      string `yaml:"confirmation_channel_id"`
-	ConfirmationTTL            string `yaml:"confirmation_ttl"`
-	ConfirmationSearchLimit    string `yaml:"confirmation_search_limit"`
-	ProjectID                  string `yaml:"project_id"`
-	ProjectOrg                 string `yaml:"project_org"`
-	AgentWorkingDir            string `yaml:"agent_working_dir"`
-	LogLevel                   string `yaml:"log_level"`
-}
-
-// loadFileConfig reads config.yaml if it exists and returns the parsed values.
-// Missing or unreadable files are silently ignored.
-func loadFileConfig(path string) fileConfig {
+	RedisAddr                  string              `yaml:"redis_addr"`
+	RedisChannel               string              `yaml:"redis_channel"`
+	RedisViewSubmissionChannel string              `yaml:"redis_view_submission_channel"`
+	RedisReactionChannel       string              `yaml:"redis_reaction_channel"`
+	RedisMessageActionChannel  string              `yaml:"redis_message_action_channel"`
+	RedisBlockActionChannel    string              `yaml:"redis_block_action_channel"`
+	RedisSlackLinerList        string              `yaml:"redis_slackliner_list"`
+	RedisPoppitList            string              `yaml:"redis_poppit_list"`
+	RedisPoppitBuilderList     string              `yaml:"redis_poppit_builder_list"`
+	RedisPoppitOutputChannel   string              `yaml:"redis_poppit_output_channel"`
+	RedisGitHubWebhookChannel  string              `yaml:"redis_github_webhook_channel"`
+	RedisSlackReactionsList    string              `yaml:"redis_slack_reactions_list"`
+	RedisTimeBombChannel       string              `yaml:"redis_timebomb_channel"`
+	RedisIssueIndexPrefix      string              `yaml:"redis_issue_index_prefix"`
+	RedisIssueThreadPrefix     string              `yaml:"redis_issue_thread_prefix"`
+	IssueThreadTTL             string              `yaml:"issue_thread_ttl"`
+	IssueSourceFooter          string              `yaml:"issue_source_footer"`
+	RedisFailedCommandPrefix   string              `yaml:"redis_failed_command_prefix"`
+	RedisRepoDetailsPrefix     string              `yaml:"redis_repo_details_prefix"`
+	RedisTranscriptPrefix      string              `yaml:"redis_transcript_prefix"`
+	RepoDetailsTTL             string              `yaml:"repo_details_ttl"`
+	RedisGitHubLoginsKey       string              `yaml:"redis_github_logins_key"`
+	GitHubLogins               map[string]string   `yaml:"github_logins"`
+	GitHubLinkAdmins           []string            `yaml:"github_link_admins"`
+	Presets                    []issuePreset       `yaml:"presets"`
+	ConfirmationRoutes         []confirmationRoute `yaml:"confirmation_routes"`
+	DuplicateCheck             string              `yaml:"duplicate_check"`
+	RedisPendingIssuePrefix    string              `yaml:"redis_pending_issue_prefix"`
+	PendingIssueTTL            string              `yaml:"pending_issue_ttl"`
+	RedisDeadLetterPrefix      string              `yaml:"redis_dead_letter_prefix"`
+	RedisStreamChannels        []string            `yaml:"redis_stream_channels"`
+	RedisIdempotencyPrefix     string              `yaml:"redis_idempotency_prefix"`
+	IdempotencyTTL             string              `yaml:"idempotency_ttl"`
+	RedisStreamGroupPrefix     string              `yaml:"redis_stream_group_prefix"`
+	RedisStreamConsumer        string              `yaml:"redis_stream_consumer"`
+	RedisStreamClaimIdle       string              `yaml:"redis_stream_claim_idle"`
+	RedisStreamMaxDeliveries   string              `yaml:"redis_stream_max_deliveries"`
+	SlackLinerURL              string              `yaml:"slackliner_url"`
+	AttachmentUploadURL        string              `yaml:"attachment_upload_url"`
+	AttachmentPublicURL        string              `yaml:"attachment_public_url"`
+	AttachmentMaxBytes         string              `yaml:"attachment_max_bytes"`
+	AttachmentTypes            []string            `yaml:"attachment_types"`
+	GitHubOrg                  string              `yaml:"github_org"`
+	WorkingDir                 string              `yaml:"working_dir"`
+	ConfirmationChannelID      string              `yaml:"confirmation_channel_id"`
+	ConfirmationTTL            string              `yaml:"confirmation_ttl"`
+	ConfirmationSearchLimit    string              `yaml:"confirmation_search_limit"`
+	FailedCommandTTL           string              `yaml:"failed_command_ttl"`
+	ProjectID                  string              `yaml:"project_id"`
+	ProjectOrg                 string              `yaml:"project_org"`
+	AgentWorkingDir            string              `yaml:"agent_working_dir"`
+	LogLevel                   string              `yaml:"log_level"`
+	LogFormat                  string              `yaml:"log_format"`
+	HTTPAddr                   string              `yaml:"http_addr"`
+	DrainTimeout               string              `yaml:"drain_timeout"`
+}
+
+// readFileConfig reads the config file at path if it exists.  A missing file
+// is not an error.  Keys that do not match a setting are reported as problems,
+// but the recognised ones are still returned; a file that is not valid YAML is
+// reported as a problem and none of it is used.
+func readFileConfig(path string) (fileConfig, []error) {
 	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fileConfig{}, nil
+	}
 	if err != nil {
-		return fileConfig{}
+		return fileConfig{}, []error{fmt.Errorf("%s: %v", path, err)}
 	}
+
 	var fc fileConfig
-	if err := yaml.Unmarshal(data, &fc); err != nil {
-		log.Printf("Warning: failed to parse config file %s: %v", path, err)
-		return fileConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&fc)
+	var typeErr *yaml.TypeError
+	switch {
+	case err == nil, errors.Is(err, io.EOF):
+		return fc, nil
+	case errors.As(err, &typeErr):
+		problems := make([]error, len(typeErr.Errors))
+		for i, msg := range typeErr.Errors {
+			problems[i] = fmt.Errorf("%s: %s", path, msg)
+		}
+		return fc, problems
+	default:
+		return fileConfig{}, []error{fmt.Errorf("%s: %v", path, err)}
 	}
-	return fc
 }
 
-func loadConfig() Config {
-	fc := loadFileConfig("config.yaml")
+// defaultConfigFile is read when neither --config nor CONFIG_FILE is given.
+const defaultConfigFile = "config.yaml"
 
-	return Config{
+// configFilePath returns the config file to read: the --config flag, then
+// CONFIG_FILE, then config.yaml in the working directory.
+func configFilePath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return getEnv("CONFIG_FILE", defaultConfigFile)
+}
+
+func loadConfig(path string) Config {
+	fc, problems := readFileConfig(path)
+	hostname, hostErr := os.Hostname()
+	l := &configLoader{problems: problems}
+
+	config := Config{
 		// Secrets are env-var only — no file fallback.
-		RedisPassword: getEnv("REDIS_PASSWORD", ""),
-		SlackBotToken: getEnv("SLACK_BOT_TOKEN", ""),
+		RedisPassword: l.secret("REDIS_PASSWORD"),
+		SlackBotToken: l.secret("SLACK_BOT_TOKEN"),
 
 		// Non-secret settings: env var > config file > hard-coded default.
-		RedisAddr:                  getEnvWithFile("REDIS_ADDR", fc.RedisAddr, "host.docker.internal:6379"),
-		RedisChannel:               getEnvWithFile("REDIS_CHANNEL", fc.RedisChannel, "slack-commands"),
-		RedisViewSubmissionChannel: getEnvWithFile("REDIS_VIEW_SUBMISSION_CHANNEL", fc.RedisViewSubmissionChannel, "slack-relay-view-submission"),
-		RedisReactionChannel:       getEnvWithFile("REDIS_REACTION_CHANNEL", fc.RedisReactionChannel, "slack-relay-reaction-added"),
-		RedisMessageActionChannel:  getEnvWithFile("REDIS_MESSAGE_ACTION_CHANNEL", fc.RedisMessageActionChannel, "slack-relay-message-action"),
-		RedisSlackLinerList:        getEnvWithFile("REDIS_SLACKLINER_LIST", fc.RedisSlackLinerList, "slack_messages"),
-		RedisPoppitList:            getEnvWithFile("REDIS_POPPIT_LIST", fc.RedisPoppitList, "poppit:commands"),
-		RedisPoppitBuilderList:     getEnvWithFile("REDIS_POPPIT_BUILDER_LIST", fc.RedisPoppitBuilderList, "poppit:build-commands"),
-		RedisPoppitOutputChannel:   getEnvWithFile("REDIS_POPPIT_OUTPUT_CHANNEL", fc.RedisPoppitOutputChannel, "poppit:command-output"),
-		RedisGitHubWebhookChannel:  getEnvWithFile("REDIS_GITHUB_WEBHOOK_CHANNEL", fc.RedisGitHubWebhookChannel, "github-webhook-issues"),
-		RedisSlackReactionsList:    getEnvWithFile("REDIS_SLACK_REACTIONS_LIST", fc.RedisSlackReactionsList, "slack_reactions"),
-		RedisTimeBombChannel:       getEnvWithFile("REDIS_TIMEBOMB_CHANNEL", fc.RedisTimeBombChannel, "timebomb-messages"),
-		SlackLinerURL:              getEnvWithFile("SLACKLINER_URL", fc.SlackLinerURL, ""),
-		GitHubOrg:                  getEnvWithFile("GITHUB_ORG", fc.GitHubOrg, ""),
-		WorkingDir:                 getEnvWithFile("WORKING_DIR", fc.WorkingDir, "/tmp"),
-		ConfirmationChannelID:      getEnvWithFile("CONFIRMATION_CHANNEL_ID", fc.ConfirmationChannelID, ""),
-		ConfirmationTTL:            getEnvAsIntSecondsWithFile("CONFIRMATION_TTL", fc.ConfirmationTTL, "48h"),
-		ConfirmationSearchLimit:    getEnvAsIntWithFile("CONFIRMATION_SEARCH_LIMIT", fc.ConfirmationSearchLimit, "100"),
-		ProjectID:                  getEnvWithFile("PROJECT_ID", fc.ProjectID, "1"),
-		ProjectOrg:                 getEnvWithFile("PROJECT_ORG", fc.ProjectOrg, "its-the-vibe"),
-		AgentWorkingDir:            getEnvWithFile("AGENT_WORKING_DIR", fc.AgentWorkingDir, "/tmp/agent"),
-		LogLevel:                   getEnvWithFile("LOG_LEVEL", fc.LogLevel, "INFO"),
-	}
-}
-
-func getEnvAsIntSeconds(key, defaultValue string) int {
-	val := os.Getenv(key)
-	if val == "" {
-		val = defaultValue
-	}
-	return parseIntSeconds(val, key)
-}
-
-func getEnvAsInt(key, defaultValue string) int {
-	val := os.Getenv(key)
-	if val == "" {
-		val = defaultValue
+		RedisAddr:                  l.str("REDIS_ADDR", fc.RedisAddr, "host.docker.internal:6379"),
+		RedisChannel:               l.str("REDIS_CHANNEL", fc.RedisChannel, "slack-commands"),
+		RedisViewSubmissionChannel: l.str("REDIS_VIEW_SUBMISSION_CHANNEL", fc.RedisViewSubmissionChannel, "slack-relay-view-submission"),
+		RedisReactionChannel:       l.str("REDIS_REACTION_CHANNEL", fc.RedisReactionChannel, "slack-relay-reaction-added"),
+		RedisMessageActionChannel:  l.str("REDIS_MESSAGE_ACTION_CHANNEL", fc.RedisMessageActionChannel, "slack-relay-message-action"),
+		RedisBlockActionChannel:    l.str("REDIS_BLOCK_ACTION_CHANNEL", fc.RedisBlockActionChannel, "slack-relay-block-actions"),
+		RedisSlackLinerList:        l.str("REDIS_SLACKLINER_LIST", fc.RedisSlackLinerList, "slack_messages"),
+		RedisPoppitList:            l.str("REDIS_POPPIT_LIST", fc.RedisPoppitList, "poppit:commands"),
+		RedisPoppitBuilderList:     l.str("REDIS_POPPIT_BUILDER_LIST", fc.RedisPoppitBuilderList, "poppit:build-commands"),
+		RedisPoppitOutputChannel:   l.str("REDIS_POPPIT_OUTPUT_CHANNEL", fc.RedisPoppitOutputChannel, "poppit:command-output"),
+		RedisGitHubWebhookChannel:  l.str("REDIS_GITHUB_WEBHOOK_CHANNEL", fc.RedisGitHubWebhookChannel, "github-webhook-issues"),
+		RedisSlackReactionsList:    l.str("REDIS_SLACK_REACTIONS_LIST", fc.RedisSlackReactionsList, "slack_reactions"),
+		RedisTimeBombChannel:       l.str("REDIS_TIMEBOMB_CHANNEL", fc.RedisTimeBombChannel, "timebomb-messages"),
+		RedisIssueIndexPrefix:      l.str("REDIS_ISSUE_INDEX_PREFIX", fc.RedisIssueIndexPrefix, "slashvibeissue:issue-message:"),
+		RedisIssueThreadPrefix:     l.str("REDIS_ISSUE_THREAD_PREFIX", fc.RedisIssueThreadPrefix, "slashvibeissue:issue-thread:"),
+		IssueThreadTTL:             l.seconds("ISSUE_THREAD_TTL", fc.IssueThreadTTL, "720h"),
+		IssueSourceFooter:          l.str("ISSUE_SOURCE_FOOTER", fc.IssueSourceFooter, "Source: {{.Permalink}}"),
+		RedisFailedCommandPrefix:   l.str("REDIS_FAILED_COMMAND_PREFIX", fc.RedisFailedCommandPrefix, "slashvibeissue:failed-command:"),
+		RedisRepoDetailsPrefix:     l.str("REDIS_REPO_DETAILS_PREFIX", fc.RedisRepoDetailsPrefix, "slashvibeissue:repo-details:"),
+		RedisTranscriptPrefix:      l.str("REDIS_TRANSCRIPT_PREFIX", fc.RedisTranscriptPrefix, "slashvibeissue:transcript:"),
+		RepoDetailsTTL:             l.seconds("REPO_DETAILS_TTL", fc.RepoDetailsTTL, "1h"),
+		RedisGitHubLoginsKey:       l.str("REDIS_GITHUB_LOGINS_KEY", fc.RedisGitHubLoginsKey, "slashvibeissue:github-logins"),
+		GitHubLogins:               fileOnly(l, "github_logins", fc.GitHubLogins, len(fc.GitHubLogins)),
+		GitHubLinkAdmins:           l.list("GITHUB_LINK_ADMINS", fc.GitHubLinkAdmins, ""),
+		Presets:                    l.presets(fileOnly(l, "presets", fc.Presets, len(fc.Presets))),
+		ConfirmationRoutes:         fileOnly(l, "confirmation_routes", fc.ConfirmationRoutes, len(fc.ConfirmationRoutes)),
+		DuplicateCheck:             l.bool("DUPLICATE_CHECK", fc.DuplicateCheck, "true"),
+		RedisPendingIssuePrefix:    l.str("REDIS_PENDING_ISSUE_PREFIX", fc.RedisPendingIssuePrefix, "slashvibeissue:pending-issue:"),
+		PendingIssueTTL:            l.seconds("PENDING_ISSUE_TTL", fc.PendingIssueTTL, "24h"),
+		RedisDeadLetterPrefix:      l.str("REDIS_DEAD_LETTER_PREFIX", fc.RedisDeadLetterPrefix, "slashvibeissue:dead-letter:"),
+		RedisStreamChannels:        l.list("REDIS_STREAM_CHANNELS", fc.RedisStreamChannels, ""),
+		RedisIdempotencyPrefix:     l.str("REDIS_IDEMPOTENCY_PREFIX", fc.RedisIdempotencyPrefix, "slashvibeissue:seen:"),
+		IdempotencyTTL:             l.seconds("IDEMPOTENCY_TTL", fc.IdempotencyTTL, "10m"),
+		RedisStreamGroupPrefix:     l.str("REDIS_STREAM_GROUP_PREFIX", fc.RedisStreamGroupPrefix, "slashvibeissue"),
+		RedisStreamConsumer:        l.str("REDIS_STREAM_CONSUMER", fc.RedisStreamConsumer, defaultStreamConsumer(hostname, hostErr)),
+		RedisStreamClaimIdle:       l.seconds("REDIS_STREAM_CLAIM_IDLE", fc.RedisStreamClaimIdle, "1m"),
+		RedisStreamMaxDeliveries:   l.int("REDIS_STREAM_MAX_DELIVERIES", fc.RedisStreamMaxDeliveries, "5"),
+		SlackLinerURL:              l.str("SLACKLINER_URL", fc.SlackLinerURL, ""),
+		AttachmentUploadURL:        l.str("ATTACHMENT_UPLOAD_URL", fc.AttachmentUploadURL, ""),
+		AttachmentPublicURL:        l.str("ATTACHMENT_PUBLIC_URL", fc.AttachmentPublicURL, ""),
+		AttachmentMaxBytes:         l.int("ATTACHMENT_MAX_BYTES", fc.AttachmentMaxBytes, "10485760"),
+		AttachmentTypes:            l.list("ATTACHMENT_TYPES", fc.AttachmentTypes, "image/*,text/*,application/pdf,application/json"),
+		GitHubOrg:                  l.str("GITHUB_ORG", fc.GitHubOrg, ""),
+		WorkingDir:                 l.str("WORKING_DIR", fc.WorkingDir, "/tmp"),
+		ConfirmationChannelID:      l.str("CONFIRMATION_CHANNEL_ID", fc.ConfirmationChannelID, ""),
+		ConfirmationTTL:            l.seconds("CONFIRMATION_TTL", fc.ConfirmationTTL, "48h"),
+		ConfirmationSearchLimit:    l.int("CONFIRMATION_SEARCH_LIMIT", fc.ConfirmationSearchLimit, "100"),
+		FailedCommandTTL:           l.seconds("FAILED_COMMAND_TTL", fc.FailedCommandTTL, "24h"),
+		ProjectID:                  l.str("PROJECT_ID", fc.ProjectID, "1"),
+		ProjectOrg:                 l.str("PROJECT_ORG", fc.ProjectOrg, "its-the-vibe"),
+		AgentWorkingDir:            l.str("AGENT_WORKING_DIR", fc.AgentWorkingDir, "/tmp/agent"),
+		LogLevel:                   l.str("LOG_LEVEL", fc.LogLevel, "INFO"),
+		LogFormat:                  l.str("LOG_FORMAT", fc.LogFormat, "text"),
+		HTTPAddr:                   l.str("HTTP_ADDR", fc.HTTPAddr, ":8080"),
+		DrainTimeout:               l.seconds("DRAIN_TIMEOUT", fc.DrainTimeout, "25s"),
 	}
-	if i, err := strconv.Atoi(val); err == nil {
-		return i
+	config.file = path
+	config.settings = l.settings
+	config.loadProblems = l.problems
+	return config
+}
+
+// configSource is where a setting's value came from.
+type configSource string
+
+const (
+	sourceEnv     configSource = "env"
+	sourceFile    configSource = "file"
+	sourceDefault configSource = "default"
+)
+
+// configSetting is one setting's effective value, as shown by "config check".
+type configSetting struct {
+	Key    string
+	Value  string
+	Source configSource
+	Secret bool
+}
+
+// configLoader resolves settings with env var > config file > default
+// precedence, recording the source of each value and any that fail to parse.
+type configLoader struct {
+	settings []configSetting
+	problems []error
+}
+
+// lookup records and returns the raw value of a setting.
+func (l *configLoader) lookup(key, fileValue, defaultValue string) string {
+	value, source := os.Getenv(key), sourceEnv
+	if value == "" {
+		value, source = fileValue, sourceFile
 	}
-	// If parsing fails, try to parse the default value
-	if i, err := strconv.Atoi(defaultValue); err == nil {
-		log.Printf("Unable to parse %s=%q as int; using default %d", key, val, i)
-		return i
+	if value == "" {
+		value, source = defaultValue, sourceDefault
 	}
-	log.Printf("Unable to parse %s=%q as int; defaulting to 0", key, val)
-	return 0
+	l.settings = append(l.settings, configSetting{Key: key, Value: value, Source: source})
+	return value
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func (l *configLoader) secret(key string) string {
+	value := os.Getenv(key)
+	setting := configSetting{Key: key, Value: value, Source: sourceEnv, Secret: true}
+	if value == "" {
+		setting.Source = sourceDefault
 	}
-	return defaultValue
+	l.settings = append(l.settings, setting)
+	return value
 }
 
-// getEnvWithFile returns the env var value if set, the config-file value if
-// non-empty, or the hard-coded defaultValue otherwise.
-func getEnvWithFile(key, fileValue, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	if fileValue != "" {
-		return fileValue
+func (l *configLoader) str(key, fileValue, defaultValue string) string {
+	return l.lookup(key, fileValue, defaultValue)
+}
+
+// seconds, int and bool return the parsed value of a setting.  A value that
+// does not parse is recorded as a problem and the default is used instead.
+func (l *configLoader) seconds(key, fileValue, defaultValue string) int {
+	seconds, err := parseSeconds(l.lookup(key, fileValue, defaultValue))
+	if err != nil {
+		l.problems = append(l.problems, fmt.Errorf("%s: %v", key, err))
+		seconds, _ = parseSeconds(defaultValue)
 	}
-	return defaultValue
+	return seconds
 }
 
-// getEnvAsIntSecondsWithFile is getEnvAsIntSeconds extended with a config-file
-// fallback between the env var and the hard-coded default.
-func getEnvAsIntSecondsWithFile(key, fileValue, defaultValue string) int {
-	if val := os.Getenv(key); val != "" {
-		return parseIntSeconds(val, key)
+func (l *configLoader) int(key, fileValue, defaultValue string) int {
+	raw := l.lookup(key, fileValue, defaultValue)
+	if raw == "" {
+		return 0
 	}
-	if fileValue != "" {
-		return parseIntSeconds(fileValue, key)
+	i, err := strconv.Atoi(raw)
+	if err != nil {
+		l.problems = append(l.problems, fmt.Errorf("%s: %q is not a whole number", key, raw))
+		i, _ = strconv.Atoi(defaultValue)
 	}
-	return parseIntSeconds(defaultValue, key)
+	return i
 }
 
-// getEnvAsIntWithFile is getEnvAsInt extended with a config-file fallback.
-func getEnvAsIntWithFile(key, fileValue, defaultValue string) int {
-	if val := os.Getenv(key); val != "" {
-		if i, err := strconv.Atoi(val); err == nil {
-			return i
-		}
+func (l *configLoader) bool(key, fileValue, defaultValue string) bool {
+	raw := l.lookup(key, fileValue, defaultValue)
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		l.problems = append(l.problems, fmt.Errorf("%s: %q is not true or false", key, raw))
+		b, _ = strconv.ParseBool(defaultValue)
 	}
-	if fileValue != "" {
-		if i, err := strconv.Atoi(fileValue); err == nil {
-			return i
-		}
-		log.Printf("Unable to parse config-file value for %s=%q as int; using default", key, fileValue)
+	return b
+}
+
+func (l *configLoader) list(key string, fileValue []string, defaultValue string) []string {
+	return parseList(l.lookup(key, strings.Join(fileValue, ","), defaultValue))
+}
+
+// fileOnly records a config-file section that has no env var equivalent.
+func fileOnly[T any](l *configLoader, key string, value T, entries int) T {
+	setting := configSetting{Key: key, Value: fmt.Sprintf("%d entries", entries), Source: sourceFile}
+	if entries == 0 {
+		setting.Value, setting.Source = "(none)", sourceDefault
 	}
-	if i, err := strconv.Atoi(defaultValue); err == nil {
-		return i
+	l.settings = append(l.settings, setting)
+	return value
+}
+
+// presets returns the usable presets, recording the problems with the others.
+func (l *configLoader) presets(presets []issuePreset) []issuePreset {
+	valid, problems := loadPresets(presets)
+	l.problems = append(l.problems, problems...)
+	return valid
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
-	log.Printf("Unable to parse %s default=%q as int; defaulting to 0", key, defaultValue)
-	return 0
+	return defaultValue
 }
 
-// parseIntSeconds parses val as a plain integer (seconds) or a Go duration
-// string (e.g. "48h").  key is used only for log messages.
-func parseIntSeconds(val, key string) int {
+// parseSeconds parses a plain integer (seconds) or a Go duration string.
+func parseSeconds(val string) (int, error) {
 	if i, err := strconv.Atoi(val); err == nil {
-		return i
+		return i, nil
 	}
 	if d, err := time.ParseDuration(val); err == nil {
-		return int(d.Seconds())
+		return int(d.Seconds()), nil
 	}
-	log.Printf("Unable to parse %s=%q as int seconds or duration; defaulting to 0", key, val)
-	return 0
+	return 0, fmt.Errorf("%q is not a number of seconds or a duration such as 48h", val)
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// maxConfirmationSearchLimit is the largest page conversations.history returns.
+const maxConfirmationSearchLimit = 1000
+
+// slackChannelIDPattern matches public (C), private (G) and DM (D) channel IDs.
+var slackChannelIDPattern = regexp.MustCompile(`^[CGD][A-Z0-9]{8,}$`)
+
+// Validate reports every problem with the configuration at once, joined into a
+// single error, or nil if there are none.
+func (c Config) Validate() error {
+	problems := append([]error(nil), c.loadProblems...)
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if c.SlackBotToken == "" {
+		problemf("SLACK_BOT_TOKEN is required")
+	}
+	if c.GitHubOrg == "" {
+		problemf("GITHUB_ORG is required")
+	}
+	switch {
+	case c.ConfirmationChannelID == "":
+		problemf("CONFIRMATION_CHANNEL_ID is required")
+	case !slackChannelIDPattern.MatchString(c.ConfirmationChannelID):
+		problemf("CONFIRMATION_CHANNEL_ID: %q is not a Slack channel ID such as C0123456789", c.ConfirmationChannelID)
+	}
+
+	for i, route := range c.ConfirmationRoutes {
+		problems = append(problems, route.validate(i+1)...)
+	}
+
+	if c.SlackLinerURL != "" {
+		u, err := url.Parse(c.SlackLinerURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problemf("SLACKLINER_URL: %q is not an http(s) URL such as http://slackliner:8080", c.SlackLinerURL)
+		}
+	}
+
+	for _, u := range []struct{ key, value string }{
+		{"ATTACHMENT_UPLOAD_URL", c.AttachmentUploadURL},
+		{"ATTACHMENT_PUBLIC_URL", c.AttachmentPublicURL},
+	} {
+		if u.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u.value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problemf("%s: %q is not an http(s) URL such as http://files:8080/uploads", u.key, u.value)
+		}
+	}
+	if _, err := renderSourceFooter(c.IssueSourceFooter, sourceFooterData{}); err != nil {
+		problemf("ISSUE_SOURCE_FOOTER: %v", err)
+	}
+	if c.AttachmentMaxBytes < 0 {
+		problemf("ATTACHMENT_MAX_BYTES must not be negative")
+	}
+	for _, pattern := range c.AttachmentTypes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problemf("ATTACHMENT_TYPES: %q is not a valid pattern such as image/*", pattern)
+		}
+	}
+
+	for _, d := range []struct {
+		key     string
+		seconds int
+	}{
+		{"REPO_DETAILS_TTL", c.RepoDetailsTTL},
+		{"PENDING_ISSUE_TTL", c.PendingIssueTTL},
+		{"IDEMPOTENCY_TTL", c.IdempotencyTTL},
+		{"REDIS_STREAM_CLAIM_IDLE", c.RedisStreamClaimIdle},
+		{"CONFIRMATION_TTL", c.ConfirmationTTL},
+		{"FAILED_COMMAND_TTL", c.FailedCommandTTL},
+		{"ISSUE_THREAD_TTL", c.IssueThreadTTL},
+		{"DRAIN_TIMEOUT", c.DrainTimeout},
+	} {
+		if d.seconds < 0 {
+			problemf("%s must not be negative", d.key)
+		}
+	}
+	if c.ConfirmationSearchLimit < 1 || c.ConfirmationSearchLimit > maxConfirmationSearchLimit {
+		problemf("CONFIRMATION_SEARCH_LIMIT must be between 1 and %d", maxConfirmationSearchLimit)
+	}
+	if c.RedisStreamMaxDeliveries < 0 {
+		problemf("REDIS_STREAM_MAX_DELIVERIES must not be negative")
+	}
+
+	switch strings.ToUpper(c.LogLevel) {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+	default:
+		problemf("LOG_LEVEL: %q is not one of DEBUG, INFO, WARN or ERROR", c.LogLevel)
+	}
+	switch strings.ToLower(c.LogFormat) {
+	case "text", "json":
+	default:
+		problemf("LOG_FORMAT: %q is not text or json", c.LogFormat)
+	}
+	if _, _, err := net.SplitHostPort(c.HTTPAddr); err != nil {
+		problemf("HTTP_ADDR: %q is not a listen address such as :8080", c.HTTPAddr)
+	}
+
+	handlers := channelHandlers(c)
+	for _, channel := range c.RedisStreamChannels {
+		if _, ok := handlers[channel]; !ok {
+			problemf("REDIS_STREAM_CHANNELS: %q is not one of the subscribed channels", channel)
+		}
+	}
+
+	return errors.Join(problems...)
+}
+
+// runConfigCheck implements "slashvibeissue config check": it prints every
+// setting with where its value came from, secrets masked, followed by any
+// validation problems.  It returns the process exit code.
+func runConfigCheck(config Config, out io.Writer) int {
+	fmt.Fprintf(out, "Config file: %s\n\n", config.file)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, s := range config.settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, displayValue(s), s.Source)
+	}
+	w.Flush()
+
+	if err := config.Validate(); err != nil {
+		fmt.Fprintln(out, "\nProblems:")
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(out, "  - %s\n", line)
+		}
+		return 1
+	}
+	fmt.Fprintln(out, "\nConfiguration OK")
+	return 0
+}
+
+func displayValue(s configSetting) string {
+	switch {
+	case s.Value == "":
+		return "(not set)"
+	case s.Secret:
+		return "********"
+	default:
+		return s.Value
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	redactedValue        = "[REDACTED]"
+	maxLoggedPayloadSize = 2000
+)
+
+// redactedPayloadKeys are payload fields never written to the logs: Slack's
+// verification token, and response URLs that allow posting to the channel.
+var redactedPayloadKeys = map[string]bool{
+	"token":         true,
+	"response_url":  true,
+	"response_urls": true,
+}
+
+// errDeadLettered is returned for an event whose handler panicked once the
+// event has been saved to the dead-letter list.  The event is not retried.
+var errDeadLettered = errors.New("handler panicked, event dead-lettered")
+
+var handlerPanics = newCounterVec("slashvibeissue_handler_panics_total",
+	"Handler invocations that panicked, by handler.", "handler")
+
+var deadLettersTotal = newCounterVec("slashvibeissue_dead_letters_total",
+	"Events pushed to a dead-letter list, by handler.", "handler")
+
+// deadLetter is an event that could not be processed, as stored in the
+// dead-letter list of its source channel.  Payload is kept unredacted so the
+// event can be inspected and replayed.
+type deadLetter struct {
+	Handler       string `json:"handler"`
+	Channel       string `json:"channel"`
+	Payload       string `json:"payload"`
+	Error         string `json:"error"`
+	Stack         string `json:"stack,omitempty"`
+	FailedAt      string `json:"failed_at"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// deadLetterKey returns the dead-letter list for a source channel.
+func deadLetterKey(channel string, config Config) string {
+	return config.RedisDeadLetterPrefix + channel
+}
+
+// recoverPanics stops a panic in one event's handler from taking down the
+// subscriber.  The panic is logged with the redacted payload and a stack
+// trace, counted, and the event is pushed to its channel's dead-letter list.
+func recoverPanics(rdb Queue, channel, name string, config Config, handle messageHandler) messageHandler {
+	return func(ctx context.Context, payload string) (err error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			stack := string(debug.Stack())
+			handlerPanics.inc(name)
+			ErrorContext(ctx, "Panic in %s handler: %v\npayload: %s\n%s", name, r, redactPayload(payload), stack)
+
+			entry := newDeadLetter(ctx, channel, name, payload, fmt.Sprint(r))
+			entry.Stack = stack
+			if pushErr := pushDeadLetter(ctx, rdb, entry, config); pushErr != nil {
+				err = fmt.Errorf("panic in %s handler: %v (dead-lettering failed: %v)", name, r, pushErr)
+				return
+			}
+			err = fmt.Errorf("%w: %v", errDeadLettered, r)
+		}()
+
+		return handle(ctx, payload)
+	}
+}
+
+func newDeadLetter(ctx context.Context, channel, name, payload, reason string) deadLetter {
+	return deadLetter{
+		Handler:       name,
+		Channel:       channel,
+		Payload:       payload,
+		Error:         reason,
+		FailedAt:      time.Now().UTC().Format(time.RFC3339),
+		CorrelationID: correlationID(ctx),
+	}
+}
+
+func pushDeadLetter(ctx context.Context, rdb Queue, entry deadLetter, config Config) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshaling dead letter: %v", err)
+	}
+	// Saved even if shutdown has started
+	key := deadLetterKey(entry.Channel, config)
+	if err := rdb.RPush(context.WithoutCancel(ctx), key, data).Err(); err != nil {
+		return fmt.Errorf("error pushing to %s: %v", key, err)
+	}
+	deadLettersTotal.inc(entry.Handler)
+	return nil
+}
+
+// deadLetterEvent saves an event whose handler failed to its channel's
+// dead-letter list.  Errors are logged, as there is nowhere left to report them.
+func deadLetterEvent(ctx context.Context, rdb Queue, channel, name, payload string, reason error, config Config) {
+	entry := newDeadLetter(ctx, channel, name, payload, reason.Error())
+	if err := pushDeadLetter(ctx, rdb, entry, config); err != nil {
+		ErrorContext(ctx, "Error dead-lettering %s event: %v", name, err)
+		return
+	}
+	WarnContext(ctx, "Dead-lettered %s event to %s: %v", name, deadLetterKey(channel, config), reason)
+}
+
+// redactPayload returns payload with secret fields replaced, for logging.
+// Payloads that are not JSON are not logged, only their size.
+func redactPayload(payload string) string {
+	var value interface{}
+	if err := json.Unmarshal([]byte(payload), &value); err != nil {
+		return fmt.Sprintf("(%d bytes, not JSON)", len(payload))
+	}
+
+	data, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return fmt.Sprintf("(%d bytes)", len(payload))
+	}
+	if len(data) > maxLoggedPayloadSize {
+		return string(data[:maxLoggedPayloadSize]) + "..."
+	}
+	return string(data)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redactedPayloadKeys[key] {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// inFlight tracks the handler invocations that are running, so shutdown can
+// wait for them instead of cutting them off mid-request.
+var inFlight = newHandlerSupervisor()
+
+// errDraining is returned for messages that arrive once the drain has begun.
+// A stream entry stays unacknowledged and is claimed again after a restart.
+var errDraining = errors.New("shutting down, handler not started")
+
+// handlerSupervisor counts running handler invocations and gives them a
+// context that outlives the subscriber context: cancelling the subscribers
+// stops new messages being read, while the handlers already running carry on
+// until they finish or the drain timeout is reached.
+type handlerSupervisor struct {
+	wg sync.WaitGroup
+
+	// abort is cancelled when the drain timeout expires
+	abort     context.Context
+	abortFunc context.CancelFunc
+
+	mu       sync.Mutex
+	draining bool
+	nextID   uint64
+	running  map[uint64]runningHandler
+}
+
+type runningHandler struct {
+	name    string
+	started time.Time
+}
+
+func newHandlerSupervisor() *handlerSupervisor {
+	abort, abortFunc := context.WithCancel(context.Background())
+	return &handlerSupervisor{
+		abort:     abort,
+		abortFunc: abortFunc,
+		running:   make(map[uint64]runningHandler),
+	}
+}
+
+// track runs each invocation of the named handler under the supervisor.  The
+// handler's context is detached from the subscriber's cancellation and only
+// cancelled if the drain gives up on it.
+func (s *handlerSupervisor) track(name string, handle messageHandler) messageHandler {
+	return func(ctx context.Context, payload string) error {
+		id, ok := s.start(name)
+		if !ok {
+			return errDraining
+		}
+		defer s.finish(id)
+
+		ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		defer cancel()
+		stop := context.AfterFunc(s.abort, cancel)
+		defer stop()
+
+		return handle(ctx, payload)
+	}
+}
+
+// start registers a handler invocation, unless the drain has begun.  The
+// WaitGroup is only added to under the mutex, so no Add can race with the
+// drain's Wait.
+func (s *handlerSupervisor) start(name string) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return 0, false
+	}
+
+	s.wg.Add(1)
+	s.nextID++
+	s.running[s.nextID] = runningHandler{name: name, started: time.Now()}
+	return s.nextID, true
+}
+
+func (s *handlerSupervisor) finish(id uint64) {
+	s.mu.Lock()
+	delete(s.running, id)
+	s.mu.Unlock()
+
+	s.wg.Done()
+}
+
+// drain waits up to timeout for the running handlers to finish; no new ones
+// are started.  Handlers still running after that have their context
+// cancelled and are returned, oldest first, described as
+// "name (running for 1.5s)".
+func (s *handlerSupervisor) drain(timeout time.Duration) []string {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	s.abortFunc()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	handlers := make([]runningHandler, 0, len(s.running))
+	for _, h := range s.running {
+		handlers = append(handlers, h)
+	}
+	sort.Slice(handlers, func(i, j int) bool { return handlers[i].started.Before(handlers[j].started) })
+
+	abandoned := make([]string, len(handlers))
+	for i, h := range handlers {
+		abandoned[i] = fmt.Sprintf("%s (running for %s)", h.name, time.Since(h.started).Round(time.Millisecond))
+	}
+	return abandoned
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// duplicateSimilarityThreshold is the share of title keywords two issues
+	// must have in common to be reported as likely duplicates.
+	duplicateSimilarityThreshold = 0.5
+	// maxDuplicateKeywords keeps the search within GitHub's limit of five
+	// boolean operators per query.
+	maxDuplicateKeywords   = 5
+	maxDuplicateCandidates = 20
+	maxDuplicatesShown     = 5
+)
+
+// duplicateStopWords are ignored when comparing titles.
+var duplicateStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "can": true, "for": true, "from": true,
+	"in": true, "into": true, "is": true, "it": true, "not": true, "of": true,
+	"on": true, "or": true, "the": true, "to": true, "when": true, "with": true,
+}
+
+// titleKeywords returns the distinct lower-cased words of a title, without
+// punctuation, stop words or single characters, in order of appearance.
+func titleKeywords(title string) []string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	seen := make(map[string]bool)
+	var keywords []string
+	for _, word := range words {
+		if len([]rune(word)) < 2 || duplicateStopWords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		keywords = append(keywords, word)
+	}
+	return keywords
+}
+
+// titleSimilarity is the Jaccard similarity of two titles' keywords.
+func titleSimilarity(a, b string) float64 {
+	keywordsA, keywordsB := titleKeywords(a), titleKeywords(b)
+	if len(keywordsA) == 0 || len(keywordsB) == 0 {
+		return 0
+	}
+
+	inA := make(map[string]bool, len(keywordsA))
+	for _, word := range keywordsA {
+		inA[word] = true
+	}
+	shared := 0
+	for _, word := range keywordsB {
+		if inA[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(keywordsA)+len(keywordsB)-shared)
+}
+
+// duplicateSearchQuery builds a GitHub search matching open issues whose title
+// shares any of the title's leading keywords.  It is empty when the title has
+// no usable keywords.
+func duplicateSearchQuery(title string) string {
+	keywords := titleKeywords(title)
+	if len(keywords) == 0 {
+		return ""
+	}
+	if len(keywords) > maxDuplicateKeywords {
+		keywords = keywords[:maxDuplicateKeywords]
+	}
+	return strings.Join(keywords, " OR ") + " in:title"
+}
+
+// likelyDuplicates returns the candidates similar enough to title, most
+// similar first.
+func likelyDuplicates(title string, candidates []issueSummary) []issueSummary {
+	type scored struct {
+		issue issueSummary
+		score float64
+	}
+	var matches []scored
+	for _, candidate := range candidates {
+		if score := titleSimilarity(title, candidate.Title); score >= duplicateSimilarityThreshold {
+			matches = append(matches, scored{candidate, score})
+		}
+	}
+
+	// Insertion sort keeps gh's relevance order for equal scores
+	for i := 1; i < len(matches); i++ {
+		for j := i; j > 0 && matches[j].score > matches[j-1].score; j-- {
+			matches[j], matches[j-1] = matches[j-1], matches[j]
+		}
+	}
+
+	duplicates := make([]issueSummary, 0, len(matches))
+	for _, match := range matches {
+		duplicates = append(duplicates, match.issue)
+	}
+	return duplicates
+}
+
+func pendingIssueKey(id string, config Config) string {
+	return config.RedisPendingIssuePrefix + id
+}
+
+// storePendingIssue saves an issue request while its duplicate check runs and
+// returns its ID.
+func storePendingIssue(ctx context.Context, rdb RedisClient, req IssueRequest, config Config) (string, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal pending issue: %v", err)
+	}
+
+	id := newRandomID()
+	ttl := time.Duration(config.PendingIssueTTL) * time.Second
+	if err := rdb.Set(ctx, pendingIssueKey(id, config), payload, ttl).Err(); err != nil {
+		return "", fmt.Errorf("failed to store pending issue: %v", err)
+	}
+	return id, nil
+}
+
+// takePendingIssue loads and deletes a pending issue so it is acted on at most once.
+func takePendingIssue(ctx context.Context, rdb RedisClient, id string, config Config) (IssueRequest, bool, error) {
+	data, err := rdb.GetDel(ctx, pendingIssueKey(id, config)).Result()
+	if errors.Is(err, redis.Nil) {
+		return IssueRequest{}, false, nil
+	}
+	if err != nil {
+		return IssueRequest{}, false, fmt.Errorf("failed to load pending issue: %v", err)
+	}
+
+	var req IssueRequest
+	if err := json.Unmarshal([]byte(data), &req); err != nil {
+		return IssueRequest{}, false, fmt.Errorf("failed to unmarshal pending issue: %v", err)
+	}
+	return req, true, nil
+}
+
+// submitIssue creates the issue, first searching the repository for likely
+// duplicates when DUPLICATE_CHECK is enabled.
+func submitIssue(ctx context.Context, rdb RedisClient, req IssueRequest, config Config) error {
+	query := duplicateSearchQuery(req.Title)
+	if !config.DuplicateCheck || query == "" {
+		return createGitHubIssue(ctx, rdb, req, config)
+	}
+
+	repoFullName := parseRepoFullName(req.Repo, config.GitHubOrg)
+	if err := validateRepoFullName(repoFullName); err != nil {
+		return err
+	}
+
+	pendingID, err := storePendingIssue(ctx, rdb, req, config)
+	if err != nil {
+		return err
+	}
+
+	ghCmd := newShellCommand("gh", "issue", "list").
+		Flag("--repo", repoFullName).
+		Flag("--state", "open").
+		Flag("--search", query).
+		Flag("--limit", fmt.Sprintf("%d", maxDuplicateCandidates)).
+		Flag("--json", "number,title,url")
+
+	poppitCmd := PoppitCommand{
+		Repo:     repoFullName,
+		Branch:   "refs/heads/main",
+		Type:     "slash-vibe-issue-duplicates",
+		Dir:      config.WorkingDir,
+		Commands: []string{ghCmd.String()},
+		Metadata: map[string]interface{}{
+			"pending_id": pendingID,
+			"repo":       repoFullName,
+			"title":      req.Title,
+			"user_id":    req.UserID,
+		},
+	}
+
+	if err := pushPoppitCommand(ctx, rdb, config.RedisPoppitList, poppitCmd); err != nil {
+		return err
+	}
+
+	DebugContext(ctx, "Duplicate check for %q in %s sent to Poppit", req.Title, repoFullName)
+	return nil
+}
+
+// handleDuplicateCheckOutput creates the pending issue unless the search found
+// likely duplicates, in which case the requester is asked what to do.  A failed
+// search never blocks creation.
+func handleDuplicateCheckOutput(ctx context.Context, rdb RedisClient, slackClient SlackAPI, output PoppitOutput, config Config) error {
+	pendingID, _ := output.Metadata["pending_id"].(string)
+	if pendingID == "" {
+		WarnContext(ctx, "No pending_id in duplicate check output")
+		return nil
+	}
+
+	var duplicates []issueSummary
+	if reason, failed := poppitFailure(output); failed {
+		WarnContext(ctx, "Duplicate check failed, creating issue anyway: %s", reason)
+	} else if candidates, err := parseIssueSummaries(output.Output); err != nil {
+		WarnContext(ctx, "Error parsing duplicate check output, creating issue anyway: %v", err)
+	} else {
+		title, _ := output.Metadata["title"].(string)
+		duplicates = likelyDuplicates(title, candidates)
+	}
+
+	userID, _ := output.Metadata["user_id"].(string)
+	if len(duplicates) > 0 && userID != "" {
+		err := notifyPossibleDuplicates(slackClient, userID, pendingID, output.Metadata, duplicates)
+		if err == nil {
+			return nil
+		}
+		ErrorContext(ctx, "Error sending duplicate notice to user %s, creating issue anyway: %v", userID, err)
+	}
+
+	req, found, err := takePendingIssue(ctx, rdb, pendingID, config)
+	if err != nil {
+		return err
+	}
+	if !found {
+		WarnContext(ctx, "Pending issue %s has expired", pendingID)
+		return nil
+	}
+	return createGitHubIssue(ctx, rdb, req, config)
+}
+
+// buildDuplicateBlocks renders the duplicate notice: the likely duplicates,
+// each with a button to comment on it instead, and a "Create anyway" button.
+func buildDuplicateBlocks(pendingID, repo, title string, duplicates []issueSummary) []slack.Block {
+	if len(duplicates) > maxDuplicatesShown {
+		duplicates = duplicates[:maxDuplicatesShown]
+	}
+
+	intro := fmt.Sprintf("🔍 *%s* may already be tracked in *%s*:", escapeSlackText(title), repo)
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, intro, false, false), nil, nil),
+	}
+
+	for _, issue := range duplicates {
+		text := fmt.Sprintf("<%s|#%d> %s", issue.URL, issue.Number, escapeSlackText(issue.Title))
+		button := slack.NewButtonBlockElement(commentOnExistingActionID, pendingID+" "+issue.URL,
+			slack.NewTextBlockObject(slack.PlainTextType, "Comment here instead", false, false))
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil,
+			slack.NewAccessory(button)))
+	}
+
+	createButton := slack.NewButtonBlockElement(createIssueAnywayActionID, pendingID,
+		slack.NewTextBlockObject(slack.PlainTextType, "Create anyway", false, false))
+	createButton.Style = slack.StylePrimary
+	blocks = append(blocks, slack.NewActionBlock("duplicate_actions_block", createButton))
+
+	return blocks
+}
+
+func notifyPossibleDuplicates(slackClient SlackAPI, userID, pendingID string, metadata map[string]interface{}, duplicates []issueSummary) error {
+	repo, _ := metadata["repo"].(string)
+	title, _ := metadata["title"].(string)
+
+	blocks := buildDuplicateBlocks(pendingID, repo, title, duplicates)
+	fallback := fmt.Sprintf("%q may already be tracked in %s", title, repo)
+
+	if _, _, err := slackClient.PostMessage(userID, slack.MsgOptionText(fallback, false), slack.MsgOptionBlocks(blocks...)); err != nil {
+		return err
+	}
+
+	Info("Sent %d possible duplicates of %q to user %s", len(duplicates), title, userID)
+	return nil
+}
+
+// handleCreateAnyway handles a click on "Create anyway" in a duplicate notice.
+func handleCreateAnyway(ctx context.Context, rdb RedisClient, event BlockActionEvent, action BlockAction, config Config) error {
+	req, found, err := takePendingIssue(ctx, rdb, action.Value, config)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return replaceDuplicateNotice(ctx, event, "⌛ This request has expired or was already handled.")
+	}
+	ctx = withCorrelationID(ctx, req.CorrelationID)
+
+	InfoContext(ctx, "User %s chose to create %q despite possible duplicates", event.User.Username, req.Title)
+
+	if err := createGitHubIssue(ctx, rdb, req, config); err != nil {
+		return err
+	}
+	return replaceDuplicateNotice(ctx, event, fmt.Sprintf("🆕 Creating *%s* in *%s*.", escapeSlackText(req.Title), req.Repo))
+}
+
+// handleCommentOnExisting handles a click on "Comment here instead": the
+// request is added to the existing issue as a comment.
+func handleCommentOnExisting(ctx context.Context, rdb RedisClient, event BlockActionEvent, action BlockAction, config Config) error {
+	pendingID, issueURL, _ := strings.Cut(action.Value, " ")
+	if err := validateIssueURL(issueURL); err != nil {
+		return err
+	}
+
+	req, found, err := takePendingIssue(ctx, rdb, pendingID, config)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return replaceDuplicateNotice(ctx, event, "⌛ This request has expired or was already handled.")
+	}
+	ctx = withCorrelationID(ctx, req.CorrelationID)
+
+	InfoContext(ctx, "User %s chose to comment on %s instead of creating %q", event.User.Username, issueURL, req.Title)
+
+	body := appendFooter(duplicateCommentBody(req), requestedByFooter(req.GitHubLogin, req.Username))
+	if err := commentOnIssue(ctx, rdb, issueURL, body, req.UserID, config); err != nil {
+		return err
+	}
+
+	return replaceDuplicateNotice(ctx, event, fmt.Sprintf("💬 Adding your report to %s as a comment.", issueURL))
+}
+
+// commentOnIssue sends a `gh issue comment` command to Poppit.  The body is
+// kept in the metadata so that a failed comment can be retried.
+func commentOnIssue(ctx context.Context, rdb RedisClient, issueURL, body, userID string, config Config) error {
+	if err := validateIssueURL(issueURL); err != nil {
+		return err
+	}
+
+	ghCmd := newShellCommand("gh", "issue", "comment", issueURL).
+		Flag("--body", body)
+
+	poppitCmd := PoppitCommand{
+		Repo:     repoFromIssueURL(issueURL),
+		Branch:   "refs/heads/main",
+		Type:     "slash-vibe-issue-comment",
+		Dir:      config.WorkingDir,
+		Commands: []string{ghCmd.String()},
+		Metadata: map[string]interface{}{
+			"issueURL": issueURL,
+			"user_id":  userID,
+			"body":     body,
+		},
+	}
+
+	return pushPoppitCommand(ctx, rdb, config.RedisPoppitList, poppitCmd)
+}
+
+// duplicateCommentBody turns an issue request into a comment for an existing issue.
+func duplicateCommentBody(req IssueRequest) string {
+	body := fmt.Sprintf("**%s**", req.Title)
+	if description := strings.TrimSpace(req.issueBody()); description != "" {
+		body += "\n\n" + description
+	}
+	return body
+}
+
+func replaceDuplicateNotice(ctx context.Context, event BlockActionEvent, text string) error {
+	if err := postToResponseURL(ctx, event.ResponseURL, SlackResponseMessage{
+		ReplaceOriginal: true,
+		Text:            text,
+	}); err != nil {
+		ErrorContext(ctx, "Error updating duplicate notice: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// fakeRedis is an in-memory RedisClient.  Expirations are ignored.
+type fakeRedis struct {
+	mu        sync.Mutex
+	strings   map[string]string
+	hashes    map[string]map[string]string
+	lists     map[string][]string
+	published map[string][]string
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		strings:   make(map[string]string),
+		hashes:    make(map[string]map[string]string),
+		lists:     make(map[string][]string),
+		published: make(map[string][]string),
+	}
+}
+
+func fakeRedisString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (r *fakeRedis) RPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, value := range values {
+		r.lists[key] = append(r.lists[key], fakeRedisString(value))
+	}
+	return redis.NewIntResult(int64(len(r.lists[key])), nil)
+}
+
+func (r *fakeRedis) Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.published[channel] = append(r.published[channel], fakeRedisString(message))
+	return redis.NewIntResult(1, nil)
+}
+
+func (r *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.strings[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (r *fakeRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.strings[key] = fakeRedisString(value)
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (r *fakeRedis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.strings[key]; ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	r.strings[key] = fakeRedisString(value)
+	return redis.NewBoolResult(true, nil)
+}
+
+func (r *fakeRedis) GetDel(ctx context.Context, key string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.strings[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	delete(r.strings, key)
+	return redis.NewStringResult(value, nil)
+}
+
+func (r *fakeRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for _, key := range keys {
+		if _, ok := r.strings[key]; ok {
+			delete(r.strings, key)
+			deleted++
+		}
+		if _, ok := r.hashes[key]; ok {
+			delete(r.hashes, key)
+			deleted++
+		}
+		if _, ok := r.lists[key]; ok {
+			delete(r.lists, key)
+			deleted++
+		}
+	}
+	return redis.NewIntResult(deleted, nil)
+}
+
+func (r *fakeRedis) HGet(ctx context.Context, key, field string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.hashes[key][field]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+// HSet supports the field, value, field, value... form only.
+func (r *fakeRedis) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.hashes[key] == nil {
+		r.hashes[key] = make(map[string]string)
+	}
+	var added int64
+	for i := 0; i+1 < len(values); i += 2 {
+		field := fakeRedisString(values[i])
+		if _, ok := r.hashes[key][field]; !ok {
+			added++
+		}
+		r.hashes[key][field] = fakeRedisString(values[i+1])
+	}
+	return redis.NewIntResult(added, nil)
+}
+
+// LRange supports the whole-list form, LRange(ctx, key, 0, -1), only.
+func (r *fakeRedis) LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return redis.NewStringSliceResult(append([]string(nil), r.lists[key]...), nil)
+}
+
+// LRem supports a positive count only.
+func (r *fakeRedis) LRem(ctx context.Context, key string, count int64, value interface{}) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target := fakeRedisString(value)
+	var kept []string
+	var removed int64
+	for _, item := range r.lists[key] {
+		if item == target && removed < count {
+			removed++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	r.lists[key] = kept
+	return redis.NewIntResult(removed, nil)
+}
+
+// popList removes and returns everything pushed to key so far.
+func (r *fakeRedis) popList(key string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := r.lists[key]
+	delete(r.lists, key)
+	return values
+}
+
+// popPublished removes and returns everything published to channel so far.
+func (r *fakeRedis) popPublished(channel string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	messages := r.published[channel]
+	delete(r.published, channel)
+	return messages
+}
+
+// popPoppitCommands decodes and removes the commands pushed to a Poppit list.
+func (r *fakeRedis) popPoppitCommands(t *testing.T, list string) []PoppitCommand {
+	t.Helper()
+	var commands []PoppitCommand
+	for _, payload := range r.popList(list) {
+		var cmd PoppitCommand
+		if err := json.Unmarshal([]byte(payload), &cmd); err != nil {
+			t.Fatalf("Invalid Poppit command %q: %v", payload, err)
+		}
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+// fakeSlackMessage is a message sent with PostMessage.  Blocks are not
+// recorded as slack-go keeps them out of the form values.
+type fakeSlackMessage struct {
+	Channel string
+	Text    string
+}
+
+// fakeSlack is an in-memory SlackAPI.  Conversation history and users are
+// whatever the test puts in history and users.
+type fakeSlack struct {
+	mu           sync.Mutex
+	openedViews  []slack.ModalViewRequest
+	updatedViews []slack.ModalViewRequest
+	posted       []fakeSlackMessage
+	history      []slack.Message
+	users        map[string]*slack.User
+	files        map[string]string
+	viewCount    int
+	historyCalls int
+	// openViewErr, when set, is returned by OpenView
+	openViewErr error
+	// historyErrs are returned by GetConversationHistory for their channel
+	historyErrs map[string]error
+	// permalinkErr, when set, is returned by GetPermalink
+	permalinkErr error
+}
+
+func newFakeSlack() *fakeSlack {
+	return &fakeSlack{}
+}
+
+func (s *fakeSlack) OpenView(triggerID string, view slack.ModalViewRequest) (*slack.ViewResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.openViewErr != nil {
+		return nil, s.openViewErr
+	}
+	s.openedViews = append(s.openedViews, view)
+	s.viewCount++
+	resp := &slack.ViewResponse{}
+	resp.ID = fmt.Sprintf("V%d", s.viewCount)
+	resp.Hash = fmt.Sprintf("hash-%d", s.viewCount)
+	return resp, nil
+}
+
+func (s *fakeSlack) UpdateView(view slack.ModalViewRequest, externalID, hash, viewID string) (*slack.ViewResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updatedViews = append(s.updatedViews, view)
+	resp := &slack.ViewResponse{}
+	resp.ID = viewID
+	return resp, nil
+}
+
+func (s *fakeSlack) PostMessage(channelID string, options ...slack.MsgOption) (string, string, error) {
+	_, values, err := slack.UnsafeApplyMsgOptions("", channelID, "", options...)
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posted = append(s.posted, fakeSlackMessage{
+		Channel: channelID,
+		Text:    values.Get("text"),
+	})
+	return channelID, fmt.Sprintf("1700000000.%06d", len(s.posted)), nil
+}
+
+// GetConversationHistory returns the channel's message at params.Latest when
+// it is set, otherwise its most recent messages up to params.Limit.  Messages
+// without a channel are in every channel.
+func (s *fakeSlack) GetConversationHistory(params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.historyCalls++
+	if err := s.historyErrs[params.ChannelID]; err != nil {
+		return nil, err
+	}
+
+	resp := &slack.GetConversationHistoryResponse{}
+	for _, message := range s.history {
+		if message.Channel != "" && message.Channel != params.ChannelID {
+			continue
+		}
+		if params.Latest != "" && message.Timestamp != params.Latest {
+			continue
+		}
+		if params.Limit > 0 && len(resp.Messages) >= params.Limit {
+			break
+		}
+		resp.Messages = append(resp.Messages, message)
+	}
+	return resp, nil
+}
+
+// GetConversationReplies returns the message at params.Timestamp and the
+// messages in its thread, in history order, in a single page.
+func (s *fakeSlack) GetConversationReplies(params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []slack.Message
+	for _, message := range s.history {
+		if message.Channel != "" && message.Channel != params.ChannelID {
+			continue
+		}
+		if message.Timestamp == params.Timestamp || message.ThreadTimestamp == params.Timestamp {
+			messages = append(messages, message)
+		}
+	}
+	return messages, false, "", nil
+}
+
+func (s *fakeSlack) GetPermalink(params *slack.PermalinkParameters) (string, error) {
+	if s.permalinkErr != nil {
+		return "", s.permalinkErr
+	}
+	return fmt.Sprintf("https://example.slack.com/archives/%s/p%s", params.Channel, strings.ReplaceAll(params.Ts, ".", "")), nil
+}
+
+func (s *fakeSlack) GetUserInfo(user string) (*slack.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[user]; ok {
+		return u, nil
+	}
+	return nil, errors.New("user_not_found")
+}
+
+// GetFileContext writes the content the test put in files for downloadURL.
+func (s *fakeSlack) GetFileContext(ctx context.Context, downloadURL string, writer io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.files[downloadURL]
+	if !ok {
+		return errors.New("file_not_found")
+	}
+	_, err := io.WriteString(writer, content)
+	return err
+}
+
+// addConfirmation puts a SlackLiner confirmation into the channel history, as
+// SlackLiner would when it posts it, and returns its timestamp.
+func (s *fakeSlack) addConfirmation(msg SlackLinerMessage) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts := fmt.Sprintf("1700000100.%06d", len(s.history)+1)
+	eventType, _ := msg.Metadata["event_type"].(string)
+	eventPayload, _ := msg.Metadata["event_payload"].(map[string]interface{})
+
+	message := slack.Message{}
+	message.Channel = msg.Channel
+	message.Timestamp = ts
+	message.Text = msg.Text
+	message.Metadata = slack.SlackMetadata{EventType: eventType, EventPayload: eventPayload}
+
+	// Newest first, like conversations.history
+	s.history = append([]slack.Message{message}, s.history...)
+	return ts
+}
+
+// summariserOutputFor builds the output of issue-summariser for a title
+// generation command: the given title, with the input message echoed back as
+// the prompt, as the agent does.
+func summariserOutputFor(t *testing.T, cmd PoppitCommand, title string) string {
+	t.Helper()
+
+	args, err := splitShellWords(cmd.Commands[0])
+	if err != nil || len(args) < 2 || args[0] != "issue-summariser" {
+		t.Fatalf("Expected an issue-summariser command, got %q (%v)", cmd.Commands[0], err)
+	}
+	output, err := json.Marshal(TitleGenerationOutput{Version: 2, Title: title, Prompt: args[len(args)-1]})
+	if err != nil {
+		t.Fatalf("Error marshaling summariser output: %v", err)
+	}
+	return poppitOutputFor(t, cmd, string(output))
+}
+
+// poppitOutputFor builds the output Poppit would publish after running cmd.
+func poppitOutputFor(t *testing.T, cmd PoppitCommand, output string) string {
+	t.Helper()
+
+	// Metadata survives a JSON round trip through Poppit
+	metadataJSON, err := json.Marshal(cmd.Metadata)
+	if err != nil {
+		t.Fatalf("Error marshaling metadata: %v", err)
+	}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+		t.Fatalf("Error unmarshaling metadata: %v", err)
+	}
+
+	payload, err := json.Marshal(PoppitOutput{
+		Metadata: metadata,
+		Type:     cmd.Type,
+		Command:  cmd.Commands[0],
+		Output:   output,
+	})
+	if err != nil {
+		t.Fatalf("Error marshaling Poppit output: %v", err)
+	}
+	return string(payload)
+}
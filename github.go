@@ -7,8 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-
-	"github.com/redis/go-redis/v9"
+	"text/template"
 )
 
 // parseRepoFullName parses the repository parameter and returns the full "org/repo" format.
@@ -21,26 +20,50 @@ func parseRepoFullName(repo string, configOrg string) string {
 	return fmt.Sprintf("%s/%s", configOrg, repo)
 }
 
-func createGitHubIssue(ctx context.Context, rdb *redis.Client, repo, title, description string, assignToCopilot, addToProject, sanitiseIssue bool, username string, config Config) error {
+func createGitHubIssue(ctx context.Context, rdb RedisClient, req IssueRequest, config Config) error {
 	// Parse org and repo from the repo parameter
-	repoFullName := parseRepoFullName(repo, config.GitHubOrg)
+	repoFullName := parseRepoFullName(req.Repo, config.GitHubOrg)
+
+	if err := validateRepoFullName(repoFullName); err != nil {
+		return err
+	}
 
-	// Build the gh command with proper escaping
-	// Escape single quotes in title and description
-	escapedTitle := strings.ReplaceAll(title, `'`, `'\''`)
-	ghCmd := fmt.Sprintf("gh issue create --repo %s --title '%s'", repoFullName, escapedTitle)
+	// Build the gh command; every argument is quoted by the command builder
+	ghCmd := newShellCommand("gh", "issue", "create").
+		Flag("--repo", repoFullName).
+		Flag("--title", req.Title)
 
-	if description != "" {
-		escapedDesc := strings.ReplaceAll(description, `'`, `'\''`)
-		ghCmd = fmt.Sprintf("%s --body '%s'", ghCmd, escapedDesc)
+	// Sign the body with the Slack requester so it is visible on GitHub, and
+	// link back to the message for issues created from one
+	footer := requestedByFooter(req.GitHubLogin, req.Username)
+	if source := sourceFooter(ctx, req, config); source != "" {
+		footer = strings.TrimSpace(source + "\n\n" + footer)
+	}
+	body := appendFooter(req.issueBody(), footer)
+	if body != "" {
+		ghCmd.Flag("--body", body)
 	}
 
 	// Defer Copilot assignment if both sanitisation and copilot assignment are requested
-	deferCopilotAssignment := assignToCopilot && sanitiseIssue
+	deferCopilotAssignment := req.AssignToCopilot && req.SanitiseIssue
 
 	// Only assign Copilot immediately if not deferring
-	if assignToCopilot && !deferCopilotAssignment {
-		ghCmd = fmt.Sprintf("%s --assignee @copilot", ghCmd)
+	if req.AssignToCopilot && !deferCopilotAssignment {
+		ghCmd.Flag("--assignee", "@copilot")
+	}
+
+	for _, label := range req.Labels {
+		ghCmd.Flag("--label", label)
+	}
+	assignees := req.Assignees
+	if req.AssignToMe && req.GitHubLogin != "" && !containsFold(assignees, req.GitHubLogin) {
+		assignees = append(assignees, req.GitHubLogin)
+	}
+	for _, assignee := range assignees {
+		ghCmd.Flag("--assignee", assignee)
+	}
+	if req.Milestone != "" {
+		ghCmd.Flag("--milestone", req.Milestone)
 	}
 
 	// Create Poppit command message with metadata
@@ -49,41 +72,91 @@ func createGitHubIssue(ctx context.Context, rdb *redis.Client, repo, title, desc
 		Branch:   "refs/heads/main",
 		Type:     "slash-vibe-issue",
 		Dir:      config.WorkingDir,
-		Commands: []string{ghCmd},
+		Commands: []string{ghCmd.String()},
 		Metadata: map[string]interface{}{
 			"repo":                   repoFullName,
-			"title":                  title,
-			"username":               username,
-			"addToProject":           addToProject,
-			"assignedToCopilot":      assignToCopilot && !deferCopilotAssignment,
-			"sanitiseIssue":          sanitiseIssue,
+			"title":                  req.Title,
+			"description":            req.Description,
+			"username":               req.Username,
+			"user_id":                req.UserID,
+			"addToProject":           req.AddToProject,
+			"assignedToCopilot":      req.AssignToCopilot && !deferCopilotAssignment,
+			"sanitiseIssue":          req.SanitiseIssue,
 			"deferCopilotAssignment": deferCopilotAssignment,
+			"labels":                 req.Labels,
+			"assignees":              req.Assignees,
+			"milestone":              req.Milestone,
+			"assignToMe":             req.AssignToMe,
+			"github_login":           req.GitHubLogin,
+			"source_channel":         req.SourceChannel,
+			"source_ts":              req.SourceTs,
+			"source_permalink":       req.SourcePermalink,
+			"thread":                 req.Thread,
+			"attachments":            req.Attachments,
 		},
 	}
 
-	payload, err := json.Marshal(poppitCmd)
-	if err != nil {
-		return fmt.Errorf("failed to marshal Poppit command: %v", err)
+	if err := pushPoppitCommand(ctx, rdb, config.RedisPoppitList, poppitCmd); err != nil {
+		return err
 	}
 
-	// Push command to Poppit list
-	err = rdb.RPush(ctx, config.RedisPoppitList, payload).Err()
+	return nil
+}
+
+// issueBody is the description followed by the sections added to it: the
+// Slack thread and the attachments.  Footers are added separately.
+func (req IssueRequest) issueBody() string {
+	return withAttachments(withThread(req.Description, req.Thread), req.Attachments)
+}
+
+// sourceFooterData is what the ISSUE_SOURCE_FOOTER template can use.
+type sourceFooterData struct {
+	Permalink string
+	ChannelID string
+	Username  string
+}
+
+// sourceFooter renders ISSUE_SOURCE_FOOTER for an issue created from a
+// message, or returns "" for other issues.  A template that fails to render
+// falls back to a plain link.
+func sourceFooter(ctx context.Context, req IssueRequest, config Config) string {
+	if req.SourcePermalink == "" {
+		return ""
+	}
+	footer, err := renderSourceFooter(config.IssueSourceFooter, sourceFooterData{
+		Permalink: req.SourcePermalink,
+		ChannelID: req.SourceChannel,
+		Username:  req.Username,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to push command to Poppit: %v", err)
+		WarnContext(ctx, "Error rendering ISSUE_SOURCE_FOOTER, using a plain link: %v", err)
+		return "Source: " + req.SourcePermalink
 	}
+	return strings.TrimSpace(footer)
+}
 
-	return nil
+func renderSourceFooter(text string, data sourceFooterData) (string, error) {
+	tmpl, err := template.New("ISSUE_SOURCE_FOOTER").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
 }
 
-func addIssueToProject(ctx context.Context, rdb *redis.Client, issueURL string, config Config) error {
+func addIssueToProject(ctx context.Context, rdb RedisClient, issueURL, userID string, config Config) error {
 	// Validate issue URL format
-	if !strings.HasPrefix(issueURL, "https://github.com/") || !strings.Contains(issueURL, "/issues/") {
-		return fmt.Errorf("invalid issue URL format: %s", issueURL)
+	if err := validateIssueURL(issueURL); err != nil {
+		return err
 	}
 
 	// Build the gh command to add issue to project
-	ghCmd := fmt.Sprintf("gh project item-add %s --owner %s --url %s",
-		config.ProjectID, config.ProjectOrg, issueURL)
+	ghCmd := newShellCommand("gh", "project", "item-add", config.ProjectID).
+		Flag("--owner", config.ProjectOrg).
+		Flag("--url", issueURL)
 
 	// Extract repo from the issue URL for consistency
 	// URL format: https://github.com/org/repo/issues/number
@@ -99,25 +172,40 @@ func addIssueToProject(ctx context.Context, rdb *redis.Client, issueURL string,
 		Branch:   "refs/heads/main",
 		Type:     "slash-vibe-issue-project",
 		Dir:      config.WorkingDir,
-		Commands: []string{ghCmd},
+		Commands: []string{ghCmd.String()},
 		Metadata: map[string]interface{}{
 			"issueURL": issueURL,
+			"user_id":  userID,
 		},
 	}
 
-	payload, err := json.Marshal(poppitCmd)
-	if err != nil {
-		return fmt.Errorf("failed to marshal Poppit command: %v", err)
+	if err := pushPoppitCommand(ctx, rdb, config.RedisPoppitList, poppitCmd); err != nil {
+		return err
 	}
 
-	// Push command to Poppit list
-	err = rdb.RPush(ctx, config.RedisPoppitList, payload).Err()
-	if err != nil {
-		return fmt.Errorf("failed to push command to Poppit: %v", err)
+	DebugContext(ctx, "Project assignment command sent to Poppit for issue: %s", issueURL)
+	return nil
+}
+
+// repoFromIssueURL returns the "org/repo" part of an issue URL
+// (https://github.com/org/repo/issues/number), or "" if it has none.
+func repoFromIssueURL(issueURL string) string {
+	parts := strings.Split(issueURL, "/")
+	if len(parts) >= 5 {
+		return parts[3] + "/" + parts[4]
 	}
+	return ""
+}
 
-	Debug("Project assignment command sent to Poppit for issue: %s", issueURL)
-	return nil
+// containsFold reports whether values contains value, ignoring case as GitHub
+// does for logins.
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
 }
 
 func extractIssueURL(output string) string {
@@ -150,61 +238,93 @@ func extractIssueNumber(issueURL string) int {
 
 // buildConfirmationMessage constructs the SlackLinerMessage for a GitHub issue creation event.
 // It is shared by sendConfirmation (Redis) and sendConfirmationHTTP (HTTP) to avoid duplication.
-func buildConfirmationMessage(repo, title, username, issueURL string, assignedToCopilot bool, config Config) SlackLinerMessage {
-	repoFullName := parseRepoFullName(repo, config.GitHubOrg)
+func buildConfirmationMessage(issue IssueConfirmation, config Config) SlackLinerMessage {
+	repoFullName := parseRepoFullName(issue.Repo, config.GitHubOrg)
+
+	requester := "@" + issue.Username
+	if issue.GitHubLogin != "" {
+		requester += fmt.Sprintf(" (GitHub: %s)", issue.GitHubLogin)
+	}
+
+	message := fmt.Sprintf("✅ *GitHub Issue Created by %s*\n\n*Repository:* %s\n*Title:* %s\n*URL:* %s",
+		requester, repoFullName, issue.Title, issue.IssueURL)
+
+	if len(issue.Labels) > 0 {
+		message += fmt.Sprintf("\n*Labels:* %s", strings.Join(issue.Labels, ", "))
+	}
+	if len(issue.Assignees) > 0 {
+		message += fmt.Sprintf("\n*Assignees:* %s", strings.Join(issue.Assignees, ", "))
+	}
+	if issue.Milestone != "" {
+		message += fmt.Sprintf("\n*Milestone:* %s", issue.Milestone)
+	}
 
-	message := fmt.Sprintf("✅ *GitHub Issue Created by @%s*\n\n*Repository:* %s\n*Title:* %s\n*URL:* %s",
-		username, repoFullName, title, issueURL)
+	issueNumber := extractIssueNumber(issue.IssueURL)
 
-	issueNumber := extractIssueNumber(issueURL)
+	eventPayload := map[string]interface{}{
+		"username":          issue.Username,
+		"title":             issue.Title,
+		"issue_number":      issueNumber,
+		"issue_url":         issue.IssueURL,
+		"repository":        repoFullName,
+		"assignedToCopilot": issue.AssignedToCopilot,
+	}
+	if len(issue.Labels) > 0 {
+		eventPayload["labels"] = issue.Labels
+	}
+	if len(issue.Assignees) > 0 {
+		eventPayload["assignees"] = issue.Assignees
+	}
+	if issue.Milestone != "" {
+		eventPayload["milestone"] = issue.Milestone
+	}
+	if issue.GitHubLogin != "" {
+		eventPayload["github_login"] = issue.GitHubLogin
+	}
+	if issue.CorrelationID != "" {
+		eventPayload[correlationIDKey] = issue.CorrelationID
+	}
 
 	metadata := map[string]interface{}{
-		"event_type": issueCreatedEventType,
-		"event_payload": map[string]interface{}{
-			"username":          username,
-			"title":             title,
-			"issue_number":      issueNumber,
-			"issue_url":         issueURL,
-			"repository":        repoFullName,
-			"assignedToCopilot": assignedToCopilot,
-		},
+		"event_type":    issueCreatedEventType,
+		"event_payload": eventPayload,
 	}
 
+	channel, ttl := routeConfirmation(issue, repoFullName, config)
 	return SlackLinerMessage{
-		Channel:  config.ConfirmationChannelID,
+		Channel:  channel,
 		Text:     message,
-		TTL:      config.ConfirmationTTL,
+		TTL:      ttl,
 		Metadata: metadata,
 	}
 }
 
-func sendConfirmation(ctx context.Context, rdb *redis.Client, repo, title, username, issueURL string, assignedToCopilot bool, config Config) {
-	slackLinerMsg := buildConfirmationMessage(repo, title, username, issueURL, assignedToCopilot, config)
+func sendConfirmation(ctx context.Context, rdb RedisClient, issue IssueConfirmation, config Config) error {
+	slackLinerMsg := buildConfirmationMessage(issue, config)
 
 	payload, err := json.Marshal(slackLinerMsg)
 	if err != nil {
-		Error("Error marshaling SlackLiner message: %v", err)
-		return
+		return fmt.Errorf("error marshaling SlackLiner message: %v", err)
 	}
 
 	err = rdb.RPush(ctx, config.RedisSlackLinerList, payload).Err()
 	if err != nil {
-		Error("Error pushing to SlackLiner list: %v", err)
-		return
+		return fmt.Errorf("error pushing to SlackLiner list: %v", err)
 	}
 
-	Debug("Confirmation message sent to SlackLiner for issue: %s", issueURL)
+	DebugContext(ctx, "Confirmation message sent to SlackLiner for issue: %s", issue.IssueURL)
+	return nil
 }
 
 // sendConfirmationHTTP sends the confirmation message via the SlackLiner HTTP API and returns
 // the channel ID and message timestamp from the response.  This allows the caller to
 // immediately react to the posted message without having to search for it later.
-func sendConfirmationHTTP(ctx context.Context, repo, title, username, issueURL string, assignedToCopilot bool, config Config) (channelID, ts string, err error) {
+func sendConfirmationHTTP(ctx context.Context, issue IssueConfirmation, config Config) (channelID, ts string, err error) {
 	if config.SlackLinerURL == "" {
 		return "", "", fmt.Errorf("SlackLiner URL not configured")
 	}
 
-	slackLinerMsg := buildConfirmationMessage(repo, title, username, issueURL, assignedToCopilot, config)
+	slackLinerMsg := buildConfirmationMessage(issue, config)
 
 	payload, err := json.Marshal(slackLinerMsg)
 	if err != nil {
@@ -218,7 +338,7 @@ func sendConfirmationHTTP(ctx context.Context, repo, title, username, issueURL s
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := outboundHTTPClient.Do(req)
 	if err != nil {
 		return "", "", fmt.Errorf("error sending HTTP request to SlackLiner: %v", err)
 	}
@@ -233,16 +353,43 @@ func sendConfirmationHTTP(ctx context.Context, repo, title, username, issueURL s
 		return "", "", fmt.Errorf("error decoding SlackLiner response: %v", err)
 	}
 
-	Debug("Confirmation message sent via SlackLiner HTTP for issue: %s (channel=%s, ts=%s)", issueURL, slResp.Channel, slResp.Ts)
+	DebugContext(ctx, "Confirmation message sent via SlackLiner HTTP for issue: %s (channel=%s, ts=%s)", issue.IssueURL, slResp.Channel, slResp.Ts)
 	return slResp.Channel, slResp.Ts, nil
 }
 
-func assignIssueToCopilot(ctx context.Context, rdb *redis.Client, issueURL, repo string, config Config) error {
+// sendIndexedConfirmation sends the confirmation via the SlackLiner HTTP API and
+// records the returned message location in the Redis issue index so webhook and
+// sanitisation events can find it without scanning channel history.
+func sendIndexedConfirmation(ctx context.Context, rdb RedisClient, issue IssueConfirmation, config Config) (channelID, ts string, err error) {
+	channelID, ts, err = sendConfirmationHTTP(ctx, issue, config)
+	if err != nil {
+		return "", "", err
+	}
+
+	if channelID != "" && ts != "" {
+		if err := storeIssueMessage(ctx, rdb, issue.IssueURL, channelID, ts, config); err != nil {
+			WarnContext(ctx, "Error indexing confirmation message: %v", err)
+		}
+	}
+
+	return channelID, ts, nil
+}
+
+func assignIssueToCopilot(ctx context.Context, rdb RedisClient, issueURL, repo, userID string, config Config) error {
 	// Parse the repository to get full org/repo format
 	repoFullName := parseRepoFullName(repo, config.GitHubOrg)
 
+	if err := validateRepoFullName(repoFullName); err != nil {
+		return err
+	}
+	if err := validateIssueURL(issueURL); err != nil {
+		return err
+	}
+
 	// Build the gh command to assign issue to copilot
-	ghCmd := fmt.Sprintf("gh issue edit --add-assignee=\"@copilot\" %s", issueURL)
+	ghCmd := newShellCommand("gh", "issue", "edit").
+		Flag("--add-assignee", "@copilot").
+		Arg(issueURL)
 
 	// Create Poppit command message
 	poppitCmd := PoppitCommand{
@@ -250,35 +397,42 @@ func assignIssueToCopilot(ctx context.Context, rdb *redis.Client, issueURL, repo
 		Branch:   "refs/heads/main",
 		Type:     "slash-vibe-issue-assign-copilot",
 		Dir:      config.WorkingDir,
-		Commands: []string{ghCmd},
+		Commands: []string{ghCmd.String()},
 		Metadata: map[string]interface{}{
-			"issueURL": issueURL,
+			"issueURL":   issueURL,
+			"repository": repoFullName,
+			"user_id":    userID,
 		},
 	}
 
-	payload, err := json.Marshal(poppitCmd)
-	if err != nil {
-		return fmt.Errorf("failed to marshal Poppit command: %v", err)
-	}
-
-	// Push command to Poppit list
-	err = rdb.RPush(ctx, config.RedisPoppitList, payload).Err()
-	if err != nil {
-		return fmt.Errorf("failed to push command to Poppit: %v", err)
+	if err := pushPoppitCommand(ctx, rdb, config.RedisPoppitList, poppitCmd); err != nil {
+		return err
 	}
 
-	Debug("Copilot assignment command sent to Poppit for issue: %s", issueURL)
+	DebugContext(ctx, "Copilot assignment command sent to Poppit for issue: %s", issueURL)
 	return nil
 }
 
-func assignIssueToJules(ctx context.Context, rdb *redis.Client, issueURL, repo string, config Config) error {
+func assignIssueToJules(ctx context.Context, rdb RedisClient, issueURL, repo, userID string, config Config) error {
 	// Parse the repository to get full org/repo format
 	repoFullName := parseRepoFullName(repo, config.GitHubOrg)
 
-	labelCmd := fmt.Sprintf("gh label create \"%s\" --color \"6E5DD0\" --force --repo %s", issueJulesLabel, repoFullName)
+	if err := validateRepoFullName(repoFullName); err != nil {
+		return err
+	}
+	if err := validateIssueURL(issueURL); err != nil {
+		return err
+	}
+
+	labelCmd := newShellCommand("gh", "label", "create", issueJulesLabel).
+		Flag("--color", "6E5DD0").
+		Arg("--force").
+		Flag("--repo", repoFullName)
 
 	// Build the gh command to add jules label to issue
-	ghCmd := fmt.Sprintf("gh issue edit --add-label %q %s", issueJulesLabel, issueURL)
+	ghCmd := newShellCommand("gh", "issue", "edit").
+		Flag("--add-label", issueJulesLabel).
+		Arg(issueURL)
 
 	// Create Poppit command message
 	poppitCmd := PoppitCommand{
@@ -286,31 +440,33 @@ func assignIssueToJules(ctx context.Context, rdb *redis.Client, issueURL, repo s
 		Branch:   "refs/heads/main",
 		Type:     "slash-vibe-issue-assign-jules",
 		Dir:      config.WorkingDir,
-		Commands: []string{labelCmd, ghCmd},
+		Commands: []string{labelCmd.String(), ghCmd.String()},
 		Metadata: map[string]interface{}{
-			"issueURL": issueURL,
+			"issueURL":   issueURL,
+			"repository": repoFullName,
+			"user_id":    userID,
 		},
 	}
 
-	payload, err := json.Marshal(poppitCmd)
-	if err != nil {
-		return fmt.Errorf("failed to marshal Poppit command: %v", err)
-	}
-
-	// Push command to Poppit list
-	err = rdb.RPush(ctx, config.RedisPoppitList, payload).Err()
-	if err != nil {
-		return fmt.Errorf("failed to push command to Poppit: %v", err)
+	if err := pushPoppitCommand(ctx, rdb, config.RedisPoppitList, poppitCmd); err != nil {
+		return err
 	}
 
-	Debug("Jules assignment command sent to Poppit for issue: %s", issueURL)
+	DebugContext(ctx, "Jules assignment command sent to Poppit for issue: %s", issueURL)
 	return nil
 }
 
-func sanitiseIssue(ctx context.Context, rdb *redis.Client, issueURL, repo string, deferCopilotAssignment bool, config Config) error {
+func sanitiseIssue(ctx context.Context, rdb RedisClient, issueURL, repo, userID string, deferCopilotAssignment bool, config Config) error {
 	// Parse the repository to get full org/repo format
 	repoFullName := parseRepoFullName(repo, config.GitHubOrg)
 
+	if err := validateRepoFullName(repoFullName); err != nil {
+		return err
+	}
+	if err := validateIssueURL(issueURL); err != nil {
+		return err
+	}
+
 	// Extract repository name without org for directory construction
 	parts := strings.Split(repoFullName, "/")
 	var repoName string
@@ -325,7 +481,7 @@ func sanitiseIssue(ctx context.Context, rdb *redis.Client, issueURL, repo string
 	repoWorkingDir := fmt.Sprintf("%s/%s", config.WorkingDir, repoName)
 
 	// Build the issue-sanitiser command
-	issueCmd := fmt.Sprintf("issue-sanitiser %s", issueURL)
+	issueCmd := newShellCommand("issue-sanitiser", issueURL)
 
 	// Create Poppit command message
 	poppitCmd := PoppitCommand{
@@ -333,25 +489,20 @@ func sanitiseIssue(ctx context.Context, rdb *redis.Client, issueURL, repo string
 		Branch:   "refs/heads/main",
 		Type:     "slash-vibe-issue-sanitise",
 		Dir:      repoWorkingDir,
-		Commands: []string{issueCmd},
+		Commands: []string{issueCmd.String()},
 		Metadata: map[string]interface{}{
 			"issueURL":               issueURL,
 			"deferCopilotAssignment": deferCopilotAssignment,
 			"repository":             repoFullName,
+			"user_id":                userID,
 		},
 	}
 
-	payload, err := json.Marshal(poppitCmd)
-	if err != nil {
-		return fmt.Errorf("failed to marshal Poppit command: %v", err)
-	}
-
 	// Push command to Poppit builder list for long-running operations
-	err = rdb.RPush(ctx, config.RedisPoppitBuilderList, payload).Err()
-	if err != nil {
-		return fmt.Errorf("failed to push command to Poppit builder queue: %v", err)
+	if err := pushPoppitCommand(ctx, rdb, config.RedisPoppitBuilderList, poppitCmd); err != nil {
+		return err
 	}
 
-	Debug("Issue sanitisation command sent to Poppit builder queue for issue: %s", issueURL)
+	DebugContext(ctx, "Issue sanitisation command sent to Poppit builder queue for issue: %s", issueURL)
 	return nil
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// githubLoginPattern matches valid GitHub usernames: alphanumerics and single
+// hyphens, not starting with a hyphen, at most 39 characters.
+var githubLoginPattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9]|-[A-Za-z0-9]){0,38}$`)
+
+// normaliseGitHubLogin strips a leading "@" and validates the login.
+func normaliseGitHubLogin(login string) (string, error) {
+	login = strings.TrimPrefix(strings.TrimSpace(login), "@")
+	if !githubLoginPattern.MatchString(login) {
+		return "", fmt.Errorf("invalid GitHub login %q", login)
+	}
+	return login, nil
+}
+
+// linkGitHubLogin records the GitHub login for a Slack user.
+func linkGitHubLogin(ctx context.Context, rdb RedisClient, slackUserID, login string, config Config) error {
+	if err := rdb.HSet(ctx, config.RedisGitHubLoginsKey, slackUserID, login).Err(); err != nil {
+		return fmt.Errorf("failed to store GitHub login: %v", err)
+	}
+	return nil
+}
+
+// resolveGitHubLogin returns the GitHub login for a Slack user.  Links made
+// with /issue link-github take precedence over the github_logins config
+// section; an empty login and nil error mean the user is not linked.
+func resolveGitHubLogin(ctx context.Context, rdb RedisClient, slackUserID string, config Config) (string, error) {
+	if slackUserID == "" {
+		return "", nil
+	}
+
+	login, err := rdb.HGet(ctx, config.RedisGitHubLoginsKey, slackUserID).Result()
+	if err == nil && login != "" {
+		return login, nil
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		// Fall back to the static mapping rather than failing the request
+		WarnContext(ctx, "Error looking up GitHub login for %s: %v", slackUserID, err)
+	}
+
+	return config.GitHubLogins[slackUserID], nil
+}
+
+// requestedByFooter is appended to issue bodies so the Slack requester is
+// visible on GitHub.  Unlinked users are named by their Slack username without
+// an "@" so no unrelated GitHub user is mentioned.
+func requestedByFooter(githubLogin, slackUsername string) string {
+	if githubLogin != "" {
+		return fmt.Sprintf("Requested by @%s via Slack", githubLogin)
+	}
+	if slackUsername != "" {
+		return fmt.Sprintf("Requested by Slack user %s", slackUsername)
+	}
+	return ""
+}
+
+// appendFooter adds footer to an issue body below a horizontal rule.
+func appendFooter(body, footer string) string {
+	body = strings.TrimRight(body, "\n")
+	switch {
+	case footer == "":
+		return body
+	case strings.TrimSpace(body) == "":
+		return footer
+	}
+	return body + "\n\n---\n" + footer
+}
+
+// slackUserMentionPattern matches an escaped Slack user mention such as
+// <@U123ABC|alice>, capturing the user ID.
+var slackUserMentionPattern = regexp.MustCompile(`^<@([UW][A-Z0-9]+)(?:\|[^>]*)?>$`)
+
+// isGitHubLinkAdmin reports whether a Slack user may link GitHub logins.
+// Nothing proves that a user owns the login they give, so linking is limited
+// to the GITHUB_LINK_ADMINS; otherwise anyone could act as anyone on GitHub.
+func isGitHubLinkAdmin(slackUserID string, config Config) bool {
+	return slackUserID != "" && slices.Contains(config.GitHubLinkAdmins, slackUserID)
+}
+
+// howToLinkGitHub tells a Slack user how their GitHub login can be linked.
+func howToLinkGitHub(slackUserID string, config Config) string {
+	if isGitHubLinkAdmin(slackUserID, config) {
+		return "Use `/issue link-github <login>` to link it."
+	}
+	if len(config.GitHubLinkAdmins) == 0 {
+		return "Ask an administrator to add it to `github_logins` in the config."
+	}
+	admins := make([]string, len(config.GitHubLinkAdmins))
+	for i, admin := range config.GitHubLinkAdmins {
+		admins[i] = "<@" + admin + ">"
+	}
+	return fmt.Sprintf("Ask %s to link it with `/issue link-github @you <login>`.", strings.Join(admins, " or "))
+}
+
+// handleLinkGitHubCommand handles "/issue link-github [@user] [login]".
+// Without arguments it reports the current link; linking is for admins only.
+func handleLinkGitHubCommand(ctx context.Context, rdb RedisClient, cmd SlackCommand, args string, config Config) error {
+	var text string
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+		login, err := resolveGitHubLogin(ctx, rdb, cmd.UserID, config)
+		if err != nil {
+			return err
+		}
+		if login == "" {
+			text = "Your Slack account is not linked to a GitHub login. " + howToLinkGitHub(cmd.UserID, config)
+		} else {
+			text = fmt.Sprintf("Your Slack account is linked to GitHub user *%s*.", login)
+		}
+	case !isGitHubLinkAdmin(cmd.UserID, config):
+		WarnContext(ctx, "Slack user %s is not allowed to link GitHub logins", cmd.UserName)
+		text = "❌ Only GitHub link admins can link accounts. " + howToLinkGitHub(cmd.UserID, config)
+	case len(fields) > 2:
+		text = "❌ Usage: `/issue link-github [@user] <login>`"
+	default:
+		userID, loginArg := cmd.UserID, fields[len(fields)-1]
+		if len(fields) == 2 {
+			match := slackUserMentionPattern.FindStringSubmatch(fields[0])
+			if match == nil {
+				text = fmt.Sprintf("❌ `%s` is not a Slack user mention such as @alice.", fields[0])
+				break
+			}
+			userID = match[1]
+		}
+
+		login, err := normaliseGitHubLogin(loginArg)
+		if err != nil {
+			text = fmt.Sprintf("❌ `%s` is not a valid GitHub login.", loginArg)
+			break
+		}
+		if err := linkGitHubLogin(ctx, rdb, userID, login, config); err != nil {
+			return err
+		}
+		InfoContext(ctx, "Slack user %s linked Slack user %s to GitHub login %s", cmd.UserName, userID, login)
+		if userID == cmd.UserID {
+			text = fmt.Sprintf("✅ Linked your Slack account to GitHub user *%s*.", login)
+		} else {
+			text = fmt.Sprintf("✅ Linked <@%s> to GitHub user *%s*.", userID, login)
+		}
+	}
+
+	return postToResponseURL(ctx, cmd.ResponseURL, SlackResponseMessage{
+		ResponseType: "ephemeral",
+		Text:         text,
+	})
+}
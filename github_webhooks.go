@@ -3,198 +3,189 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/redis/go-redis/v9"
-	"github.com/slack-go/slack"
 )
 
-func subscribeToGitHubWebhooks(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, config Config) {
-	pubsub := rdb.Subscribe(ctx, config.RedisGitHubWebhookChannel)
-	defer pubsub.Close()
-
-	Info("Subscribed to Redis channel: %s", config.RedisGitHubWebhookChannel)
-
-	ch := pubsub.Channel()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case msg := <-ch:
-			if msg == nil {
-				continue
-			}
-			handleGitHubIssueEvent(ctx, rdb, slackClient, msg.Payload, config)
-		}
+func subscribeToGitHubWebhooks(ctx context.Context, rdb *redis.Client, slackClient SlackAPI, config Config) error {
+	handler := func(ctx context.Context, payload string) error {
+		return handleGitHubIssueEvent(ctx, rdb, slackClient, payload, currentConfig())
 	}
+	return consumeChannel(ctx, rdb, config.RedisGitHubWebhookChannel, "github-webhooks", config,
+		withIdempotency(rdb, "github-webhooks", config, gitHubEventKey, handler))
 }
 
-func handleGitHubIssueEvent(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, payload string, config Config) {
+// gitHubEventKey identifies an issue event by its action, issue and the
+// issue's updated_at, which every change moves on.  The assignee or label is
+// added because one change can assign several users or add several labels,
+// each in its own event.  The relay does not forward the X-GitHub-Delivery
+// header, so there is no delivery ID to use instead.
+func gitHubEventKey(payload string) string {
+	var event GitHubWebhookEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil ||
+		event.Action == "" || event.Issue.ID == 0 || event.Issue.UpdatedAt == "" {
+		return payloadKey()(payload)
+	}
+
+	parts := []string{event.Action, strconv.FormatInt(event.Issue.ID, 10), event.Issue.UpdatedAt}
+	if event.Assignee != nil {
+		parts = append(parts, event.Assignee.Login)
+	}
+	if event.Label != nil {
+		parts = append(parts, event.Label.Name)
+	}
+	return strings.Join(parts, ":")
+}
+
+func handleGitHubIssueEvent(ctx context.Context, rdb RedisClient, slackClient SlackAPI, payload string, config Config) error {
 	var event GitHubWebhookEvent
 	if err := json.Unmarshal([]byte(payload), &event); err != nil {
-		Error("Error unmarshaling GitHub webhook event: %v", err)
-		return
+		return fmt.Errorf("error unmarshaling GitHub webhook event: %v", err)
 	}
 
 	// Handle issue closed events
 	if event.Action == "closed" {
-		handleIssueClosed(ctx, rdb, slackClient, event, config)
-		return
+		return handleIssueClosed(ctx, rdb, slackClient, event, config)
 	}
 
 	// Handle issue assigned events
 	if event.Action == "assigned" {
-		handleIssueAssigned(ctx, rdb, slackClient, event, config)
-		return
+		return handleIssueAssigned(ctx, rdb, slackClient, event, config)
 	}
 
 	// Handle issue labeled events
 	if event.Action == "labeled" {
-		handleIssueLabeled(ctx, rdb, slackClient, event, config)
-		return
+		return handleIssueLabeled(ctx, rdb, slackClient, event, config)
 	}
+
+	ignoreEvent(ctx)
+	return nil
 }
 
-func handleIssueClosed(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, event GitHubWebhookEvent, config Config) {
-	Info("Received issue closed event for issue #%d: %s", event.Issue.Number, event.Issue.Title)
+func handleIssueClosed(ctx context.Context, rdb RedisClient, slackClient SlackAPI, event GitHubWebhookEvent, config Config) error {
+	InfoContext(ctx, "Received issue closed event for issue #%d: %s", event.Issue.Number, event.Issue.Title)
 
 	// Use the html_url from the event payload
 	issueURL := event.Issue.HTMLURL
 	if issueURL == "" {
-		Warn("Missing html_url in issue event")
-		return
-	}
-
-	Debug("Issue URL: %s", issueURL)
-
-	// Search for the message with matching metadata
-	channelID, messageTs, err := findMessageByIssueURL(ctx, slackClient, issueURL, config)
-	if err != nil {
-		Error("Error finding message by issue URL: %v", err)
-		return
-	}
-
-	if channelID == "" || messageTs == "" {
-		Debug("No message found for issue URL: %s", issueURL)
-		return
+		WarnContext(ctx, "Missing html_url in issue event")
+		return nil
 	}
 
-	Debug("Found message for issue %s at channel=%s, ts=%s", issueURL, channelID, messageTs)
+	DebugContext(ctx, "Issue URL: %s", issueURL)
 
-	// Send reaction to SlackLiner
-	err = sendReactionToSlackLiner(ctx, rdb, issueClosedReactionEmoji, channelID, messageTs, config)
-	if err != nil {
-		Error("Error sending reaction: %v", err)
-		return
+	// React and set TTL to 24 hours
+	if err := reactToIssueMessage(ctx, rdb, slackClient, issueURL, issueClosedReactionEmoji, issueClosedTTLSeconds, config); err != nil {
+		return err
 	}
 
-	Debug("Sent %s reaction for message ts=%s", issueClosedReactionEmoji, messageTs)
-
-	// Set TTL to 24 hours
-	err = sendTTLToTimeBomb(ctx, rdb, channelID, messageTs, issueClosedTTLSeconds, config)
-	if err != nil {
-		Error("Error setting TTL: %v", err)
-		return
+	// The follow-up goes last: a redelivery after an error above must not post it twice
+	followUp := fmt.Sprintf("🐱 %s was closed", slackIssueLink(issueURL, repoFromIssueURL(issueURL), event.Issue.Title))
+	if err := postIssueThreadFollowUp(ctx, rdb, issueURL, followUp, config); err != nil {
+		ErrorContext(ctx, "Error posting issue closed follow-up: %v", err)
 	}
-
-	Debug("Set TTL to 24 hours for message ts=%s", messageTs)
+	return nil
 }
 
-func handleIssueAssigned(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, event GitHubWebhookEvent, config Config) {
-	Info("Received issue assigned event for issue #%d: %s", event.Issue.Number, event.Issue.Title)
+func handleIssueAssigned(ctx context.Context, rdb RedisClient, slackClient SlackAPI, event GitHubWebhookEvent, config Config) error {
+	InfoContext(ctx, "Received issue assigned event for issue #%d: %s", event.Issue.Number, event.Issue.Title)
 
 	// Check if assignee data is present
 	if event.Assignee == nil {
-		Warn("No assignee data in event")
-		return
+		WarnContext(ctx, "No assignee data in event")
+		return nil
 	}
 
-	// Check if assignee is Copilot
-	if event.Assignee.Login != copilotAssigneeName {
-		Debug("Assignee is not Copilot: %s", event.Assignee.Login)
-		return
-	}
-
-	Debug("Issue assigned to Copilot")
-
 	// Use the html_url from the event payload
 	issueURL := event.Issue.HTMLURL
 	if issueURL == "" {
-		Warn("Missing html_url in issue event")
-		return
+		WarnContext(ctx, "Missing html_url in issue event")
+		return nil
 	}
 
-	Debug("Issue URL: %s", issueURL)
+	DebugContext(ctx, "Issue URL: %s", issueURL)
 
-	// Search for the message with matching metadata
-	channelID, messageTs, err := findMessageByIssueURL(ctx, slackClient, issueURL, config)
-	if err != nil {
-		Error("Error finding message by issue URL: %v", err)
-		return
-	}
-
-	if channelID == "" || messageTs == "" {
-		Debug("No message found for issue URL: %s", issueURL)
-		return
+	// Check if assignee is Copilot
+	if event.Assignee.Login == copilotAssigneeName {
+		DebugContext(ctx, "Issue assigned to Copilot")
+		if err := reactToIssueMessage(ctx, rdb, slackClient, issueURL, issueAssignedReactionEmoji, 0, config); err != nil {
+			return err
+		}
+	} else {
+		DebugContext(ctx, "Assignee is not Copilot: %s", event.Assignee.Login)
 	}
 
-	Debug("Found message for issue %s at channel=%s, ts=%s", issueURL, channelID, messageTs)
-
-	// Send sparkles reaction to SlackLiner
-	err = sendReactionToSlackLiner(ctx, rdb, issueAssignedReactionEmoji, channelID, messageTs, config)
-	if err != nil {
-		Error("Error sending reaction: %v", err)
-		return
+	// The follow-up goes last: a redelivery after an error above must not post it twice
+	followUp := fmt.Sprintf("👤 %s was assigned to %s", slackIssueLink(issueURL, repoFromIssueURL(issueURL), event.Issue.Title), event.Assignee.Login)
+	if err := postIssueThreadFollowUp(ctx, rdb, issueURL, followUp, config); err != nil {
+		ErrorContext(ctx, "Error posting issue assigned follow-up: %v", err)
 	}
-
-	Debug("Sent sparkles reaction for message ts=%s", messageTs)
+	return nil
 }
 
-func handleIssueLabeled(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, event GitHubWebhookEvent, config Config) {
-	Info("Received issue labeled event for issue #%d: %s", event.Issue.Number, event.Issue.Title)
+func handleIssueLabeled(ctx context.Context, rdb RedisClient, slackClient SlackAPI, event GitHubWebhookEvent, config Config) error {
+	InfoContext(ctx, "Received issue labeled event for issue #%d: %s", event.Issue.Number, event.Issue.Title)
 
 	// Check if label data is present
 	if event.Label == nil {
-		Warn("No label data in event")
-		return
+		WarnContext(ctx, "No label data in event")
+		return nil
 	}
 
 	// Check if label is "jules"
 	if event.Label.Name != issueJulesLabel {
-		Debug("Label is not jules: %s", event.Label.Name)
-		return
+		DebugContext(ctx, "Label is not jules: %s", event.Label.Name)
+		return nil
 	}
 
-	Debug("Issue labeled with jules")
+	DebugContext(ctx, "Issue labeled with jules")
 
 	// Use the html_url from the event payload
 	issueURL := event.Issue.HTMLURL
 	if issueURL == "" {
-		Warn("Missing html_url in issue event")
-		return
+		WarnContext(ctx, "Missing html_url in issue event")
+		return nil
 	}
 
-	Debug("Issue URL: %s", issueURL)
+	DebugContext(ctx, "Issue URL: %s", issueURL)
 
+	return reactToIssueMessage(ctx, rdb, slackClient, issueURL, julesReactionEmoji, 0, config)
+}
+
+// reactToIssueMessage adds a reaction to the confirmation message of
+// issueURL, if there is one, and with a non-zero ttlSeconds has TimeBomb
+// delete the message after that long.
+func reactToIssueMessage(ctx context.Context, rdb RedisClient, slackClient SlackAPI, issueURL, reaction string, ttlSeconds int, config Config) error {
 	// Search for the message with matching metadata
-	channelID, messageTs, err := findMessageByIssueURL(ctx, slackClient, issueURL, config)
+	channelID, messageTs, err := findMessageByIssueURL(ctx, rdb, slackClient, issueURL, config)
 	if err != nil {
-		Error("Error finding message by issue URL: %v", err)
-		return
+		return fmt.Errorf("error finding message by issue URL: %v", err)
 	}
 
 	if channelID == "" || messageTs == "" {
-		Debug("No message found for issue URL: %s", issueURL)
-		return
+		DebugContext(ctx, "No message found for issue URL: %s", issueURL)
+		return nil
 	}
 
-	Debug("Found message for issue %s at channel=%s, ts=%s", issueURL, channelID, messageTs)
+	DebugContext(ctx, "Found message for issue %s at channel=%s, ts=%s", issueURL, channelID, messageTs)
 
-	// Send octopus reaction to SlackLiner
-	err = sendReactionToSlackLiner(ctx, rdb, julesReactionEmoji, channelID, messageTs, config)
-	if err != nil {
-		Error("Error sending reaction: %v", err)
-		return
+	// Send reaction to SlackLiner
+	if err := sendReactionToSlackLiner(ctx, rdb, reaction, channelID, messageTs, config); err != nil {
+		return fmt.Errorf("error sending reaction: %v", err)
+	}
+
+	DebugContext(ctx, "Sent %s reaction for message ts=%s", reaction, messageTs)
+
+	if ttlSeconds == 0 {
+		return nil
+	}
+	if err := sendTTLToTimeBomb(ctx, rdb, channelID, messageTs, ttlSeconds, config); err != nil {
+		return fmt.Errorf("error setting TTL: %v", err)
 	}
 
-	Debug("Sent octopus reaction for message ts=%s", messageTs)
+	DebugContext(ctx, "Set TTL to %ds for message ts=%s", ttlSeconds, messageTs)
+	return nil
 }
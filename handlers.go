@@ -1,14 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/slack-go/slack"
 )
 
+// outboundHTTPTimeout bounds requests to Slack response URLs and SlackLiner,
+// so that a hung endpoint cannot hold up the drain on shutdown
+const outboundHTTPTimeout = 10 * time.Second
+
+var outboundHTTPClient = &http.Client{Timeout: outboundHTTPTimeout}
+
 const (
 	issueClosedReactionEmoji     = "cat2"
 	issueAssignedReactionEmoji   = "sparkles"
@@ -19,25 +27,71 @@ const (
 	issueClosedTTLSeconds        = 86400 // 24 hours
 	issueCreatedEventType        = "issue_created"
 	copilotAssigneeName          = "Copilot"
+	retryFailedCommandActionID   = "retry_failed_command"
+	createIssueAnywayActionID    = "create_issue_anyway"
+	commentOnExistingActionID    = "comment_on_existing_issue"
 )
 
-func findMessageByIssueURL(ctx context.Context, slackClient *slack.Client, issueURL string, config Config) (string, string, error) {
-	// Use the channel ID directly from config
-	if config.ConfirmationChannelID == "" {
+// findMessageByIssueURL locates the confirmation message for issueURL.  The Redis
+// issue index is consulted first; on a miss it falls back to scanning the most
+// recent messages of each channel the confirmation may have been routed to and
+// back-fills the index on a hit.
+func findMessageByIssueURL(ctx context.Context, rdb RedisClient, slackClient SlackAPI, issueURL string, config Config) (string, string, error) {
+	channelID, messageTs, err := lookupIssueMessage(ctx, rdb, issueURL, config)
+	if err != nil {
+		Warn("Issue index lookup failed, falling back to history scan: %v", err)
+	} else if channelID != "" && messageTs != "" {
+		Debug("Found message for issue %s in index", issueURL)
+		return channelID, messageTs, nil
+	}
+
+	channels := confirmationChannels(repoFromIssueURL(issueURL), config)
+	if len(channels) == 0 {
 		return "", "", fmt.Errorf("confirmation channel ID not configured")
 	}
 
-	// Search through recent messages in the confirmation channel
+	// One unreadable channel, e.g. a private one the bot has left, does not
+	// stop the search in the others
+	var failed int
+	var lastErr error
+	for _, channelID := range channels {
+		messageTs, err := findMessageInChannel(slackClient, channelID, issueURL, config)
+		if err != nil {
+			Warn("Error searching channel %s for issue %s: %v", channelID, issueURL, err)
+			failed++
+			lastErr = err
+			continue
+		}
+		if messageTs != "" {
+			// Back-fill the index so the next event for this issue skips the scan
+			if err := storeIssueMessage(ctx, rdb, issueURL, channelID, messageTs, config); err != nil {
+				Warn("Error indexing confirmation message: %v", err)
+			}
+			return channelID, messageTs, nil
+		}
+	}
+
+	if failed == len(channels) {
+		return "", "", lastErr
+	}
+
+	// Message not found in the recent messages
+	return "", "", nil
+}
+
+// findMessageInChannel returns the timestamp of the confirmation message for
+// issueURL among the most recent messages of channelID, or "" if there is none.
+func findMessageInChannel(slackClient SlackAPI, channelID, issueURL string, config Config) (string, error) {
 	// Only search the most recent messages up to the configured limit
 	historyParams := &slack.GetConversationHistoryParameters{
-		ChannelID:          config.ConfirmationChannelID,
+		ChannelID:          channelID,
 		Limit:              config.ConfirmationSearchLimit,
 		IncludeAllMetadata: true,
 	}
 
 	history, err := slackClient.GetConversationHistory(historyParams)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get conversation history: %v", err)
+		return "", fmt.Errorf("failed to get conversation history: %v", err)
 	}
 
 	// Search through messages for matching metadata
@@ -46,25 +100,23 @@ func findMessageByIssueURL(ctx context.Context, slackClient *slack.Client, issue
 			// Check for matching issue URL directly from EventPayload
 			if msgIssueURL, ok := message.Metadata.EventPayload["issue_url"].(string); ok {
 				if msgIssueURL == issueURL {
-					return config.ConfirmationChannelID, message.Timestamp, nil
+					return message.Timestamp, nil
 				}
 			}
 		}
 	}
-
-	// Message not found in the recent messages
-	return "", "", nil
+	return "", nil
 }
 
-func sendReactionToSlackLiner(ctx context.Context, rdb *redis.Client, reaction, channel, ts string, config Config) error {
+func sendReactionToSlackLiner(ctx context.Context, rdb RedisClient, reaction, channel, ts string, config Config) error {
 	return sendOrRemoveReaction(ctx, rdb, reaction, channel, ts, false, config)
 }
 
-func removeReactionFromSlackLiner(ctx context.Context, rdb *redis.Client, reaction, channel, ts string, config Config) error {
+func removeReactionFromSlackLiner(ctx context.Context, rdb RedisClient, reaction, channel, ts string, config Config) error {
 	return sendOrRemoveReaction(ctx, rdb, reaction, channel, ts, true, config)
 }
 
-func sendOrRemoveReaction(ctx context.Context, rdb *redis.Client, reaction, channel, ts string, remove bool, config Config) error {
+func sendOrRemoveReaction(ctx context.Context, rdb RedisClient, reaction, channel, ts string, remove bool, config Config) error {
 	slackReaction := SlackReaction{
 		Reaction: reaction,
 		Channel:  channel,
@@ -91,7 +143,7 @@ func sendOrRemoveReaction(ctx context.Context, rdb *redis.Client, reaction, chan
 	return nil
 }
 
-func sendTTLToTimeBomb(ctx context.Context, rdb *redis.Client, channel, ts string, ttl int, config Config) error {
+func sendTTLToTimeBomb(ctx context.Context, rdb RedisClient, channel, ts string, ttl int, config Config) error {
 	timeBombMsg := TimeBombMessage{
 		Channel: channel,
 		Ts:      ts,
@@ -110,3 +162,34 @@ func sendTTLToTimeBomb(ctx context.Context, rdb *redis.Client, channel, ts strin
 
 	return nil
 }
+
+// postToResponseURL sends msg to a Slack interaction response_url, e.g. to reply
+// ephemerally to a slash command or replace the message a button was clicked in.
+func postToResponseURL(ctx context.Context, responseURL string, msg SlackResponseMessage) error {
+	if responseURL == "" {
+		return fmt.Errorf("response URL is empty")
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response message: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := outboundHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending response message: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("response URL request failed with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
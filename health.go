@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	readinessTimeout     = 2 * time.Second
+	httpShutdownTimeout  = 5 * time.Second
+	healthcheckTimeout   = 3 * time.Second
+	metricsContentType   = "text/plain; version=0.0.4; charset=utf-8"
+	subscriberUpMetric   = "slashvibeissue_subscriber_up"
+	healthcheckReadyPath = "/readyz"
+)
+
+// subscriberStatus tracks which Redis subscriber goroutines are running.
+type subscriberStatus struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func newSubscriberStatus() *subscriberStatus {
+	return &subscriberStatus{running: make(map[string]bool)}
+}
+
+func (s *subscriberStatus) set(name string, running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[name] = running
+}
+
+// stopped returns the names of the subscribers that are no longer running.
+func (s *subscriberStatus) stopped() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for _, name := range sortedKeys(s.running) {
+		if !s.running[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (s *subscriberStatus) write(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s Whether the Redis subscriber is running (1) or has stopped (0).\n# TYPE %s gauge\n", subscriberUpMetric, subscriberUpMetric)
+	for _, name := range sortedKeys(s.running) {
+		up := 0
+		if s.running[name] {
+			up = 1
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", subscriberUpMetric, formatLabels([]string{"subscriber"}, []string{name}), up)
+	}
+}
+
+// newHealthHandler serves /healthz, /readyz and /metrics.  ping checks the
+// Redis connection.
+func newHealthHandler(ping func(ctx context.Context) error, status *subscriberStatus) http.Handler {
+	mux := http.NewServeMux()
+
+	// The process is up if it can answer at all
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		var problems []string
+		if err := ping(ctx); err != nil {
+			problems = append(problems, fmt.Sprintf("redis: %v", err))
+		}
+		for _, name := range status.stopped() {
+			problems = append(problems, fmt.Sprintf("subscriber %s is not running", name))
+		}
+
+		if len(problems) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, strings.Join(problems, "\n"))
+			return
+		}
+		fmt.Fprintln(w, "ready")
+	})
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metricsContentType)
+		writeMetrics(w, status)
+	})
+
+	return mux
+}
+
+// startHTTPServer serves handler on addr until ctx is cancelled.
+func startHTTPServer(ctx context.Context, addr string, handler http.Handler) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		Info("Serving health and metrics endpoints on %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			Error("Health and metrics server stopped: %v", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			Warn("Error shutting down health and metrics server: %v", err)
+		}
+	}()
+}
+
+// healthcheckURL returns the readiness URL of the local HTTP server.  An
+// address without a host, such as ":8080", is reached on the loopback interface.
+func healthcheckURL(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	return "http://" + addr + healthcheckReadyPath
+}
+
+// runHealthcheck implements "slashvibeissue healthcheck", for container health
+// checks in images without curl or wget.  It returns the process exit code.
+func runHealthcheck(config Config) int {
+	client := &http.Client{Timeout: healthcheckTimeout}
+	resp, err := client.Get(healthcheckURL(config.HTTPAddr))
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Print(string(body))
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventKeyFunc derives the idempotency key for a raw payload.
+type eventKeyFunc func(payload string) string
+
+// payloadKey returns an eventKeyFunc that builds the key from the given dotted
+// JSON paths (e.g. "view.id").  If any path is missing the SHA-256 of the whole
+// payload is used instead, which still catches verbatim double-publishes.
+func payloadKey(paths ...string) eventKeyFunc {
+	return func(payload string) string {
+		if len(paths) > 0 {
+			var data map[string]interface{}
+			if err := json.Unmarshal([]byte(payload), &data); err == nil {
+				parts := make([]string, 0, len(paths))
+				for _, path := range paths {
+					value := lookupJSONPath(data, path)
+					if value == "" {
+						break
+					}
+					parts = append(parts, value)
+				}
+				if len(parts) == len(paths) {
+					return strings.Join(parts, ":")
+				}
+			}
+		}
+
+		sum := sha256.Sum256([]byte(payload))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+}
+
+// lookupJSONPath returns the string or number at a dotted path in decoded JSON.
+func lookupJSONPath(data map[string]interface{}, path string) string {
+	var current interface{} = data
+	for _, segment := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		current = m[segment]
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// idempotencyKey returns the Redis key recording that an event was processed.
+func idempotencyKey(name, eventKey string, config Config) string {
+	return fmt.Sprintf("%s%s:%s", config.RedisIdempotencyPrefix, name, eventKey)
+}
+
+// withIdempotency wraps handle so each logical event is processed once within
+// IdempotencyTTL.  The key is claimed with SETNX before handling and released if
+// the handler fails, so a redelivery can try again.  If Redis is unavailable the
+// event is processed anyway rather than dropped.
+func withIdempotency(rdb RedisClient, name string, config Config, keyFn eventKeyFunc, handle messageHandler) messageHandler {
+	return func(ctx context.Context, payload string) error {
+		eventKey := keyFn(payload)
+		key := idempotencyKey(name, eventKey, config)
+		ttl := time.Duration(config.IdempotencyTTL) * time.Second
+
+		first, err := rdb.SetNX(ctx, key, time.Now().Unix(), ttl).Result()
+		if err != nil {
+			Warn("Idempotency check failed for %s event %s, processing anyway: %v", name, eventKey, err)
+			return handle(ctx, payload)
+		}
+		if !first {
+			Info("Skipping duplicate %s event %s", name, eventKey)
+			ignoreEvent(ctx)
+			return nil
+		}
+
+		if err := handle(ctx, payload); err != nil {
+			if delErr := rdb.Del(ctx, key).Err(); delErr != nil {
+				Warn("Error releasing idempotency key %s: %v", key, delErr)
+			}
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// issueIndexKey returns the Redis key under which the confirmation message
+// location for issueURL is stored.
+func issueIndexKey(issueURL string, config Config) string {
+	return config.RedisIssueIndexPrefix + issueURL
+}
+
+// issueIndexTTL returns how long an index entry for a message in channelID
+// should live.  It is aligned with the confirmation TTL of that channel so the
+// index does not expire before the message it points to; 0 means it never
+// expires.
+func issueIndexTTL(channelID string, config Config) time.Duration {
+	return time.Duration(channelConfirmationTTL(channelID, config)) * time.Second
+}
+
+// storeIssueMessage records the channel and timestamp of the confirmation
+// message for issueURL so later events can find it without scanning history.
+func storeIssueMessage(ctx context.Context, rdb RedisClient, issueURL, channelID, ts string, config Config) error {
+	if issueURL == "" || channelID == "" || ts == "" {
+		return fmt.Errorf("incomplete issue message reference: url=%q channel=%q ts=%q", issueURL, channelID, ts)
+	}
+
+	payload, err := json.Marshal(IssueMessageRef{Channel: channelID, Ts: ts})
+	if err != nil {
+		return fmt.Errorf("failed to marshal issue message reference: %v", err)
+	}
+
+	err = rdb.Set(ctx, issueIndexKey(issueURL, config), payload, issueIndexTTL(channelID, config)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to store issue message reference: %v", err)
+	}
+
+	Debug("Indexed confirmation message for issue %s at channel=%s, ts=%s", issueURL, channelID, ts)
+	return nil
+}
+
+// lookupIssueMessage returns the indexed channel and timestamp for issueURL.
+// Empty strings and a nil error are returned when there is no entry.
+func lookupIssueMessage(ctx context.Context, rdb RedisClient, issueURL string, config Config) (string, string, error) {
+	data, err := rdb.Get(ctx, issueIndexKey(issueURL, config)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up issue message reference: %v", err)
+	}
+
+	var ref IssueMessageRef
+	if err := json.Unmarshal([]byte(data), &ref); err != nil {
+		return "", "", fmt.Errorf("failed to unmarshal issue message reference: %v", err)
+	}
+
+	return ref.Channel, ref.Ts, nil
+}
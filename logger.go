@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"strings"
 )
@@ -17,13 +19,18 @@ const (
 	ERROR
 )
 
+// correlationIDKey is the log attribute and Poppit metadata field that ties
+// together every log line and command belonging to one issue request.
+const correlationIDKey = "correlation_id"
+
 var (
-	currentLogLevel LogLevel = INFO
-	logLevelNames            = map[LogLevel]string{
-		DEBUG: "DEBUG",
-		INFO:  "INFO",
-		WARN:  "WARN",
-		ERROR: "ERROR",
+	logLevel   = new(slog.LevelVar)
+	logger     = newLogger(os.Stderr, "text")
+	slogLevels = map[LogLevel]slog.Level{
+		DEBUG: slog.LevelDebug,
+		INFO:  slog.LevelInfo,
+		WARN:  slog.LevelWarn,
+		ERROR: slog.LevelError,
 	}
 )
 
@@ -31,50 +38,140 @@ var (
 func SetLogLevel(level string) {
 	switch strings.ToUpper(level) {
 	case "DEBUG":
-		currentLogLevel = DEBUG
+		logLevel.Set(slog.LevelDebug)
 	case "INFO":
-		currentLogLevel = INFO
+		logLevel.Set(slog.LevelInfo)
 	case "WARN":
-		currentLogLevel = WARN
+		logLevel.Set(slog.LevelWarn)
 	case "ERROR":
-		currentLogLevel = ERROR
+		logLevel.Set(slog.LevelError)
+	default:
+		logLevel.Set(slog.LevelInfo)
+		logf(context.Background(), WARN, "Unknown log level '%s', defaulting to INFO", level)
+	}
+}
+
+// SetLogFormat switches between "text" (key=value) and "json" output.  The
+// standard library logger is redirected too, so log.Printf calls share the format.
+func SetLogFormat(format string) {
+	switch strings.ToLower(format) {
+	case "json", "text":
+		logger = newLogger(os.Stderr, strings.ToLower(format))
 	default:
-		// Use custom logger for consistency
-		currentLogLevel = INFO
-		logf(WARN, "Unknown log level '%s', defaulting to INFO", level)
+		logger = newLogger(os.Stderr, "text")
+		logf(context.Background(), WARN, "Unknown log format '%s', defaulting to text", format)
+	}
+	slog.SetDefault(logger)
+}
+
+func newLogger(w io.Writer, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler = slog.NewTextHandler(w, opts)
+	if format == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// contextHandler adds the correlation ID carried by the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := correlationID(ctx); id != "" {
+		r.AddAttrs(slog.String(correlationIDKey, id))
 	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+type correlationIDContextKey struct{}
+
+// withCorrelationID returns a context whose log lines and Poppit commands carry id.
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationIDContextKey{}, id)
+}
+
+// correlationID returns the correlation ID carried by ctx, if any.
+func correlationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDContextKey{}).(string)
+	return id
+}
+
+// newCorrelationID starts a new issue lifecycle.
+func newCorrelationID() string {
+	return newRandomID()[:16]
+}
+
+// withMetadataCorrelationID restores the correlation ID echoed back in Poppit
+// or Slack message metadata.
+func withMetadataCorrelationID(ctx context.Context, metadata map[string]interface{}) context.Context {
+	id, _ := metadata[correlationIDKey].(string)
+	return withCorrelationID(ctx, id)
 }
 
 // logf logs a formatted message at the specified level
-func logf(level LogLevel, format string, args ...interface{}) {
-	if level >= currentLogLevel {
-		prefix := fmt.Sprintf("[%s] ", logLevelNames[level])
-		log.Printf(prefix+format, args...)
+func logf(ctx context.Context, level LogLevel, format string, args ...interface{}) {
+	slogLevel := slogLevels[level]
+	if !logger.Enabled(ctx, slogLevel) {
+		return
 	}
+	logger.Log(ctx, slogLevel, fmt.Sprintf(format, args...))
 }
 
 // Debug logs a debug message (most verbose)
 func Debug(format string, args ...interface{}) {
-	logf(DEBUG, format, args...)
+	logf(context.Background(), DEBUG, format, args...)
 }
 
 // Info logs an informational message
 func Info(format string, args ...interface{}) {
-	logf(INFO, format, args...)
+	logf(context.Background(), INFO, format, args...)
 }
 
 // Warn logs a warning message
 func Warn(format string, args ...interface{}) {
-	logf(WARN, format, args...)
+	logf(context.Background(), WARN, format, args...)
 }
 
 // Error logs an error message
 func Error(format string, args ...interface{}) {
-	logf(ERROR, format, args...)
+	logf(context.Background(), ERROR, format, args...)
+}
+
+// DebugContext is Debug with the correlation ID carried by ctx.
+func DebugContext(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, DEBUG, format, args...)
+}
+
+// InfoContext is Info with the correlation ID carried by ctx.
+func InfoContext(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, INFO, format, args...)
+}
+
+// WarnContext is Warn with the correlation ID carried by ctx.
+func WarnContext(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, WARN, format, args...)
+}
+
+// ErrorContext is Error with the correlation ID carried by ctx.
+func ErrorContext(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, ERROR, format, args...)
 }
 
 // Fatal logs a fatal error and exits
 func Fatal(format string, args ...interface{}) {
-	logf(ERROR, format, args...)
+	logf(context.Background(), ERROR, format, args...)
 	os.Exit(1)
 }
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -13,16 +16,35 @@ import (
 )
 
 func main() {
-	config := loadConfig()
+	configFlag := flag.String("config", "", "path to the config file (default $CONFIG_FILE or config.yaml)")
+	flag.Parse()
+	args := flag.Args()
 
-	// Initialize logger with configured level
-	SetLogLevel(config.LogLevel)
+	configFile := configFilePath(*configFlag)
+	config := loadConfig(configFile)
 
-	if config.SlackBotToken == "" {
-		Fatal("SLACK_BOT_TOKEN is required")
+	// Container health checks run the binary itself; the image has no curl
+	if len(args) > 0 && args[0] == "healthcheck" {
+		os.Exit(runHealthcheck(config))
 	}
-	if config.GitHubOrg == "" {
-		Fatal("GITHUB_ORG is required")
+
+	if len(args) > 0 && args[0] == "config" {
+		if len(args) != 2 || args[1] != "check" {
+			fmt.Println("usage: slashvibeissue config check")
+			os.Exit(2)
+		}
+		os.Exit(runConfigCheck(config, os.Stdout))
+	}
+
+	// Initialize logger with configured level and format
+	SetLogLevel(config.LogLevel)
+	SetLogFormat(config.LogFormat)
+
+	if err := config.Validate(); err != nil {
+		for _, problem := range strings.Split(err.Error(), "\n") {
+			Error("Invalid configuration: %s", problem)
+		}
+		Fatal("Configuration has errors; run \"slashvibeissue config check\" for details")
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -43,15 +65,39 @@ func main() {
 	Info("Connected to Redis")
 
 	// Setup Slack client
-	slackClient := slack.New(config.SlackBotToken)
+	slackClient := slack.New(config.SlackBotToken, slack.OptionHTTPClient(newSlackHTTPClient()))
+
+	// Re-feed dead-lettered events instead of starting the service
+	if len(args) > 0 && args[0] == "replay" {
+		os.Exit(runReplay(ctx, rdb, slackClient, config, args[1:], os.Stdout))
+	}
+
+	// Handlers read the config per event, so reloads apply without a restart
+	runtimeConfig.Store(&config)
+	watchConfig(ctx, configFile)
 
 	// Start subscribers
-	go subscribeToSlashCommands(ctx, rdb, slackClient, config)
-	go subscribeToViewSubmissions(ctx, rdb, slackClient, config)
-	go subscribeToPoppitOutput(ctx, rdb, slackClient, config)
-	go subscribeToReactions(ctx, rdb, slackClient, config)
-	go subscribeToMessageActions(ctx, rdb, slackClient, config)
-	go subscribeToGitHubWebhooks(ctx, rdb, slackClient, config)
+	subscribers := newSubscriberStatus()
+	for _, sub := range []struct {
+		name string
+		run  func(context.Context, *redis.Client, SlackAPI, Config) error
+	}{
+		{"slash-commands", subscribeToSlashCommands},
+		{"view-submissions", subscribeToViewSubmissions},
+		{"poppit-output", subscribeToPoppitOutput},
+		{"reactions", subscribeToReactions},
+		{"message-actions", subscribeToMessageActions},
+		{"github-webhooks", subscribeToGitHubWebhooks},
+		{"block-actions", subscribeToBlockActions},
+	} {
+		subscribers.run(ctx, sub.name, func(ctx context.Context) error {
+			return sub.run(ctx, rdb, slackClient, config)
+		})
+	}
+
+	startHTTPServer(ctx, config.HTTPAddr, newHealthHandler(func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	}, subscribers))
 
 	log.Println("SlashVibeIssue service started")
 
@@ -60,7 +106,14 @@ func main() {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 
-	Info("Shutting down...")
+	// Stop reading new messages, then give running handlers time to finish
+	Info("Shutting down, waiting up to %ds for running handlers...", config.DrainTimeout)
 	cancel()
-	time.Sleep(1 * time.Second)
+	abandoned := inFlight.drain(time.Duration(config.DrainTimeout) * time.Second)
+	for _, handler := range abandoned {
+		Warn("Abandoned handler at shutdown: %s", handler)
+	}
+	if len(abandoned) == 0 {
+		Info("All handlers finished")
+	}
 }
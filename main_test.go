@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/slack-go/slack"
 )
@@ -148,9 +155,9 @@ func TestCreateIssueModalWithProjectCheckbox(t *testing.T) {
 			t.Errorf("Expected block_id to be 'assignment_block', got '%s'", actionBlock.BlockID)
 		}
 
-		// Verify we have 3 elements (assign to copilot, add to project, and sanitise issue checkboxes)
-		if len(actionBlock.Elements.ElementSet) != 3 {
-			t.Errorf("Expected 3 checkbox elements in assignment block, got %d", len(actionBlock.Elements.ElementSet))
+		// Verify we have 4 elements (assign to copilot, add to project, sanitise issue and assign to me checkboxes)
+		if len(actionBlock.Elements.ElementSet) != 4 {
+			t.Errorf("Expected 4 checkbox elements in assignment block, got %d", len(actionBlock.Elements.ElementSet))
 		}
 	} else {
 		t.Error("Expected block at index 4 to be an ActionBlock")
@@ -169,9 +176,9 @@ func TestCreateIssueModalWithSanitiseCheckbox(t *testing.T) {
 	// Check assignment block (index 4) for sanitise checkbox
 	assignmentBlock := modal.Blocks.BlockSet[4]
 	if actionBlock, ok := assignmentBlock.(*slack.ActionBlock); ok {
-		// Verify we have 3 checkbox elements (copilot, project, sanitise)
-		if len(actionBlock.Elements.ElementSet) != 3 {
-			t.Errorf("Expected 3 checkbox elements, got %d", len(actionBlock.Elements.ElementSet))
+		// Verify we have 4 checkbox elements (copilot, project, sanitise, assign to me)
+		if len(actionBlock.Elements.ElementSet) != 4 {
+			t.Errorf("Expected 4 checkbox elements, got %d", len(actionBlock.Elements.ElementSet))
 		}
 	} else {
 		t.Error("Expected block at index 4 to be an ActionBlock")
@@ -833,53 +840,6 @@ func TestGetEnv(t *testing.T) {
 	})
 }
 
-func TestGetEnvAsInt(t *testing.T) {
-	tests := []struct {
-		name       string
-		envVal     string
-		defaultVal string
-		expected   int
-	}{
-		{name: "valid integer from env", envVal: "42", defaultVal: "0", expected: 42},
-		{name: "empty env uses default", envVal: "", defaultVal: "10", expected: 10},
-		{name: "invalid env falls back to default", envVal: "not-a-number", defaultVal: "5", expected: 5},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			t.Setenv("TEST_INT_VAR", tt.envVal)
-			result := getEnvAsInt("TEST_INT_VAR", tt.defaultVal)
-			if result != tt.expected {
-				t.Errorf("getEnvAsInt() = %d, want %d", result, tt.expected)
-			}
-		})
-	}
-}
-
-func TestGetEnvAsIntSeconds(t *testing.T) {
-	tests := []struct {
-		name       string
-		envVal     string
-		defaultVal string
-		expected   int
-	}{
-		{name: "plain integer", envVal: "3600", defaultVal: "0", expected: 3600},
-		{name: "duration string", envVal: "24h", defaultVal: "0", expected: 86400},
-		{name: "empty env uses default duration", envVal: "", defaultVal: "48h", expected: 172800},
-		{name: "empty env uses default int", envVal: "", defaultVal: "7200", expected: 7200},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			t.Setenv("TEST_DURATION_VAR", tt.envVal)
-			result := getEnvAsIntSeconds("TEST_DURATION_VAR", tt.defaultVal)
-			if result != tt.expected {
-				t.Errorf("getEnvAsIntSeconds() = %d, want %d", result, tt.expected)
-			}
-		})
-	}
-}
-
 func TestLoadConfigDefaults(t *testing.T) {
 	// Unset any env vars that might interfere
 	for _, key := range []string{
@@ -890,7 +850,7 @@ func TestLoadConfigDefaults(t *testing.T) {
 		t.Setenv(key, "")
 	}
 
-	cfg := loadConfig()
+	cfg := loadConfig(defaultConfigFile)
 
 	checks := []struct {
 		name     string
@@ -917,9 +877,9 @@ func TestLoadConfigDefaults(t *testing.T) {
 
 func TestLoadFileConfig(t *testing.T) {
 	t.Run("returns empty config when file does not exist", func(t *testing.T) {
-		fc := loadFileConfig("/nonexistent/path/config.yaml")
-		if fc.RedisAddr != "" || fc.LogLevel != "" {
-			t.Errorf("expected empty fileConfig for missing file, got %+v", fc)
+		fc, problems := readFileConfig("/nonexistent/path/config.yaml")
+		if fc.RedisAddr != "" || fc.LogLevel != "" || problems != nil {
+			t.Errorf("expected empty fileConfig and no problems for missing file, got %+v, %v", fc, problems)
 		}
 	})
 
@@ -936,8 +896,11 @@ confirmation_search_limit: "50"
 			t.Fatalf("failed to write temp config: %v", err)
 		}
 
-		fc := loadFileConfig(path)
+		fc, problems := readFileConfig(path)
 
+		if problems != nil {
+			t.Errorf("unexpected problems: %v", problems)
+		}
 		if fc.RedisAddr != "redis.example.com:6379" {
 			t.Errorf("RedisAddr = %q, want %q", fc.RedisAddr, "redis.example.com:6379")
 		}
@@ -958,14 +921,155 @@ confirmation_search_limit: "50"
 		if err := os.WriteFile(path, []byte("not: valid: yaml: ["), 0600); err != nil {
 			t.Fatalf("failed to write temp config: %v", err)
 		}
-		fc := loadFileConfig(path)
-		if fc.RedisAddr != "" || fc.LogLevel != "" {
-			t.Errorf("expected empty fileConfig for invalid YAML, got %+v", fc)
+		fc, problems := readFileConfig(path)
+		if fc.RedisAddr != "" || fc.LogLevel != "" || len(problems) != 1 {
+			t.Errorf("expected empty fileConfig and one problem for invalid YAML, got %+v, %v", fc, problems)
+		}
+	})
+
+	t.Run("reports unknown keys and keeps known ones", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.yaml")
+		content := `
+redis_addr: "redis.example.com:6379"
+confirmation_chanel_id: "C0123456789"
+`
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+		fc, problems := readFileConfig(path)
+		if fc.RedisAddr != "redis.example.com:6379" {
+			t.Errorf("RedisAddr = %q, want %q", fc.RedisAddr, "redis.example.com:6379")
+		}
+		if len(problems) != 1 || !strings.Contains(problems[0].Error(), "confirmation_chanel_id") {
+			t.Errorf("expected a problem naming the unknown key, got %v", problems)
 		}
 	})
 }
 
-func TestGetEnvWithFile(t *testing.T) {
+func TestConfigValidate(t *testing.T) {
+	valid := Config{
+		SlackBotToken:           "xoxb-test",
+		GitHubOrg:               "its-the-vibe",
+		ConfirmationChannelID:   "C0123456789",
+		ConfirmationSearchLimit: 100,
+		LogLevel:                "info",
+		LogFormat:               "json",
+		HTTPAddr:                ":8080",
+		RedisChannel:            "slack-commands",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{"missing required", func(c *Config) { c.SlackBotToken, c.GitHubOrg, c.ConfirmationChannelID = "", "", "" },
+			[]string{"SLACK_BOT_TOKEN is required", "GITHUB_ORG is required", "CONFIRMATION_CHANNEL_ID is required"}},
+		{"channel name instead of ID", func(c *Config) { c.ConfirmationChannelID = "#issues" },
+			[]string{"CONFIRMATION_CHANNEL_ID"}},
+		{"SlackLiner URL without scheme", func(c *Config) { c.SlackLinerURL = "slackliner:8080" },
+			[]string{"SLACKLINER_URL"}},
+		{"invalid attachment settings", func(c *Config) {
+			c.AttachmentUploadURL, c.AttachmentMaxBytes, c.AttachmentTypes = "files/uploads", -1, []string{"image/[png"}
+		}, []string{"ATTACHMENT_UPLOAD_URL", "ATTACHMENT_MAX_BYTES", `ATTACHMENT_TYPES: "image/[png"`}},
+		{"broken source footer template", func(c *Config) { c.IssueSourceFooter = "Source: {{.Permalink" },
+			[]string{"ISSUE_SOURCE_FOOTER"}},
+		{"unparsable duration", func(c *Config) {
+			c.loadProblems = []error{fmt.Errorf("CONFIRMATION_TTL: %q is not a number of seconds", "2 days")}
+		}, []string{"CONFIRMATION_TTL"}},
+		{"out of range values", func(c *Config) {
+			c.ConfirmationSearchLimit, c.DrainTimeout, c.LogLevel, c.LogFormat, c.HTTPAddr = 0, -1, "verbose", "xml", "8080"
+		}, []string{"CONFIRMATION_SEARCH_LIMIT", "DRAIN_TIMEOUT", "LOG_LEVEL", "LOG_FORMAT", "HTTP_ADDR"}},
+		{"unknown stream channel", func(c *Config) { c.RedisStreamChannels = []string{"slack-commands", "typo"} },
+			[]string{`REDIS_STREAM_CHANNELS: "typo"`}},
+		{"invalid confirmation routes", func(c *Config) {
+			c.ConfirmationRoutes = []confirmationRoute{
+				{Repo: "its-the-vibe/*", Channel: "C0123456789", TTL: "168h"},
+				{Channel: "#team", TTL: "a week"},
+				{Repo: "[infra", Channel: "C0123456789"},
+			}
+		}, []string{"confirmation_routes[2]: needs a source_channel", `confirmation_routes[2]: channel "#team"`,
+			`confirmation_routes[2]: ttl "a week"`, `confirmation_routes[3]: repo "[infra"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			err := config.Validate()
+			if err == nil {
+				t.Fatal("Expected problems, got none")
+			}
+			if lines := strings.Split(err.Error(), "\n"); len(lines) != len(tt.want) {
+				t.Errorf("Expected %d problems, got %d:\n%v", len(tt.want), len(lines), err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected a problem mentioning %q, got:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigSources(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-secret")
+	t.Setenv("REDIS_ADDR", "redis.example.com:6379")
+	t.Setenv("WORKING_DIR", "")
+	t.Setenv("CONFIRMATION_TTL", "two days")
+
+	config := loadConfig(defaultConfigFile)
+	sources := make(map[string]configSetting)
+	for _, s := range config.settings {
+		sources[s.Key] = s
+	}
+
+	if s := sources["REDIS_ADDR"]; s.Source != sourceEnv || s.Value != "redis.example.com:6379" {
+		t.Errorf("REDIS_ADDR = %+v, want env", s)
+	}
+	if s := sources["WORKING_DIR"]; s.Source != sourceDefault || s.Value != "/tmp" {
+		t.Errorf("WORKING_DIR = %+v, want default", s)
+	}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "CONFIRMATION_TTL") {
+		t.Errorf("Expected the unparsable CONFIRMATION_TTL to be reported, got %v", err)
+	}
+
+	var out strings.Builder
+	if code := runConfigCheck(config, &out); code != 1 {
+		t.Errorf("runConfigCheck() = %d, want 1", code)
+	}
+	if strings.Contains(out.String(), "xoxb-secret") {
+		t.Errorf("Expected the Slack token to be masked:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "SLACK_BOT_TOKEN") || !strings.Contains(out.String(), "Problems:") {
+		t.Errorf("Unexpected config check output:\n%s", out.String())
+	}
+}
+
+func TestConfigCheckReportsPresets(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("GITHUB_ORG", "its-the-vibe")
+	t.Setenv("CONFIRMATION_CHANNEL_ID", "")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "confirmation_channel_id: \"C0000000001\"\npresets:\n  - name: broken\n    body: \"{{.Text\"\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+
+	var out strings.Builder
+	if code := runConfigCheck(loadConfig(path), &out); code != 1 {
+		t.Errorf("runConfigCheck() = %d, want 1", code)
+	}
+	if !strings.Contains(out.String(), "presets: preset broken: invalid body template") {
+		t.Errorf("Expected the broken preset to be reported:\n%s", out.String())
+	}
+}
+
+func TestConfigLoaderStr(t *testing.T) {
 	tests := []struct {
 		name     string
 		envVal   string
@@ -980,60 +1084,99 @@ func TestGetEnvWithFile(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			t.Setenv("TEST_ENVWITHFILE_VAR", tt.envVal)
-			result := getEnvWithFile("TEST_ENVWITHFILE_VAR", tt.fileVal, tt.defaultV)
-			if result != tt.expected {
-				t.Errorf("getEnvWithFile() = %q, want %q", result, tt.expected)
+			t.Setenv("TEST_STR_VAR", tt.envVal)
+			l := &configLoader{}
+			if result := l.str("TEST_STR_VAR", tt.fileVal, tt.defaultV); result != tt.expected {
+				t.Errorf("str() = %q, want %q", result, tt.expected)
 			}
 		})
 	}
 }
 
-func TestGetEnvAsIntSecondsWithFile(t *testing.T) {
+func TestConfigLoaderSeconds(t *testing.T) {
 	tests := []struct {
 		name     string
 		envVal   string
 		fileVal  string
 		defaultV string
 		expected int
+		problem  bool
 	}{
 		{name: "env var int takes precedence", envVal: "3600", fileVal: "7200", defaultV: "48h", expected: 3600},
 		{name: "env var duration takes precedence", envVal: "1h", fileVal: "7200", defaultV: "48h", expected: 3600},
 		{name: "file value used when env unset", envVal: "", fileVal: "7200", defaultV: "48h", expected: 7200},
 		{name: "file duration used when env unset", envVal: "", fileVal: "24h", defaultV: "48h", expected: 86400},
 		{name: "default used when both unset", envVal: "", fileVal: "", defaultV: "48h", expected: 172800},
+		{name: "invalid value is a problem and uses the default", envVal: "soon", fileVal: "24h", defaultV: "48h", expected: 172800, problem: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			t.Setenv("TEST_INTSECONDS_FILE_VAR", tt.envVal)
-			result := getEnvAsIntSecondsWithFile("TEST_INTSECONDS_FILE_VAR", tt.fileVal, tt.defaultV)
-			if result != tt.expected {
-				t.Errorf("getEnvAsIntSecondsWithFile() = %d, want %d", result, tt.expected)
+			t.Setenv("TEST_SECONDS_VAR", tt.envVal)
+			l := &configLoader{}
+			if result := l.seconds("TEST_SECONDS_VAR", tt.fileVal, tt.defaultV); result != tt.expected {
+				t.Errorf("seconds() = %d, want %d", result, tt.expected)
+			}
+			if got := len(l.problems) > 0; got != tt.problem {
+				t.Errorf("problems = %v, want problem %v", l.problems, tt.problem)
 			}
 		})
 	}
 }
 
-func TestGetEnvAsIntWithFile(t *testing.T) {
+func TestConfigLoaderInt(t *testing.T) {
 	tests := []struct {
 		name     string
 		envVal   string
 		fileVal  string
 		defaultV string
 		expected int
+		problem  bool
 	}{
 		{name: "env var takes precedence", envVal: "42", fileVal: "99", defaultV: "10", expected: 42},
 		{name: "file value used when env unset", envVal: "", fileVal: "50", defaultV: "10", expected: 50},
 		{name: "default used when both unset", envVal: "", fileVal: "", defaultV: "10", expected: 10},
+		{name: "invalid value is a problem and uses the default", envVal: "not-a-number", fileVal: "", defaultV: "5", expected: 5, problem: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			t.Setenv("TEST_INTWITHFILE_VAR", tt.envVal)
-			result := getEnvAsIntWithFile("TEST_INTWITHFILE_VAR", tt.fileVal, tt.defaultV)
-			if result != tt.expected {
-				t.Errorf("getEnvAsIntWithFile() = %d, want %d", result, tt.expected)
+			t.Setenv("TEST_INT_VAR", tt.envVal)
+			l := &configLoader{}
+			if result := l.int("TEST_INT_VAR", tt.fileVal, tt.defaultV); result != tt.expected {
+				t.Errorf("int() = %d, want %d", result, tt.expected)
+			}
+			if got := len(l.problems) > 0; got != tt.problem {
+				t.Errorf("problems = %v, want problem %v", l.problems, tt.problem)
+			}
+		})
+	}
+}
+
+func TestConfigLoaderBool(t *testing.T) {
+	tests := []struct {
+		name     string
+		envVal   string
+		fileVal  string
+		defaultV string
+		expected bool
+		problem  bool
+	}{
+		{name: "env var takes precedence", envVal: "false", fileVal: "true", defaultV: "true", expected: false},
+		{name: "file value used when env unset", envVal: "", fileVal: "false", defaultV: "true", expected: false},
+		{name: "default used when both unset", envVal: "", fileVal: "", defaultV: "true", expected: true},
+		{name: "invalid value is a problem and uses the default", envVal: "maybe", fileVal: "1", defaultV: "false", expected: false, problem: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_BOOL_VAR", tt.envVal)
+			l := &configLoader{}
+			if result := l.bool("TEST_BOOL_VAR", tt.fileVal, tt.defaultV); result != tt.expected {
+				t.Errorf("bool() = %v, want %v", result, tt.expected)
+			}
+			if got := len(l.problems) > 0; got != tt.problem {
+				t.Errorf("problems = %v, want problem %v", l.problems, tt.problem)
 			}
 		})
 	}
@@ -1120,8 +1263,12 @@ func TestSendConfirmationHTTP(t *testing.T) {
 			ConfirmationTTL:       172800,
 		}
 
-		channelID, ts, err := sendConfirmationHTTP(t.Context(), "test-repo", "Test Issue", "testuser",
-			"https://github.com/test-org/test-repo/issues/1", false, cfg)
+		channelID, ts, err := sendConfirmationHTTP(t.Context(), IssueConfirmation{
+			Repo:     "test-repo",
+			Title:    "Test Issue",
+			Username: "testuser",
+			IssueURL: "https://github.com/test-org/test-repo/issues/1",
+		}, cfg)
 
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
@@ -1136,8 +1283,12 @@ func TestSendConfirmationHTTP(t *testing.T) {
 
 	t.Run("returns error when SlackLinerURL not configured", func(t *testing.T) {
 		cfg := Config{SlackLinerURL: ""}
-		_, _, err := sendConfirmationHTTP(t.Context(), "repo", "title", "user",
-			"https://github.com/org/repo/issues/1", false, cfg)
+		_, _, err := sendConfirmationHTTP(t.Context(), IssueConfirmation{
+			Repo:     "repo",
+			Title:    "title",
+			Username: "user",
+			IssueURL: "https://github.com/org/repo/issues/1",
+		}, cfg)
 		if err == nil {
 			t.Error("Expected error when SlackLinerURL is empty")
 		}
@@ -1154,8 +1305,12 @@ func TestSendConfirmationHTTP(t *testing.T) {
 			GitHubOrg:             "test-org",
 			ConfirmationChannelID: "CTEST",
 		}
-		_, _, err := sendConfirmationHTTP(t.Context(), "repo", "title", "user",
-			"https://github.com/test-org/repo/issues/1", false, cfg)
+		_, _, err := sendConfirmationHTTP(t.Context(), IssueConfirmation{
+			Repo:     "repo",
+			Title:    "title",
+			Username: "user",
+			IssueURL: "https://github.com/test-org/repo/issues/1",
+		}, cfg)
 		if err == nil {
 			t.Error("Expected error on 500 response")
 		}
@@ -1169,8 +1324,13 @@ func TestBuildConfirmationMessage(t *testing.T) {
 		ConfirmationTTL:       86400,
 	}
 
-	msg := buildConfirmationMessage("my-repo", "Fix the bug", "alice",
-		"https://github.com/my-org/my-repo/issues/42", true, cfg)
+	msg := buildConfirmationMessage(IssueConfirmation{
+		Repo:              "my-repo",
+		Title:             "Fix the bug",
+		Username:          "alice",
+		IssueURL:          "https://github.com/my-org/my-repo/issues/42",
+		AssignedToCopilot: true,
+	}, cfg)
 
 	if msg.Channel != "CCHAN" {
 		t.Errorf("Channel = %q, want %q", msg.Channel, "CCHAN")
@@ -1205,3 +1365,2441 @@ func TestBuildConfirmationMessage(t *testing.T) {
 		t.Errorf("assignedToCopilot = %v, want true", payload["assignedToCopilot"])
 	}
 }
+
+func TestIssueIndexKey(t *testing.T) {
+	cfg := Config{RedisIssueIndexPrefix: "slashvibeissue:issue-message:"}
+	key := issueIndexKey("https://github.com/org/repo/issues/7", cfg)
+	expected := "slashvibeissue:issue-message:https://github.com/org/repo/issues/7"
+	if key != expected {
+		t.Errorf("issueIndexKey() = %q, want %q", key, expected)
+	}
+}
+
+func TestIssueIndexTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      int
+		expected time.Duration
+	}{
+		{name: "aligned with confirmation TTL", ttl: 172800, expected: 48 * time.Hour},
+		{name: "zero TTL never expires", ttl: 0, expected: 0},
+		{name: "negative TTL never expires", ttl: -1, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := issueIndexTTL("", Config{ConfirmationTTL: tt.ttl})
+			if result != tt.expected {
+				t.Errorf("issueIndexTTL() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIssueMessageRefRoundTrip(t *testing.T) {
+	data, err := json.Marshal(IssueMessageRef{Channel: "C123", Ts: "1700000000.000100"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != `{"channel":"C123","ts":"1700000000.000100"}` {
+		t.Errorf("Marshaled ref = %s", data)
+	}
+
+	var ref IssueMessageRef
+	if err := json.Unmarshal(data, &ref); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ref.Channel != "C123" || ref.Ts != "1700000000.000100" {
+		t.Errorf("Unmarshaled ref = %+v", ref)
+	}
+}
+
+// shellLiteralBytes are the bytes a POSIX shell reads literally outside
+// quotes.  It is spelled out here rather than taken from shellSafePattern so
+// the tests check that pattern instead of trusting it.
+const shellLiteralBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-"
+
+// splitShellWords parses a command line produced by shellCommand.String using
+// POSIX shell word rules, byte by byte as a shell does.  It fails on any character outside single quotes that
+// a shell would interpret (substitution, redirection, separators, globbing...),
+// so a successful round trip proves no argument escaped its quoting.
+func splitShellWords(line string) ([]string, error) {
+	var words []string
+	var current strings.Builder
+	inWord, inQuote, escaped := false, false, false
+
+	for i := 0; i < len(line); i++ {
+		r := line[i]
+		switch {
+		case inQuote:
+			if r == '\'' {
+				inQuote = false
+			} else {
+				current.WriteByte(r)
+			}
+		case escaped:
+			current.WriteByte(r)
+			escaped = false
+		case r == ' ':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		case r == '\'':
+			inQuote, inWord = true, true
+		case r == '\\':
+			escaped, inWord = true, true
+		case strings.IndexByte(shellLiteralBytes, r) >= 0:
+			current.WriteByte(r)
+			inWord = true
+		default:
+			return nil, fmt.Errorf("unquoted shell metacharacter %q in %q", r, line)
+		}
+	}
+
+	if inQuote || escaped {
+		return nil, fmt.Errorf("unterminated quoting in %q", line)
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+	return words, nil
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "safe word left bare", input: "its-the-vibe/SlashVibeIssue", expected: "its-the-vibe/SlashVibeIssue"},
+		{name: "empty string", input: "", expected: "''"},
+		{name: "spaces are quoted", input: "Fix the bug", expected: "'Fix the bug'"},
+		{name: "single quote", input: "don't", expected: `'don'\''t'`},
+		{name: "command substitution", input: "$(rm -rf /)", expected: "'$(rm -rf /)'"},
+		{name: "backticks", input: "`id`", expected: "'`id`'"},
+		{name: "NUL dropped", input: "a\x00b", expected: "ab"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := shellQuote(tt.input)
+			if result != tt.expected {
+				t.Errorf("shellQuote(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestShellCommandString(t *testing.T) {
+	cmd := newShellCommand("gh", "issue", "create").
+		Flag("--repo", "org/repo").
+		Flag("--title", "It's broken; rm -rf ~").
+		Flag("--assignee", "@copilot")
+
+	expected := `gh issue create --repo org/repo --title 'It'\''s broken; rm -rf ~' --assignee @copilot`
+	if cmd.String() != expected {
+		t.Errorf("String() = %q, want %q", cmd.String(), expected)
+	}
+
+	if !strings.HasPrefix(cmd.String(), "gh issue create") {
+		t.Error("Expected command to keep the bare gh issue create prefix used by handlePoppitOutput")
+	}
+}
+
+func TestValidateRepoFullName(t *testing.T) {
+	tests := []struct {
+		repo    string
+		wantErr bool
+	}{
+		{repo: "its-the-vibe/SlashVibeIssue", wantErr: false},
+		{repo: "org/repo.name_with-chars", wantErr: false},
+		{repo: "org/repo --web", wantErr: true},
+		{repo: "--repo/x", wantErr: true},
+		{repo: "org/repo;id", wantErr: true},
+		{repo: "no-slash", wantErr: true},
+		{repo: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			err := validateRepoFullName(tt.repo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateRepoFullName(%q) error = %v, wantErr %v", tt.repo, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateIssueURL(t *testing.T) {
+	if err := validateIssueURL("https://github.com/org/repo/issues/1"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for _, bad := range []string{"", "https://example.com/issues/1", "https://github.com/org/repo/pull/1", "https://github.com/org/repo/issues/1 --web"} {
+		if err := validateIssueURL(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func FuzzShellCommandArgs(f *testing.F) {
+	f.Add("Simple title", "Simple body", "org/repo")
+	f.Add("It's a 'quoted' title", "body with $(whoami) and `id`", "org/repo")
+	f.Add("'; rm -rf / #", "line one\nline two\\", "org/repo'; echo pwned; '")
+	f.Add("", "\x00", "--help")
+	f.Add(`'\''`, `"double" & | > < * ? ~ !`, "a/b c")
+
+	f.Fuzz(func(t *testing.T, title, body, repo string) {
+		cmd := newShellCommand("gh", "issue", "create").
+			Flag("--repo", repo).
+			Flag("--title", title).
+			Flag("--body", body)
+
+		words, err := splitShellWords(cmd.String())
+		if err != nil {
+			t.Fatalf("command line is not safely quoted: %v", err)
+		}
+
+		expected := cmd.Args()
+		for i := range expected {
+			expected[i] = strings.ReplaceAll(expected[i], "\x00", "")
+		}
+		if !slices.Equal(words, expected) {
+			t.Fatalf("got words %q, want %q", words, expected)
+		}
+
+		// A real shell must read the same words back.  splitShellWords has
+		// already rejected unquoted metacharacters, so running it is safe.
+		if sh, err := exec.LookPath("sh"); err == nil {
+			out, err := exec.Command(sh, "-c", `set -- `+cmd.String()+`; printf '%s\0' "$@"`).Output()
+			if err != nil {
+				t.Fatalf("sh could not read the command line: %v", err)
+			}
+			if got := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00"); !slices.Equal(got, expected) {
+				t.Fatalf("sh read words %q, want %q", got, expected)
+			}
+		}
+	})
+}
+
+func TestPoppitFailure(t *testing.T) {
+	zero, one := 0, 1
+	tests := []struct {
+		name         string
+		output       PoppitOutput
+		expectFailed bool
+		expectReason string
+	}{
+		{
+			name:         "successful issue creation",
+			output:       PoppitOutput{Output: "Creating issue in org/repo\n\nhttps://github.com/org/repo/issues/1"},
+			expectFailed: false,
+		},
+		{
+			name:         "zero exit code",
+			output:       PoppitOutput{ExitCode: &zero, Output: "done"},
+			expectFailed: false,
+		},
+		{
+			name:         "non-zero exit code prefers stderr",
+			output:       PoppitOutput{ExitCode: &one, Stderr: "permission denied", Output: ""},
+			expectFailed: true,
+			expectReason: "permission denied",
+		},
+		{
+			name:         "non-zero exit code without text",
+			output:       PoppitOutput{ExitCode: &one},
+			expectFailed: true,
+			expectReason: "exit status 1",
+		},
+		{
+			name:         "explicit error",
+			output:       PoppitOutput{Error: "command timed out"},
+			expectFailed: true,
+			expectReason: "command timed out",
+		},
+		{
+			name:         "known gh failure text",
+			output:       PoppitOutput{Stderr: "Creating issue in org/repo\n\nGraphQL: Could not resolve to a Repository with the name 'org/nope'. (repository)"},
+			expectFailed: true,
+			expectReason: "GraphQL: Could not resolve to a Repository with the name 'org/nope'. (repository)",
+		},
+		{
+			name:         "HTTP error",
+			output:       PoppitOutput{Stderr: "HTTP 404: Not Found"},
+			expectFailed: true,
+			expectReason: "HTTP 404: Not Found",
+		},
+		{
+			name:         "failure text on stdout is not a failure",
+			output:       PoppitOutput{ExitCode: &zero, Output: "Failed to reproduce? See the logs\nerror: none"},
+			expectFailed: false,
+		},
+		{
+			name:         "issue URL wins over stderr warnings",
+			output:       PoppitOutput{Stderr: "could not add label: 'triage' not found", Output: "https://github.com/org/repo/issues/1"},
+			expectFailed: false,
+		},
+		{
+			name:         "issue URL wins over a non-zero exit code",
+			output:       PoppitOutput{ExitCode: &one, Stderr: "failed to add to project", Output: "https://github.com/org/repo/issues/1"},
+			expectFailed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, failed := poppitFailure(tt.output)
+			if failed != tt.expectFailed {
+				t.Errorf("failed = %v, want %v", failed, tt.expectFailed)
+			}
+			if reason != tt.expectReason {
+				t.Errorf("reason = %q, want %q", reason, tt.expectReason)
+			}
+		})
+	}
+}
+
+func TestIssueRequestFromMetadata(t *testing.T) {
+	req := issueRequestFromMetadata(map[string]interface{}{
+		"repo":                   "org/repo",
+		"title":                  "Broken thing",
+		"description":            "It's broken",
+		"username":               "alice",
+		"user_id":                "U123",
+		"addToProject":           true,
+		"sanitiseIssue":          true,
+		"assignedToCopilot":      false,
+		"deferCopilotAssignment": true,
+		"labels":                 []interface{}{"bug", "triage"},
+		"milestone":              "v1.0",
+	})
+
+	expected := IssueRequest{
+		Repo:            "org/repo",
+		Title:           "Broken thing",
+		Description:     "It's broken",
+		Username:        "alice",
+		UserID:          "U123",
+		AddToProject:    true,
+		SanitiseIssue:   true,
+		AssignToCopilot: true,
+		Labels:          []string{"bug", "triage"},
+		Milestone:       "v1.0",
+	}
+	if !reflect.DeepEqual(req, expected) {
+		t.Errorf("issueRequestFromMetadata() = %+v, want %+v", req, expected)
+	}
+}
+
+func TestRetryFailedCommandKeptOnError(t *testing.T) {
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := Config{RedisFailedCommandPrefix: "failed:", FailedCommandTTL: 3600}
+	id, err := storeFailedCommand(t.Context(), rdb, FailedCommand{
+		Type:     "slash-vibe-issue",
+		Metadata: map[string]interface{}{"repo": "org/repo", "title": "Broken thing"},
+	}, config)
+	if err != nil {
+		t.Fatalf("storeFailedCommand returned error: %v", err)
+	}
+	event := BlockActionEvent{TriggerID: "T1"}
+	action := BlockAction{ActionID: retryFailedCommandActionID, Value: id}
+
+	// The trigger has expired; the stored command survives for another click
+	slackClient.openViewErr = errors.New("expired_trigger_id")
+	if err := retryFailedCommand(t.Context(), rdb, slackClient, event, action, config); err == nil {
+		t.Fatal("Expected the failed retry to return an error")
+	}
+	if _, ok := rdb.strings[failedCommandKey(id, config)]; !ok {
+		t.Fatal("Expected the failed command to be kept after a failed retry")
+	}
+
+	slackClient.openViewErr = nil
+	if err := retryFailedCommand(t.Context(), rdb, slackClient, event, action, config); err != nil {
+		t.Fatalf("retryFailedCommand returned error: %v", err)
+	}
+	if len(slackClient.openedViews) != 1 {
+		t.Errorf("Expected the retry modal to open, got %d views", len(slackClient.openedViews))
+	}
+	if _, ok := rdb.strings[failedCommandKey(id, config)]; ok {
+		t.Error("Expected the failed command to be removed after a successful retry")
+	}
+}
+
+func TestRetryFailedComment(t *testing.T) {
+	rdb := newFakeRedis()
+	config := Config{RedisFailedCommandPrefix: "failed:", FailedCommandTTL: 3600, RedisPoppitList: "poppit:commands"}
+	id, err := storeFailedCommand(t.Context(), rdb, FailedCommand{
+		Type: "slash-vibe-issue-comment",
+		Metadata: map[string]interface{}{
+			"issueURL": "https://github.com/org/repo/issues/7",
+			"user_id":  "U1",
+			"body":     "**Broken thing**\n\nIt's broken",
+		},
+	}, config)
+	if err != nil {
+		t.Fatalf("storeFailedCommand returned error: %v", err)
+	}
+
+	action := BlockAction{ActionID: retryFailedCommandActionID, Value: id}
+	if err := retryFailedCommand(t.Context(), rdb, newFakeSlack(), BlockActionEvent{}, action, config); err != nil {
+		t.Fatalf("retryFailedCommand returned error: %v", err)
+	}
+
+	commands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(commands) != 1 || commands[0].Type != "slash-vibe-issue-comment" {
+		t.Fatalf("Expected one comment command, got %+v", commands)
+	}
+	want := newShellCommand("gh", "issue", "comment", "https://github.com/org/repo/issues/7").
+		Flag("--body", "**Broken thing**\n\nIt's broken").String()
+	if commands[0].Commands[0] != want {
+		t.Errorf("Expected command %q, got %q", want, commands[0].Commands[0])
+	}
+}
+
+func TestBuildFailureBlocks(t *testing.T) {
+	output := PoppitOutput{
+		Type: "slash-vibe-issue",
+		Metadata: map[string]interface{}{
+			"repo":        "org/repo",
+			"title":       "Broken thing",
+			"description": "Steps to reproduce",
+		},
+	}
+
+	t.Run("issue creation includes typed values and retry button", func(t *testing.T) {
+		blocks := buildFailureBlocks(output, "HTTP 404: Not Found", "abc123")
+		if len(blocks) != 3 {
+			t.Fatalf("Expected 3 blocks, got %d", len(blocks))
+		}
+		details, ok := blocks[1].(*slack.SectionBlock)
+		if !ok || !strings.Contains(details.Text.Text, "Steps to reproduce") {
+			t.Errorf("Expected details block to echo the description")
+		}
+		actions, ok := blocks[2].(*slack.ActionBlock)
+		if !ok {
+			t.Fatal("Expected last block to be an ActionBlock")
+		}
+		button, ok := actions.Elements.ElementSet[0].(*slack.ButtonBlockElement)
+		if !ok || button.ActionID != retryFailedCommandActionID || button.Value != "abc123" {
+			t.Errorf("Unexpected retry button: %+v", actions.Elements.ElementSet[0])
+		}
+	})
+
+	t.Run("no retry button without an ID", func(t *testing.T) {
+		blocks := buildFailureBlocks(PoppitOutput{Type: "slash-vibe-issue-project"}, "boom", "")
+		if len(blocks) != 1 {
+			t.Errorf("Expected 1 block, got %d", len(blocks))
+		}
+	})
+}
+
+func TestCreateIssueModalWithOptions(t *testing.T) {
+	modal := createIssueModalWithOptions(issueModalOptions{
+		Title:         "Retry me",
+		Repo:          "org/repo",
+		SanitiseIssue: true,
+	})
+
+	if len(modal.Blocks.BlockSet) != 5 {
+		t.Fatalf("Expected 5 blocks, got %d", len(modal.Blocks.BlockSet))
+	}
+
+	repoBlock, ok := modal.Blocks.BlockSet[1].(*slack.InputBlock)
+	if !ok {
+		t.Fatal("Expected block at index 1 to be an InputBlock")
+	}
+	repoSelect, ok := repoBlock.Element.(*slack.SelectBlockElement)
+	if !ok || repoSelect.InitialOption == nil || repoSelect.InitialOption.Value != "org/repo" {
+		t.Errorf("Expected repository to be pre-selected, got %+v", repoBlock.Element)
+	}
+
+	actionBlock, ok := modal.Blocks.BlockSet[4].(*slack.ActionBlock)
+	if !ok {
+		t.Fatal("Expected block at index 4 to be an ActionBlock")
+	}
+	project := actionBlock.Elements.ElementSet[1].(*slack.CheckboxGroupsBlockElement)
+	if len(project.InitialOptions) != 0 {
+		t.Error("Expected add to project to be unchecked")
+	}
+	sanitise := actionBlock.Elements.ElementSet[2].(*slack.CheckboxGroupsBlockElement)
+	if len(sanitise.InitialOptions) != 1 {
+		t.Error("Expected sanitise issue to be checked")
+	}
+}
+
+func TestLongTextIsCapped(t *testing.T) {
+	long := strings.Repeat("é", 5000)
+
+	// Slack rejects a view whose initial_value is over 3000 characters
+	modal := createIssueModalWithOptions(issueModalOptions{Description: long})
+	descriptionBlock := modal.Blocks.BlockSet[3].(*slack.InputBlock)
+	description := descriptionBlock.Element.(*slack.PlainTextInputBlockElement).InitialValue
+	if n := utf8.RuneCountInString(description); n > 3000 || !utf8.ValidString(description) {
+		t.Errorf("Expected a valid description of at most 3000 characters, got %d", n)
+	}
+
+	rdb := newFakeRedis()
+	config := Config{RedisPoppitList: "poppit:commands"}
+	if err := generateIssueTitleViaCopilot(t.Context(), rdb, long, "alice", "V1", "h1", issueModalOptions{}, config); err != nil {
+		t.Fatalf("generateIssueTitleViaCopilot returned error: %v", err)
+	}
+	commands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(commands) != 1 || len(commands[0].Commands[0]) > maxSummariserInput+100 {
+		t.Errorf("Expected the summariser input to be capped, got %+v", commands)
+	}
+}
+
+func TestGenerateIssueTitleCommandArgs(t *testing.T) {
+	rdb := newFakeRedis()
+	config := Config{RedisPoppitList: "poppit:commands"}
+
+	// The message is the summariser's one argument, whatever it starts with
+	message := "--help is wrong; it's $HOME\n`whoami`"
+	if err := generateIssueTitleViaCopilot(t.Context(), rdb, message, "alice", "V1", "h1", issueModalOptions{}, config); err != nil {
+		t.Fatalf("generateIssueTitleViaCopilot returned error: %v", err)
+	}
+	commands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(commands) != 1 {
+		t.Fatalf("Expected one command, got %+v", commands)
+	}
+	args, err := splitShellWords(commands[0].Commands[0])
+	if err != nil {
+		t.Fatalf("splitShellWords() error = %v", err)
+	}
+	if !reflect.DeepEqual(args, []string{"issue-summariser", message}) {
+		t.Errorf("Expected issue-summariser with the message as its only argument, got %q", args)
+	}
+}
+
+func TestPostToResponseURL(t *testing.T) {
+	var received SlackResponseMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := postToResponseURL(t.Context(), server.URL, SlackResponseMessage{ReplaceOriginal: true, Text: "🔁 Retrying"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !received.ReplaceOriginal || received.Text != "🔁 Retrying" {
+		t.Errorf("Unexpected message: %+v", received)
+	}
+
+	if err := postToResponseURL(t.Context(), "", SlackResponseMessage{}); err == nil {
+		t.Error("Expected error for empty response URL")
+	}
+}
+
+func TestPostToResponseURLTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	timeout := outboundHTTPClient.Timeout
+	outboundHTTPClient.Timeout = 50 * time.Millisecond
+	defer func() { outboundHTTPClient.Timeout = timeout }()
+
+	// A hung endpoint gives up instead of blocking the handler
+	start := time.Now()
+	if err := postToResponseURL(context.Background(), server.URL, SlackResponseMessage{Text: "hello"}); err == nil {
+		t.Error("Expected an error from a hung response URL")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("postToResponseURL took %v, want it cut off by the client timeout", elapsed)
+	}
+}
+
+func TestUsesStream(t *testing.T) {
+	cfg := Config{RedisStreamChannels: []string{"slack-relay-view-submission"}}
+	if !usesStream("slack-relay-view-submission", cfg) {
+		t.Error("Expected view submission channel to use streams")
+	}
+	if usesStream("slack-commands", cfg) {
+		t.Error("Expected slash command channel to default to pub/sub")
+	}
+	if usesStream("slack-commands", Config{}) {
+		t.Error("Expected pub/sub when no stream channels are configured")
+	}
+}
+
+func TestStreamGroupName(t *testing.T) {
+	cfg := Config{RedisStreamGroupPrefix: "slashvibeissue"}
+	if got := streamGroupName("view-submissions", cfg); got != "slashvibeissue:view-submissions" {
+		t.Errorf("streamGroupName() = %q, want %q", got, "slashvibeissue:view-submissions")
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{input: "", expected: nil},
+		{input: "a", expected: []string{"a"}},
+		{input: " a , b ,, c ", expected: []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := parseList(tt.input)
+			if strings.Join(result, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("parseList(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConfigLoaderList(t *testing.T) {
+	t.Run("env var takes precedence", func(t *testing.T) {
+		t.Setenv("TEST_LIST_VAR", "x,y")
+		result := (&configLoader{}).list("TEST_LIST_VAR", []string{"file"}, "default")
+		if strings.Join(result, ",") != "x,y" {
+			t.Errorf("list() = %q, want [x y]", result)
+		}
+	})
+
+	t.Run("file value used when env unset", func(t *testing.T) {
+		t.Setenv("TEST_LIST_VAR", "")
+		result := (&configLoader{}).list("TEST_LIST_VAR", []string{"file"}, "default")
+		if strings.Join(result, ",") != "file" {
+			t.Errorf("list() = %q, want [file]", result)
+		}
+	})
+
+	t.Run("default used when both unset", func(t *testing.T) {
+		t.Setenv("TEST_LIST_VAR", "")
+		result := (&configLoader{}).list("TEST_LIST_VAR", nil, "a, b")
+		if strings.Join(result, ",") != "a,b" {
+			t.Errorf("list() = %q, want [a b]", result)
+		}
+	})
+}
+
+func TestDefaultStreamConsumer(t *testing.T) {
+	if got := defaultStreamConsumer("host-1", nil); got != "host-1" {
+		t.Errorf("defaultStreamConsumer() = %q, want %q", got, "host-1")
+	}
+	if got := defaultStreamConsumer("", fmt.Errorf("no hostname")); !strings.HasPrefix(got, "slashvibeissue-") {
+		t.Errorf("defaultStreamConsumer() = %q, want slashvibeissue- prefix", got)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	t.Run("malformed payload is reported as an error", func(t *testing.T) {
+		if err := handleSlashCommand(t.Context(), nil, nil, `{"invalid json"`, Config{}); err == nil {
+			t.Error("Expected error for malformed slash command payload")
+		}
+		if err := handleGitHubIssueEvent(t.Context(), nil, nil, `{"invalid json"`, Config{}); err == nil {
+			t.Error("Expected error for malformed webhook payload")
+		}
+	})
+
+	t.Run("ignored events are not errors", func(t *testing.T) {
+		if err := handleSlashCommand(t.Context(), nil, nil, `{"command":"/other"}`, Config{}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if err := handleGitHubIssueEvent(t.Context(), nil, nil, `{"action":"opened"}`, Config{}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if err := handleBlockAction(t.Context(), nil, nil, `{"type":"view_closed"}`, Config{}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
+func TestPayloadKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyFn    eventKeyFunc
+		payload  string
+		expected string
+	}{
+		{
+			name:     "reaction event ID",
+			keyFn:    payloadKey("event_id"),
+			payload:  `{"event_id":"Ev123","event":{"type":"reaction_added"}}`,
+			expected: "Ev123",
+		},
+		{
+			name:     "view ID and hash",
+			keyFn:    payloadKey("view.id", "view.hash"),
+			payload:  `{"type":"view_submission","view":{"id":"V1","hash":"h1"}}`,
+			expected: "V1:h1",
+		},
+		{
+			name:     "numeric value",
+			keyFn:    payloadKey("delivery_id"),
+			payload:  `{"delivery_id":12345}`,
+			expected: "12345",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.keyFn(tt.payload); got != tt.expected {
+				t.Errorf("key = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+
+	t.Run("missing path falls back to payload hash", func(t *testing.T) {
+		keyFn := payloadKey("view.id", "view.hash")
+		a := keyFn(`{"view":{"id":"V1"}}`)
+		b := keyFn(`{"view":{"id":"V1"}}`)
+		c := keyFn(`{"view":{"id":"V2"}}`)
+		if !strings.HasPrefix(a, "sha256:") {
+			t.Errorf("Expected sha256 fallback, got %q", a)
+		}
+		if a != b {
+			t.Error("Expected identical payloads to produce the same key")
+		}
+		if a == c {
+			t.Error("Expected different payloads to produce different keys")
+		}
+	})
+
+	t.Run("no paths always hashes", func(t *testing.T) {
+		if got := payloadKey()(`{"type":"slash-vibe-issue"}`); !strings.HasPrefix(got, "sha256:") {
+			t.Errorf("Expected sha256 key, got %q", got)
+		}
+	})
+}
+
+func TestGitHubEventKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		expected string
+	}{
+		{
+			name:     "closed",
+			payload:  `{"action":"closed","issue":{"id":1001,"number":42,"updated_at":"2026-10-16T09:00:00Z"}}`,
+			expected: "closed:1001:2026-10-16T09:00:00Z",
+		},
+		{
+			name:     "assigned",
+			payload:  `{"action":"assigned","assignee":{"login":"octocat"},"issue":{"id":1001,"updated_at":"2026-10-16T09:00:00Z"}}`,
+			expected: "assigned:1001:2026-10-16T09:00:00Z:octocat",
+		},
+		{
+			name:     "labeled",
+			payload:  `{"action":"labeled","label":{"name":"jules"},"issue":{"id":1001,"updated_at":"2026-10-16T09:00:00Z"}}`,
+			expected: "labeled:1001:2026-10-16T09:00:00Z:jules",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gitHubEventKey(tt.payload); got != tt.expected {
+				t.Errorf("key = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+
+	t.Run("missing updated_at falls back to payload hash", func(t *testing.T) {
+		if got := gitHubEventKey(`{"action":"closed","issue":{"id":1001}}`); !strings.HasPrefix(got, "sha256:") {
+			t.Errorf("Expected sha256 key, got %q", got)
+		}
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	cfg := Config{RedisIdempotencyPrefix: "slashvibeissue:seen:"}
+	if got := idempotencyKey("reactions", "Ev123", cfg); got != "slashvibeissue:seen:reactions:Ev123" {
+		t.Errorf("idempotencyKey() = %q", got)
+	}
+}
+
+func TestParseIssueTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		text     string
+		ok       bool
+		expected IssueTemplate
+	}{
+		{
+			name:     "Markdown template with front matter",
+			filename: "bug_report.md",
+			text:     "---\nname: Bug report\nabout: Something is broken\ntitle: \"[Bug] \"\nlabels: bug, needs-triage\nassignees: ''\n---\n\n**Describe the bug**\n",
+			ok:       true,
+			expected: IssueTemplate{
+				Name:   "Bug report",
+				About:  "Something is broken",
+				Title:  "[Bug] ",
+				Body:   "**Describe the bug**",
+				Labels: []string{"bug", "needs-triage"},
+			},
+		},
+		{
+			name:     "Markdown template with list labels and CRLF line endings",
+			filename: "feature.md",
+			text:     "---\r\nname: Feature\r\nlabels: [enhancement]\r\nassignees:\r\n  - octocat\r\n---\r\nWhat do you want?",
+			ok:       true,
+			expected: IssueTemplate{
+				Name:      "Feature",
+				Body:      "What do you want?",
+				Labels:    []string{"enhancement"},
+				Assignees: []string{"octocat"},
+			},
+		},
+		{
+			name:     "Markdown template without front matter is named after the file",
+			filename: "question.md",
+			text:     "Ask away",
+			ok:       true,
+			expected: IssueTemplate{Name: "question", Body: "Ask away"},
+		},
+		{
+			name:     "Issue form",
+			filename: "bug.yml",
+			text: `name: Bug form
+description: File a bug
+title: "[Bug]: "
+labels: ["bug"]
+body:
+  - type: markdown
+    attributes:
+      value: Thanks for taking the time!
+  - type: textarea
+    attributes:
+      label: What happened?
+      value: A bug happened
+  - type: input
+    attributes:
+      label: Version
+  - type: checkboxes
+    attributes:
+      label: Checks
+      options:
+        - label: I searched existing issues
+`,
+			ok: true,
+			expected: IssueTemplate{
+				Name:   "Bug form",
+				About:  "File a bug",
+				Title:  "[Bug]: ",
+				Body:   "### What happened?\n\nA bug happened\n\n### Version\n\n\n\n### Checks\n\n- [ ] I searched existing issues",
+				Labels: []string{"bug"},
+			},
+		},
+		{
+			name:     "Chooser config is skipped",
+			filename: "config.yml",
+			text:     "blank_issues_enabled: false",
+			ok:       false,
+		},
+		{
+			name:     "Unknown file type is skipped",
+			filename: "README.txt",
+			text:     "hello",
+			ok:       false,
+		},
+		{
+			name:     "Unterminated front matter is skipped",
+			filename: "broken.md",
+			text:     "---\nname: Broken\n",
+			ok:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, ok := parseIssueTemplate(tt.filename, tt.text)
+			if ok != tt.ok {
+				t.Fatalf("parseIssueTemplate() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(tmpl, tt.expected) {
+				t.Errorf("parseIssueTemplate() = %+v, want %+v", tmpl, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseRepoDetails(t *testing.T) {
+	t.Run("templates are parsed and sorted by name", func(t *testing.T) {
+		output := `{"data":{"repository":{"issueTemplates":{"entries":[
+			{"name":"feature.md","object":{"text":"---\nname: Feature request\n---\nIdea"}},
+			{"name":"bug.md","object":{"text":"---\nname: Bug report\n---\nBroken"}},
+			{"name":"config.yml","object":{"text":"blank_issues_enabled: true"}},
+			{"name":"nested","object":{}}
+		]}}}}`
+		details, _, err := parseRepoDetails("org/repo", output)
+		if err != nil {
+			t.Fatalf("parseRepoDetails() error = %v", err)
+		}
+		if details.Repo != "org/repo" {
+			t.Errorf("Repo = %q, want %q", details.Repo, "org/repo")
+		}
+		if len(details.Templates) != 2 || details.Templates[0].Name != "Bug report" || details.Templates[1].Name != "Feature request" {
+			t.Errorf("Templates = %+v, want Bug report then Feature request", details.Templates)
+		}
+	})
+
+	t.Run("repository without templates", func(t *testing.T) {
+		details, _, err := parseRepoDetails("org/repo", `{"data":{"repository":{"issueTemplates":null}}}`)
+		if err != nil {
+			t.Fatalf("parseRepoDetails() error = %v", err)
+		}
+		if len(details.Templates) != 0 {
+			t.Errorf("Expected no templates, got %d", len(details.Templates))
+		}
+	})
+
+	t.Run("GraphQL errors are reported", func(t *testing.T) {
+		_, _, err := parseRepoDetails("org/repo", `{"data":{"repository":null},"errors":[{"message":"Could not resolve to a Repository"}]}`)
+		if err == nil || !strings.Contains(err.Error(), "Could not resolve") {
+			t.Errorf("Expected GraphQL error, got %v", err)
+		}
+	})
+
+	t.Run("non-JSON output is an error", func(t *testing.T) {
+		if _, _, err := parseRepoDetails("org/repo", "gh: Not Found"); err == nil {
+			t.Error("Expected an error for non-JSON output")
+		}
+	})
+}
+
+func TestCreateIssueModalWithTemplates(t *testing.T) {
+	templates := []IssueTemplate{
+		{Name: "Bug report", About: "Something is broken"},
+		{Name: "Feature request"},
+	}
+
+	t.Run("picker is added once templates are loaded", func(t *testing.T) {
+		modal := createIssueModalWithOptions(issueModalOptions{Repo: "org/repo", Templates: templates})
+		if len(modal.Blocks.BlockSet) != 6 {
+			t.Fatalf("Expected 6 blocks, got %d", len(modal.Blocks.BlockSet))
+		}
+		picker, ok := modal.Blocks.BlockSet[2].(*slack.ActionBlock)
+		if !ok || picker.BlockID != "template_block" {
+			t.Fatal("Expected template picker at index 2")
+		}
+		selectElement := picker.Elements.ElementSet[0].(*slack.SelectBlockElement)
+		if len(selectElement.Options) != 2 || selectElement.InitialOption != nil {
+			t.Errorf("Expected 2 options and no initial option, got %d options", len(selectElement.Options))
+		}
+		if modal.PrivateMetadata != "" {
+			t.Errorf("Expected empty private_metadata, got %q", modal.PrivateMetadata)
+		}
+	})
+
+	t.Run("selected template shows its defaults", func(t *testing.T) {
+		modal := createIssueModalWithOptions(issueModalOptions{
+			Repo:      "org/repo",
+			Templates: templates,
+			Metadata: IssueModalMetadata{
+				Template:  "Feature request",
+				Labels:    []string{"enhancement"},
+				Assignees: []string{"octocat"},
+			},
+		})
+		if len(modal.Blocks.BlockSet) != 7 {
+			t.Fatalf("Expected 7 blocks, got %d", len(modal.Blocks.BlockSet))
+		}
+		picker := modal.Blocks.BlockSet[2].(*slack.ActionBlock)
+		selectElement := picker.Elements.ElementSet[0].(*slack.SelectBlockElement)
+		if selectElement.InitialOption == nil || selectElement.InitialOption.Value != "1" {
+			t.Errorf("Expected Feature request to be preselected")
+		}
+		defaults, ok := modal.Blocks.BlockSet[3].(*slack.ContextBlock)
+		if !ok || defaults.BlockID != "template_defaults_block" {
+			t.Fatal("Expected template defaults context block at index 3")
+		}
+		metadata := decodeModalMetadata(modal.PrivateMetadata)
+		if metadata.Template != "Feature request" || !reflect.DeepEqual(metadata.Labels, []string{"enhancement"}) {
+			t.Errorf("private_metadata round trip = %+v", metadata)
+		}
+	})
+
+	t.Run("repo select dispatches block actions", func(t *testing.T) {
+		modal := createIssueModal("", "", false)
+		repoBlock := modal.Blocks.BlockSet[1].(*slack.InputBlock)
+		if !repoBlock.DispatchAction {
+			t.Error("Expected repo selection block to dispatch actions")
+		}
+	})
+}
+
+func TestTemplateOption(t *testing.T) {
+	templates := []IssueTemplate{{Name: "Bug"}, {Name: "Feature"}}
+	if tmpl, err := templateOption(templates, "1"); err != nil || tmpl.Name != "Feature" {
+		t.Errorf("templateOption(\"1\") = %+v, %v", tmpl, err)
+	}
+	for _, value := range []string{"", "2", "-1", "Bug"} {
+		if _, err := templateOption(templates, value); err == nil {
+			t.Errorf("templateOption(%q) expected error", value)
+		}
+	}
+}
+
+func TestDecodeModalMetadata(t *testing.T) {
+	if metadata := decodeModalMetadata(""); !reflect.DeepEqual(metadata, IssueModalMetadata{}) {
+		t.Errorf("Expected zero metadata for empty input, got %+v", metadata)
+	}
+	if metadata := decodeModalMetadata("not json"); !reflect.DeepEqual(metadata, IssueModalMetadata{}) {
+		t.Errorf("Expected zero metadata for malformed input, got %+v", metadata)
+	}
+	encoded := encodeModalMetadata(IssueModalMetadata{Template: "Bug", Assignees: []string{"octocat"}})
+	if metadata := decodeModalMetadata(encoded); metadata.Template != "Bug" || metadata.Assignees[0] != "octocat" {
+		t.Errorf("Round trip = %+v", metadata)
+	}
+	if encoded := encodeModalMetadata(IssueModalMetadata{}); encoded != "" {
+		t.Errorf("Expected empty metadata to encode to nothing, got %q", encoded)
+	}
+}
+
+func TestCollectAttachmentsFitMetadata(t *testing.T) {
+	var files []SlackFile
+	for i := range 50 {
+		files = append(files, SlackFile{
+			ID:        fmt.Sprintf("F%d", i),
+			Name:      fmt.Sprintf("screenshot-%d.png", i),
+			Mimetype:  "image/png",
+			Permalink: fmt.Sprintf("https://team.slack.com/files/U789/F%d/screenshot-%d.png", i, i),
+		})
+	}
+	config := Config{AttachmentTypes: []string{"image/*"}}
+
+	attachments := collectAttachments(t.Context(), newFakeSlack(), files, config)
+	if len(attachments) == 0 || len(attachments) == len(files) {
+		t.Fatalf("Expected some but not all of %d attachments, got %d", len(files), len(attachments))
+	}
+	encoded := encodeModalMetadata(IssueModalMetadata{
+		CorrelationID:   "0123456789abcdef",
+		SourceChannel:   "C0123456789",
+		SourceTs:        "1700000000.000100",
+		SourcePermalink: "https://team.slack.com/archives/C0123456789/p1700000000000100",
+		Attachments:     attachments,
+	})
+	if len(encoded) > 3000 {
+		t.Errorf("Expected the modal metadata to fit in 3000 characters, got %d", len(encoded))
+	}
+}
+
+func TestIssueModalOptionsFromView(t *testing.T) {
+	payload := `{
+		"view": {
+			"blocks": [
+				{"block_id": "title_block", "element": {"initial_value": "Preset title"}},
+				{"block_id": "description_block", "element": {"initial_value": "Preset body"}}
+			],
+			"state": {
+				"values": {
+					"repo_selection_block": {"SlashVibeIssue": {"selected_option": {"value": "org/repo"}}},
+					"title_block": {"issue_title": {"value": null}},
+					"description_block": {"issue_description": {"value": "Typed body"}},
+					"assignment_block": {
+						"assign_copilot": {"selected_options": []},
+						"add_to_project": {"selected_options": [{"value": "true"}]}
+					}
+				}
+			}
+		}
+	}`
+
+	var event BlockActionEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	opts := issueModalOptionsFromView(event.View.State.Values, event.View.Blocks)
+	expected := issueModalOptions{
+		Repo:         "org/repo",
+		Title:        "Preset title",
+		Description:  "Typed body",
+		AddToProject: true,
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("issueModalOptionsFromView() = %+v, want %+v", opts, expected)
+	}
+}
+
+func TestParseRepoDetailsFields(t *testing.T) {
+	output := `{"data":{"repository":{
+		"issueTemplates":null,
+		"labels":{"nodes":[{"name":"bug","description":"Something is broken"},{"name":"docs"}]},
+		"assignableUsers":{"nodes":[{"login":"octocat","name":"The Octocat"}]},
+		"milestones":{"nodes":[{"title":"v1.0","number":1}]}
+	}}}`
+
+	details, _, err := parseRepoDetails("org/repo", output)
+	if err != nil {
+		t.Fatalf("parseRepoDetails() error = %v", err)
+	}
+
+	expected := RepoDetails{
+		Repo:       "org/repo",
+		Labels:     []RepoLabel{{Name: "bug", Description: "Something is broken"}, {Name: "docs"}},
+		Assignees:  []RepoUser{{Login: "octocat", Name: "The Octocat"}},
+		Milestones: []RepoMilestone{{Title: "v1.0", Number: 1}},
+	}
+	if !reflect.DeepEqual(details, expected) {
+		t.Errorf("parseRepoDetails() = %+v, want %+v", details, expected)
+	}
+}
+
+func TestRepoDetailsPaging(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := Config{RedisPoppitList: "poppit:commands", RedisRepoDetailsPrefix: "details:", RepoDetailsTTL: 3600}
+
+	labelPage := func(from, to int) string {
+		var nodes []string
+		for i := from; i < to; i++ {
+			nodes = append(nodes, fmt.Sprintf(`{"name":"label-%03d"}`, i))
+		}
+		return strings.Join(nodes, ",")
+	}
+
+	if err := requestRepoDetails(ctx, rdb, "V1", "U123", issueModalOptions{Repo: "org/repo"}, config); err != nil {
+		t.Fatalf("requestRepoDetails() error = %v", err)
+	}
+	first := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(first) != 1 || !strings.Contains(first[0].Commands[0], "-F templates=true -F labels=true") {
+		t.Fatalf("Expected a request for the first page of everything, got %+v", first)
+	}
+
+	// Only the labels have a second page
+	output := `{"data":{"repository":{"issueTemplates":null,
+		"labels":{"totalCount":150,"pageInfo":{"hasNextPage":true,"endCursor":"L100"},"nodes":[` + labelPage(0, 100) + `]},
+		"assignableUsers":{"totalCount":1,"pageInfo":{"hasNextPage":false,"endCursor":"A1"},"nodes":[{"login":"octocat"}]},
+		"milestones":{"totalCount":0,"pageInfo":{"hasNextPage":false,"endCursor":null},"nodes":[]}
+	}}}`
+	if err := handlePoppitOutput(ctx, rdb, slackClient, poppitOutputFor(t, first[0], output), config); err != nil {
+		t.Fatalf("handlePoppitOutput() error = %v", err)
+	}
+	if len(slackClient.updatedViews) != 0 {
+		t.Errorf("Expected the modal to wait for the last page, got %d updates", len(slackClient.updatedViews))
+	}
+	second := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(second) != 1 {
+		t.Fatalf("Expected a request for the next page, got %d commands", len(second))
+	}
+	for _, want := range []string{"-F templates=false -F labels=true -F assignees=false -F milestones=false", "-f labelsAfter=L100"} {
+		if !strings.Contains(second[0].Commands[0], want) {
+			t.Errorf("Expected the next page command to contain %q, got %s", want, second[0].Commands[0])
+		}
+	}
+
+	output = `{"data":{"repository":{
+		"labels":{"totalCount":150,"pageInfo":{"hasNextPage":false,"endCursor":"L150"},"nodes":[` + labelPage(100, 150) + `]}
+	}}}`
+	if err := handlePoppitOutput(ctx, rdb, slackClient, poppitOutputFor(t, second[0], output), config); err != nil {
+		t.Fatalf("handlePoppitOutput() error = %v", err)
+	}
+	if commands := rdb.popPoppitCommands(t, config.RedisPoppitList); len(commands) != 0 {
+		t.Errorf("Expected no more pages, got %+v", commands)
+	}
+	details, _, _ := loadRepoDetails(ctx, rdb, "V1", config)
+	if len(details.Labels) != 150 || details.Labels[149].Name != "label-149" || len(details.Assignees) != 1 {
+		t.Errorf("Expected 150 labels and 1 assignee cached, got %d and %d", len(details.Labels), len(details.Assignees))
+	}
+	if len(slackClient.updatedViews) != 1 {
+		t.Fatalf("Expected the modal to be updated once, got %d updates", len(slackClient.updatedViews))
+	}
+	groups := -1
+	for _, block := range slackClient.updatedViews[0].Blocks.BlockSet {
+		if input, ok := block.(*slack.InputBlock); ok && input.BlockID == "labels_block" {
+			groups = len(input.Element.(*slack.MultiSelectBlockElement).OptionGroups)
+		}
+	}
+	if groups != 2 {
+		t.Errorf("Expected the labels in 2 option groups, got %d", groups)
+	}
+}
+
+func TestIssueFieldBlocksLongLists(t *testing.T) {
+	var labels []RepoLabel
+	for i := 0; i < 250; i++ {
+		labels = append(labels, RepoLabel{Name: fmt.Sprintf("label-%03d", i)})
+	}
+	opts := issueModalOptions{Repo: "org/repo"}
+	opts.setRepoDetails(RepoDetails{Labels: labels, LabelsTotal: 400, Milestones: []RepoMilestone{{Title: "v1.0"}}, MilestonesTotal: 1})
+	opts.Metadata.Labels = []string{"label-200"}
+
+	blocks := issueFieldBlocks(opts)
+	block := blocks[0].(*slack.InputBlock)
+	labelSelect := block.Element.(*slack.MultiSelectBlockElement)
+	if len(labelSelect.Options) != 0 || len(labelSelect.OptionGroups) != 3 {
+		t.Fatalf("Expected 3 option groups and no options, got %d groups and %d options", len(labelSelect.OptionGroups), len(labelSelect.Options))
+	}
+	if got := labelSelect.OptionGroups[2].Label.Text; got != "label-200 – label-249" {
+		t.Errorf("Last group label = %q", got)
+	}
+	if len(labelSelect.InitialOptions) != 1 || labelSelect.InitialOptions[0].Value != "label-200" {
+		t.Errorf("Expected label-200 to be preselected from its group")
+	}
+	if block.Hint == nil || !strings.Contains(block.Hint.Text, "first 250 of 400 labels") {
+		t.Errorf("Expected a hint about the missing labels, got %+v", block.Hint)
+	}
+	if milestone := blocks[1].(*slack.InputBlock); milestone.Hint != nil {
+		t.Errorf("Expected no hint when every milestone is listed, got %q", milestone.Hint.Text)
+	}
+}
+
+func TestIssueFieldBlocks(t *testing.T) {
+	opts := issueModalOptions{Repo: "org/repo"}
+	opts.setRepoDetails(RepoDetails{
+		Labels:     []RepoLabel{{Name: "bug"}, {Name: "docs"}},
+		Assignees:  []RepoUser{{Login: "octocat", Name: "The Octocat"}, {Login: "hubot"}},
+		Milestones: []RepoMilestone{{Title: "v1.0"}, {Title: "v2.0"}},
+	})
+	opts.Metadata = IssueModalMetadata{
+		Labels:    []string{"docs", "missing"},
+		Assignees: []string{"hubot"},
+		Milestone: "v2.0",
+	}
+
+	blocks := issueFieldBlocks(opts)
+	if len(blocks) != 3 {
+		t.Fatalf("Expected 3 blocks, got %d", len(blocks))
+	}
+
+	labels := blocks[0].(*slack.InputBlock)
+	labelSelect := labels.Element.(*slack.MultiSelectBlockElement)
+	if labels.BlockID != "labels_block" || !labels.Optional || labelSelect.ActionID != issueLabelsActionID {
+		t.Errorf("Unexpected labels block %+v", labels)
+	}
+	if len(labelSelect.InitialOptions) != 1 || labelSelect.InitialOptions[0].Value != "docs" {
+		t.Errorf("Expected only the existing template label to be preselected")
+	}
+
+	assignees := blocks[1].(*slack.InputBlock)
+	assigneeSelect := assignees.Element.(*slack.MultiSelectBlockElement)
+	if assigneeSelect.Options[0].Text.Text != "octocat (The Octocat)" {
+		t.Errorf("Assignee option text = %q", assigneeSelect.Options[0].Text.Text)
+	}
+	if len(assigneeSelect.InitialOptions) != 1 || assigneeSelect.InitialOptions[0].Value != "hubot" {
+		t.Errorf("Expected hubot to be preselected")
+	}
+
+	milestone := blocks[2].(*slack.InputBlock)
+	milestoneSelect := milestone.Element.(*slack.SelectBlockElement)
+	if milestoneSelect.InitialOption == nil || milestoneSelect.InitialOption.Value != "v2.0" {
+		t.Errorf("Expected v2.0 milestone to be preselected")
+	}
+
+	// With pickers present the defaults context block is not repeated
+	if extra := templateBlocks(opts); len(extra) != 0 {
+		t.Errorf("Expected no defaults block when pickers are shown, got %d blocks", len(extra))
+	}
+
+	if blocks := issueFieldBlocks(issueModalOptions{}); len(blocks) != 0 {
+		t.Errorf("Expected no field blocks before the repo is loaded, got %d", len(blocks))
+	}
+}
+
+func TestApplyModalSelections(t *testing.T) {
+	defaults := IssueModalMetadata{
+		Template:  "Bug report",
+		Labels:    []string{"bug"},
+		Assignees: []string{"octocat"},
+		Milestone: "v1.0",
+	}
+
+	t.Run("without pickers the metadata is kept", func(t *testing.T) {
+		got := applyModalSelections(defaults, map[string]map[string]interface{}{})
+		if !reflect.DeepEqual(got, defaults) {
+			t.Errorf("applyModalSelections() = %+v, want %+v", got, defaults)
+		}
+	})
+
+	t.Run("picker selections replace the metadata", func(t *testing.T) {
+		var values map[string]map[string]interface{}
+		err := json.Unmarshal([]byte(`{
+			"labels_block": {"issue_labels": {"type": "multi_static_select", "selected_options": [{"value": "docs"}, {"value": "good first issue"}]}},
+			"assignees_block": {"issue_assignees": {"type": "multi_static_select", "selected_options": []}},
+			"milestone_block": {"issue_milestone": {"type": "static_select", "selected_option": null}}
+		}`), &values)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+
+		got := applyModalSelections(defaults, values)
+		expected := IssueModalMetadata{
+			Template: "Bug report",
+			Labels:   []string{"docs", "good first issue"},
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("applyModalSelections() = %+v, want %+v", got, expected)
+		}
+	})
+}
+
+func TestBuildConfirmationMessageWithIssueFields(t *testing.T) {
+	cfg := Config{GitHubOrg: "my-org", ConfirmationChannelID: "CCHAN"}
+
+	msg := buildConfirmationMessage(IssueConfirmation{
+		Repo:      "my-repo",
+		Title:     "Fix the bug",
+		Username:  "alice",
+		IssueURL:  "https://github.com/my-org/my-repo/issues/42",
+		Labels:    []string{"bug", "p1"},
+		Assignees: []string{"octocat"},
+		Milestone: "v1.0",
+	}, cfg)
+
+	if !strings.HasSuffix(msg.Text, "\n*Labels:* bug, p1\n*Assignees:* octocat\n*Milestone:* v1.0") {
+		t.Errorf("Text = %q, expected labels, assignees and milestone lines", msg.Text)
+	}
+	payload := msg.Metadata["event_payload"].(map[string]interface{})
+	if !reflect.DeepEqual(payload["labels"], []string{"bug", "p1"}) {
+		t.Errorf("labels = %v", payload["labels"])
+	}
+	if !reflect.DeepEqual(payload["assignees"], []string{"octocat"}) {
+		t.Errorf("assignees = %v", payload["assignees"])
+	}
+	if payload["milestone"] != "v1.0" {
+		t.Errorf("milestone = %v", payload["milestone"])
+	}
+}
+
+func TestNormaliseGitHubLogin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		valid    bool
+	}{
+		{"octocat", "octocat", true},
+		{"@octocat", "octocat", true},
+		{"  mona-lisa ", "mona-lisa", true},
+		{"a", "a", true},
+		{"-octocat", "", false},
+		{"octocat-", "", false},
+		{"octo--cat", "", false},
+		{"octo cat", "", false},
+		{"octocat; rm -rf /", "", false},
+		{"", "", false},
+		{strings.Repeat("a", 40), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			login, err := normaliseGitHubLogin(tt.input)
+			if (err == nil) != tt.valid {
+				t.Fatalf("normaliseGitHubLogin(%q) error = %v, valid = %v", tt.input, err, tt.valid)
+			}
+			if login != tt.expected {
+				t.Errorf("normaliseGitHubLogin(%q) = %q, want %q", tt.input, login, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRequestedByFooter(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		login    string
+		username string
+		expected string
+	}{
+		{"linked user", "Steps to reproduce", "octocat", "alice", "Steps to reproduce\n\n---\nRequested by @octocat via Slack"},
+		{"unlinked user is not mentioned", "Steps\n", "", "alice", "Steps\n\n---\nRequested by Slack user alice"},
+		{"empty body", "", "octocat", "alice", "Requested by @octocat via Slack"},
+		{"no requester", "Body", "", "", "Body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := appendFooter(tt.body, requestedByFooter(tt.login, tt.username))
+			if got != tt.expected {
+				t.Errorf("body = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUploadAttachmentSizeLimit(t *testing.T) {
+	uploads := 0
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+	}))
+	defer storage.Close()
+
+	slackClient := newFakeSlack()
+	slackClient.files = map[string]string{
+		"https://files.slack.com/F1/download/small.txt": "fits",
+		"https://files.slack.com/F2/download/liar.txt":  strings.Repeat("x", 64),
+	}
+	config := Config{AttachmentUploadURL: storage.URL, AttachmentMaxBytes: 16}
+
+	if _, err := uploadAttachment(t.Context(), slackClient, SlackFile{ID: "F1", Name: "small.txt", URLPrivateDownload: "https://files.slack.com/F1/download/small.txt"}, config); err != nil {
+		t.Errorf("uploadAttachment returned error for a small file: %v", err)
+	}
+
+	// Slack said the file was small; the download is cut off at the limit
+	_, err := uploadAttachment(t.Context(), slackClient, SlackFile{ID: "F2", Name: "liar.txt", Size: 4, URLPrivateDownload: "https://files.slack.com/F2/download/liar.txt"}, config)
+	if err == nil || !strings.Contains(err.Error(), "over the 16 byte limit") {
+		t.Errorf("Expected a size limit error, got %v", err)
+	}
+	if uploads != 1 {
+		t.Errorf("Expected only the small file to be uploaded, got %d uploads", uploads)
+	}
+}
+
+func TestSourceFooter(t *testing.T) {
+	const permalink = "https://example.slack.com/archives/C0123456789/p1700000000000100"
+	tests := []struct {
+		name      string
+		template  string
+		permalink string
+		expected  string
+	}{
+		{"default template", "Source: {{.Permalink}}", permalink, "Source: " + permalink},
+		{"custom template", "💬 [Slack discussion]({{.Permalink}}) in <#{{.ChannelID}}>, reported by {{.Username}}", permalink,
+			"💬 [Slack discussion](" + permalink + ") in <#C0123456789>, reported by alice"},
+		{"not created from a message", "Source: {{.Permalink}}", "", ""},
+		{"broken template falls back to a link", "Source: {{.Link}}", permalink, "Source: " + permalink},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := IssueRequest{SourcePermalink: tt.permalink, SourceChannel: "C0123456789", Username: "alice"}
+			got := sourceFooter(t.Context(), req, Config{IssueSourceFooter: tt.template})
+			if got != tt.expected {
+				t.Errorf("footer = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLinkGitHubCommandResponds(t *testing.T) {
+	var got SlackResponseMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Failed to decode response message: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	config := Config{RedisGitHubLoginsKey: "logins", GitHubLinkAdmins: []string{"UADMIN"}}
+	tests := []struct {
+		name    string
+		userID  string
+		args    string
+		message string
+		linked  map[string]string
+	}{
+		// Anyone could claim anyone's login, so only admins link
+		{name: "non-admin", userID: "U123", args: "octocat", message: "Only GitHub link admins can link accounts. Ask <@UADMIN>"},
+		{name: "non-admin for another user", userID: "U123", args: "<@U456|bob> octocat", message: "Only GitHub link admins"},
+		{name: "invalid login", userID: "UADMIN", args: "-bad-", message: "not a valid GitHub login"},
+		{name: "not a mention", userID: "UADMIN", args: "bob octocat", message: "is not a Slack user mention"},
+		{name: "too many args", userID: "UADMIN", args: "not a login", message: "Usage: `/issue link-github [@user] <login>`"},
+		{name: "admin links themselves", userID: "UADMIN", args: "@admin-login", message: "Linked your Slack account to GitHub user *admin-login*",
+			linked: map[string]string{"UADMIN": "admin-login"}},
+		{name: "admin links another user", userID: "UADMIN", args: "<@U456|bob> octocat", message: "Linked <@U456> to GitHub user *octocat*",
+			linked: map[string]string{"U456": "octocat"}},
+		{name: "unlinked non-admin asks an admin", userID: "U123", args: "", message: "Ask <@UADMIN> to link it with `/issue link-github @you <login>`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = SlackResponseMessage{}
+			rdb := newFakeRedis()
+			cmd := SlackCommand{UserID: tt.userID, ResponseURL: server.URL}
+			if err := handleLinkGitHubCommand(t.Context(), rdb, cmd, tt.args, config); err != nil {
+				t.Fatalf("handleLinkGitHubCommand() error = %v", err)
+			}
+			if got.ResponseType != "ephemeral" || !strings.Contains(got.Text, tt.message) {
+				t.Errorf("Response = %+v, want it to contain %q", got, tt.message)
+			}
+			if linked := rdb.hashes[config.RedisGitHubLoginsKey]; len(linked) != len(tt.linked) || (len(tt.linked) > 0 && !reflect.DeepEqual(linked, tt.linked)) {
+				t.Errorf("Linked logins = %v, want %v", linked, tt.linked)
+			}
+		})
+	}
+}
+
+func TestBuildConfirmationMessageWithGitHubLogin(t *testing.T) {
+	msg := buildConfirmationMessage(IssueConfirmation{
+		Repo:        "org/repo",
+		Title:       "Fix it",
+		Username:    "alice",
+		IssueURL:    "https://github.com/org/repo/issues/1",
+		GitHubLogin: "octocat",
+	}, Config{})
+
+	if !strings.HasPrefix(msg.Text, "✅ *GitHub Issue Created by @alice (GitHub: octocat)*") {
+		t.Errorf("Text = %q", msg.Text)
+	}
+	payload := msg.Metadata["event_payload"].(map[string]interface{})
+	if payload["github_login"] != "octocat" {
+		t.Errorf("github_login = %v, want octocat", payload["github_login"])
+	}
+}
+
+func TestLookupSubcommand(t *testing.T) {
+	tests := []struct {
+		text     string
+		name     string
+		args     string
+		expected bool
+	}{
+		{"help", "help", "", true},
+		{"LIST my-repo", "list", "my-repo", true},
+		{"assign https://github.com/org/repo/issues/1   copilot ", "assign", "https://github.com/org/repo/issues/1   copilot", true},
+		{"link-github @octocat", "link-github", "@octocat", true},
+		{"link-github <@U456|bob> octocat", "link-github", "<@U456|bob> octocat", true},
+		{"close <https://github.com/org/repo/issues/1>", "close", "<https://github.com/org/repo/issues/1>", true},
+		{"close", "close", "", true},
+		{"search -label:bug login", "search", "-label:bug login", true},
+		{"", "", "", false},
+		{"Fix the login page", "", "", false},
+		{":sparkles:", "", "", false},
+		// Titles that start with a subcommand name
+		{"close button is broken", "", "", false},
+		{"help page has a typo", "", "", false},
+		{"list view is empty", "", "", false},
+		{"assign to me does nothing", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			sub, args, ok := lookupSubcommand(tt.text)
+			if ok != tt.expected {
+				t.Fatalf("lookupSubcommand(%q) ok = %v, want %v", tt.text, ok, tt.expected)
+			}
+			if sub.Name != tt.name || args != tt.args {
+				t.Errorf("lookupSubcommand(%q) = (%q, %q), want (%q, %q)", tt.text, sub.Name, args, tt.name, tt.args)
+			}
+		})
+	}
+}
+
+func TestSubcommandHelp(t *testing.T) {
+	help := subcommandHelp()
+	for _, sub := range subcommands() {
+		if sub.Handle == nil {
+			t.Errorf("Subcommand %s has no handler", sub.Name)
+		}
+		if !strings.Contains(help, sub.Usage) {
+			t.Errorf("Help text is missing %q", sub.Usage)
+		}
+	}
+}
+
+func TestSubcommandUsageErrors(t *testing.T) {
+	var got SlackResponseMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Failed to decode response message: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	// Invalid arguments are answered before anything is sent to Redis or Slack
+	tests := []struct {
+		text    string
+		message string
+	}{
+		{"list", "Usage: `/issue list <repo>`"},
+		{"list bad;repo", "is not a valid repository"},
+		{"close", "Usage: `/issue close <issue-url>`"},
+		{"assign https://github.com/org/repo/issues/1", "Please give an issue URL and an assignee"},
+		{"assign https://github.com/org/repo/issues/1 -bad-", "is not copilot, jules or a GitHub login"},
+		{"search", "Please give a search query"},
+		{"preset nope", "Unknown preset `nope`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got = SlackResponseMessage{}
+			sub, args, ok := lookupSubcommand(tt.text)
+			if !ok {
+				t.Fatalf("lookupSubcommand(%q) found nothing", tt.text)
+			}
+			cmd := SlackCommand{UserID: "U123", ResponseURL: server.URL}
+			if err := sub.Handle(t.Context(), nil, nil, cmd, args, Config{GitHubOrg: "org"}); err != nil {
+				t.Fatalf("Handle() error = %v", err)
+			}
+			if got.ResponseType != "ephemeral" || !strings.Contains(got.Text, tt.message) {
+				t.Errorf("Response = %+v, want it to contain %q", got, tt.message)
+			}
+		})
+	}
+}
+
+func TestSearchSubcommandQuery(t *testing.T) {
+	rdb := newFakeRedis()
+	config := Config{GitHubOrg: "org", RedisPoppitList: "poppit:commands"}
+	cmd := SlackCommand{UserID: "U123", ResponseURL: "https://hooks.slack.com/commands/1"}
+	if err := handleSearchSubcommand(t.Context(), rdb, nil, cmd, "-label:bug login", config); err != nil {
+		t.Fatalf("handleSearchSubcommand returned error: %v", err)
+	}
+
+	// A query starting with "-" must not be read as a gh flag
+	commands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	want := "gh search issues --limit 10 --json number,title,url,repository --owner org -- '-label:bug login'"
+	if len(commands) != 1 || commands[0].Commands[0] != want {
+		t.Errorf("Expected command %q, got %+v", want, commands)
+	}
+}
+
+func TestFormatSubcommandOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   PoppitOutput
+		expected string
+	}{
+		{
+			name: "list",
+			output: PoppitOutput{
+				Type:     "slash-vibe-issue-list",
+				Metadata: map[string]interface{}{"repo": "org/repo"},
+				Output:   `[{"number":3,"title":"Fix <script> & stuff","url":"https://github.com/org/repo/issues/3"}]`,
+			},
+			expected: "*Open issues in org/repo:*\n• <https://github.com/org/repo/issues/3|#3> Fix &lt;script&gt; &amp; stuff",
+		},
+		{
+			name: "empty list",
+			output: PoppitOutput{
+				Type:     "slash-vibe-issue-list",
+				Metadata: map[string]interface{}{"repo": "org/repo"},
+				Output:   "[]\n",
+			},
+			expected: "No open issues in *org/repo*.",
+		},
+		{
+			name: "search",
+			output: PoppitOutput{
+				Type:     "slash-vibe-issue-search",
+				Metadata: map[string]interface{}{"query": "login"},
+				Output:   `[{"number":7,"title":"Login fails","url":"https://github.com/org/app/issues/7","repository":{"nameWithOwner":"org/app"}}]`,
+			},
+			expected: "*Issues matching* `login`*:*\n• <https://github.com/org/app/issues/7|org/app#7> Login fails",
+		},
+		{
+			name: "close",
+			output: PoppitOutput{
+				Type:     "slash-vibe-issue-close",
+				Metadata: map[string]interface{}{"issueURL": "https://github.com/org/repo/issues/3"},
+				Output:   "✓ Closed issue org/repo#3",
+			},
+			expected: "✅ Closed https://github.com/org/repo/issues/3",
+		},
+		{
+			name: "assign user",
+			output: PoppitOutput{
+				Type:     "slash-vibe-issue-assign-user",
+				Metadata: map[string]interface{}{"issueURL": "https://github.com/org/repo/issues/3", "assignee": "octocat"},
+			},
+			expected: "✅ Assigned https://github.com/org/repo/issues/3 to octocat",
+		},
+		{
+			name: "failure",
+			output: PoppitOutput{
+				Type:   "slash-vibe-issue-close",
+				Stderr: "GraphQL: Could not resolve to an issue",
+			},
+			expected: "❌ Command failed:\n```GraphQL: Could not resolve to an issue```",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatSubcommandOutput(tt.output)
+			if err != nil {
+				t.Fatalf("formatSubcommandOutput() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("formatSubcommandOutput() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFindPreset(t *testing.T) {
+	presets := defaultPresets()
+	for _, key := range []string{"copilot-instructions", "Copilot-Instructions"} {
+		preset, ok := findPreset(presets, key)
+		if !ok || !preset.AssignToCopilot || preset.Title != "✨ Set up Copilot instructions" {
+			t.Errorf("findPreset(%q) = %+v, %v", key, preset, ok)
+		}
+	}
+	if _, ok := findPreset(presets, "unknown"); ok {
+		t.Error("Expected no preset for unknown name")
+	}
+	if _, ok := findPreset(presets, ""); ok {
+		t.Error("Expected no preset for empty name")
+	}
+}
+
+func TestMatchPresetTrigger(t *testing.T) {
+	presets := []issuePreset{
+		{Name: "copilot-instructions", Trigger: ":sparkles:"},
+		{Name: "bug", Trigger: "bug"},
+		{Name: "untriggered"},
+	}
+
+	tests := []struct {
+		text     string
+		expected string
+		rest     string
+	}{
+		{":sparkles:", "copilot-instructions", ""},
+		{"bug Login is broken", "bug", "Login is broken"},
+		{"bug", "bug", ""},
+		{"bugs in the login page", "", ""},
+		{"Fix the build", "", ""},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		preset, rest, ok := matchPresetTrigger(presets, tt.text)
+		if ok != (tt.expected != "") || preset.Name != tt.expected || rest != tt.rest {
+			t.Errorf("matchPresetTrigger(%q) = %q, %q, %v; want %q, %q", tt.text, preset.Name, rest, ok, tt.expected, tt.rest)
+		}
+	}
+}
+
+func TestPresetModalOptions(t *testing.T) {
+	noProject := false
+	preset := issuePreset{
+		Name:          "bug",
+		Title:         "🐛 {{.Text}}",
+		Body:          "Reported by {{.Username}} in #{{.ChannelName}} on {{.Date}}.",
+		Repo:          "org/repo",
+		Labels:        []string{"bug"},
+		AddToProject:  &noProject,
+		SanitiseIssue: true,
+	}
+	data := presetData{Text: "Login is broken", Username: "alice", ChannelName: "support", Date: "2026-01-02"}
+
+	opts, err := preset.modalOptions(data)
+	if err != nil {
+		t.Fatalf("modalOptions() error = %v", err)
+	}
+	expected := issueModalOptions{
+		Title:         "🐛 Login is broken",
+		Description:   "Reported by alice in #support on 2026-01-02.",
+		Repo:          "org/repo",
+		SanitiseIssue: true,
+		Metadata:      IssueModalMetadata{Labels: []string{"bug"}},
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("modalOptions() = %+v, want %+v", opts, expected)
+	}
+
+	// Without a title template the trigger text is the title, and issues are
+	// added to the project by default
+	opts, err = issuePreset{Name: "plain"}.modalOptions(data)
+	if err != nil {
+		t.Fatalf("modalOptions() error = %v", err)
+	}
+	if opts.Title != "Login is broken" || !opts.AddToProject {
+		t.Errorf("modalOptions() = %+v, want trigger text title added to project", opts)
+	}
+
+	if _, err := (issuePreset{Name: "bad", Body: "{{.Missing}}"}).modalOptions(data); err == nil {
+		t.Error("Expected error for unknown template field")
+	}
+}
+
+func TestLoadPresets(t *testing.T) {
+	if presets, problems := loadPresets(nil); len(presets) != 1 || presets[0].Trigger != ":sparkles:" || len(problems) != 0 {
+		t.Errorf("loadPresets(nil) = %+v, %v, want the default preset", presets, problems)
+	}
+
+	presets, problems := loadPresets([]issuePreset{
+		{Name: "bug", Trigger: "bug", Title: "🐛 {{.Text}}"},
+		{Trigger: "unnamed"},
+		{Name: "broken", Body: "{{.Text"},
+		{Name: "listing", Trigger: "list"},
+	})
+	if len(presets) != 2 || presets[0].Name != "bug" || presets[1].Name != "listing" {
+		t.Errorf("loadPresets() = %+v, want the bug and listing presets", presets)
+	}
+	var messages []string
+	for _, problem := range problems {
+		messages = append(messages, problem.Error())
+	}
+	want := []string{
+		"presets: preset 2 has no name",
+		"presets: preset broken: invalid body template: template: body:1: unclosed action",
+		`presets: preset listing trigger "list" is shadowed by the /issue list subcommand`,
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("loadPresets() problems = %q, want %q", messages, want)
+	}
+}
+
+func TestRepoFromIssueURL(t *testing.T) {
+	if repo := repoFromIssueURL("https://github.com/org/repo/issues/1"); repo != "org/repo" {
+		t.Errorf("repoFromIssueURL() = %q, want org/repo", repo)
+	}
+	if repo := repoFromIssueURL("not-a-url"); repo != "" {
+		t.Errorf("repoFromIssueURL() = %q, want empty", repo)
+	}
+}
+
+func TestDuplicateSearchQuery(t *testing.T) {
+	tests := []struct {
+		title    string
+		expected string
+	}{
+		{"Login button is broken on Safari", "login OR button OR broken OR safari in:title"},
+		{"Fix: the API returns 500 for /users when the cache is cold", "fix OR api OR returns OR 500 OR users in:title"},
+		{"Crash, crash, CRASH", "crash in:title"},
+		{"a to of", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := duplicateSearchQuery(tt.title); got != tt.expected {
+			t.Errorf("duplicateSearchQuery(%q) = %q, want %q", tt.title, got, tt.expected)
+		}
+	}
+}
+
+func TestLikelyDuplicates(t *testing.T) {
+	candidates := []issueSummary{
+		{Number: 1, Title: "Safari: login broken"},
+		{Number: 2, Title: "Login button is broken on Safari"},
+		{Number: 3, Title: "Add dark mode"},
+		{Number: 4, Title: "Login page is slow"},
+	}
+
+	duplicates := likelyDuplicates("Login button broken in Safari", candidates)
+
+	var numbers []int
+	for _, issue := range duplicates {
+		numbers = append(numbers, issue.Number)
+	}
+	if !reflect.DeepEqual(numbers, []int{2, 1}) {
+		t.Errorf("likelyDuplicates() = %v, want [2 1]", numbers)
+	}
+
+	if duplicates := likelyDuplicates("Add dark mode", nil); len(duplicates) != 0 {
+		t.Errorf("likelyDuplicates() with no candidates = %v, want none", duplicates)
+	}
+}
+
+func TestBuildDuplicateBlocks(t *testing.T) {
+	duplicates := []issueSummary{
+		{Number: 7, Title: "Login broken", URL: "https://github.com/org/repo/issues/7"},
+	}
+
+	blocks := buildDuplicateBlocks("pending123", "org/repo", "Login <broken>", duplicates)
+	if len(blocks) != 3 {
+		t.Fatalf("Expected 3 blocks, got %d", len(blocks))
+	}
+
+	intro := blocks[0].(*slack.SectionBlock)
+	if !strings.Contains(intro.Text.Text, "Login &lt;broken&gt;") || !strings.Contains(intro.Text.Text, "org/repo") {
+		t.Errorf("Unexpected intro text: %q", intro.Text.Text)
+	}
+
+	duplicate := blocks[1].(*slack.SectionBlock)
+	if duplicate.Accessory == nil || duplicate.Accessory.ButtonElement == nil {
+		t.Fatal("Expected a comment button on the duplicate")
+	}
+	comment := duplicate.Accessory.ButtonElement
+	if comment.ActionID != commentOnExistingActionID || comment.Value != "pending123 https://github.com/org/repo/issues/7" {
+		t.Errorf("Unexpected comment button: %+v", comment)
+	}
+
+	actions := blocks[2].(*slack.ActionBlock)
+	create := actions.Elements.ElementSet[0].(*slack.ButtonBlockElement)
+	if create.ActionID != createIssueAnywayActionID || create.Value != "pending123" {
+		t.Errorf("Unexpected create button: %+v", create)
+	}
+}
+
+func TestDuplicateCommentBody(t *testing.T) {
+	req := IssueRequest{Title: "Login broken", Description: "  Steps to reproduce\n"}
+	if got := duplicateCommentBody(req); got != "**Login broken**\n\nSteps to reproduce" {
+		t.Errorf("duplicateCommentBody() = %q", got)
+	}
+	if got := duplicateCommentBody(IssueRequest{Title: "Login broken"}); got != "**Login broken**" {
+		t.Errorf("duplicateCommentBody() without description = %q", got)
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	handle := instrumentHandler("test-instrument", func(ctx context.Context, payload string) error {
+		switch payload {
+		case "ignore":
+			ignoreEvent(ctx)
+		case "fail":
+			return fmt.Errorf("boom")
+		}
+		return nil
+	})
+
+	for _, payload := range []string{"ok", "ok", "ignore", "fail"} {
+		_ = handle(t.Context(), payload)
+	}
+
+	expected := map[string]float64{
+		outcomeReceived:  4,
+		outcomeSucceeded: 2,
+		outcomeIgnored:   1,
+		outcomeFailed:    1,
+	}
+	for outcome, want := range expected {
+		if got := eventsTotal.get("test-instrument", outcome); got != want {
+			t.Errorf("events_total{outcome=%q} = %v, want %v", outcome, got, want)
+		}
+	}
+
+	// ignoreEvent is a no-op outside an instrumented handler
+	ignoreEvent(t.Context())
+}
+
+func TestHistogramWrite(t *testing.T) {
+	h := newHistogramVec("test_duration_seconds", "Test latency.", "method")
+	h.observe("chat.postMessage", 0.07)
+	h.observe("chat.postMessage", 0.3)
+	h.observe("chat.postMessage", 500)
+
+	var out strings.Builder
+	h.write(&out)
+	text := out.String()
+
+	for _, line := range []string{
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{method="chat.postMessage",le="0.05"} 0`,
+		`test_duration_seconds_bucket{method="chat.postMessage",le="0.1"} 1`,
+		`test_duration_seconds_bucket{method="chat.postMessage",le="0.5"} 2`,
+		`test_duration_seconds_bucket{method="chat.postMessage",le="120"} 2`,
+		`test_duration_seconds_bucket{method="chat.postMessage",le="+Inf"} 3`,
+		`test_duration_seconds_sum{method="chat.postMessage"} 500.37`,
+		`test_duration_seconds_count{method="chat.postMessage"} 3`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("Missing %q in:\n%s", line, text)
+		}
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	got := formatLabels([]string{"handler", "outcome"}, []string{`a"b\c`, "line\nbreak"})
+	want := `handler="a\"b\\c",outcome="line\nbreak"`
+	if got != want {
+		t.Errorf("formatLabels() = %s, want %s", got, want)
+	}
+}
+
+func TestObservePoppitRoundTrip(t *testing.T) {
+	sentAt := time.Now().Add(-2 * time.Second).UTC().Format(time.RFC3339Nano)
+	observePoppitRoundTrip(PoppitOutput{Type: "test-round-trip", Metadata: map[string]interface{}{poppitSentAtKey: sentAt}})
+	observePoppitRoundTrip(PoppitOutput{Type: "test-round-trip-unstamped"})
+
+	var out strings.Builder
+	poppitRoundTripDuration.write(&out)
+	if !strings.Contains(out.String(), `slashvibeissue_poppit_round_trip_seconds_bucket{type="test-round-trip",le="1"} 0`) ||
+		!strings.Contains(out.String(), `slashvibeissue_poppit_round_trip_seconds_count{type="test-round-trip"} 1`) {
+		t.Errorf("Round trip not recorded:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "test-round-trip-unstamped") {
+		t.Error("Expected no observation without sent_at")
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	var pingErr error
+	status := newSubscriberStatus()
+	release := make(chan struct{})
+	ctx, stop := context.WithCancel(t.Context())
+	status.run(ctx, "slash-commands", func(ctx context.Context) error {
+		<-release
+		stop()
+		return nil
+	})
+	handler := newHealthHandler(func(ctx context.Context) error { return pingErr }, status)
+
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200", code)
+	}
+	if code, body := get("/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz = %d %q, want 200", code, body)
+	}
+
+	pingErr = fmt.Errorf("connection refused")
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "redis: connection refused") {
+		t.Errorf("/readyz with Redis down = %d %q", code, body)
+	}
+	pingErr = nil
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for len(status.stopped()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "subscriber slash-commands is not running") {
+		t.Errorf("/readyz with stopped subscriber = %d %q", code, body)
+	}
+
+	code, body := get("/metrics")
+	if code != http.StatusOK || !strings.Contains(body, `slashvibeissue_subscriber_up{subscriber="slash-commands"} 0`) ||
+		!strings.Contains(body, "# TYPE slashvibeissue_events_total counter") {
+		t.Errorf("/metrics = %d:\n%s", code, body)
+	}
+}
+
+func TestSubscriberStatusRestarts(t *testing.T) {
+	status := newSubscriberStatus()
+	ctx, stop := context.WithCancel(t.Context())
+
+	calls := 0
+	restarted := make(chan struct{})
+	status.run(ctx, "test-restarts", func(ctx context.Context) error {
+		calls++
+		switch calls {
+		case 1:
+			panic("handler bug")
+		case 2:
+			return errSubscriptionClosed
+		}
+		close(restarted)
+		<-ctx.Done()
+		return nil
+	})
+
+	select {
+	case <-restarted:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Subscriber was not restarted")
+	}
+	if stopped := status.stopped(); len(stopped) != 0 {
+		t.Errorf("Expected the restarted subscriber to be running, got stopped %v", stopped)
+	}
+	if got := subscriberRestarts.get("test-restarts", restartPanic); got != 1 {
+		t.Errorf("Expected 1 panic restart, got %v", got)
+	}
+	if got := subscriberRestarts.get("test-restarts", restartClosed); got != 1 {
+		t.Errorf("Expected 1 closed restart, got %v", got)
+	}
+
+	stop()
+	deadline := time.Now().Add(time.Second)
+	for len(status.stopped()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stopped := status.stopped(); len(stopped) != 1 {
+		t.Errorf("Expected the subscriber to stop with its context, got stopped %v", stopped)
+	}
+}
+
+func TestRunSubscriber(t *testing.T) {
+	tests := []struct {
+		name   string
+		fn     func(ctx context.Context) error
+		reason string
+	}{
+		{"returned", func(ctx context.Context) error { return nil }, restartClosed},
+		{"closed", func(ctx context.Context) error { return fmt.Errorf("channel: %w", errSubscriptionClosed) }, restartClosed},
+		{"error", func(ctx context.Context) error { return fmt.Errorf("connection refused") }, restartError},
+		{"panic", func(ctx context.Context) error { panic("boom") }, restartPanic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := runSubscriber(t.Context(), tt.fn)
+			if reason != tt.reason || err == nil {
+				t.Errorf("runSubscriber() = %q, %v; want %q with an error", reason, err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	rdb := newFakeRedis()
+	config := Config{RedisDeadLetterPrefix: "dead-letter:"}
+	payload := `{"type":"view_submission","token":"secret"}`
+
+	handle := recoverPanics(rdb, "slack-relay-view-submission", "test-panics", config, func(ctx context.Context, payload string) error {
+		var m map[string]string
+		m["boom"] = payload // nil map write
+		return nil
+	})
+	err := handle(withCorrelationID(t.Context(), "abc123"), payload)
+	if !errors.Is(err, errDeadLettered) {
+		t.Fatalf("Expected errDeadLettered, got %v", err)
+	}
+	if got := handlerPanics.get("test-panics"); got != 1 {
+		t.Errorf("Expected 1 panic counted, got %v", got)
+	}
+
+	entries := rdb.popList("dead-letter:slack-relay-view-submission")
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d", len(entries))
+	}
+	var entry deadLetter
+	if err := json.Unmarshal([]byte(entries[0]), &entry); err != nil {
+		t.Fatalf("Invalid dead letter: %v", err)
+	}
+	if entry.Handler != "test-panics" || entry.Channel != "slack-relay-view-submission" || entry.Payload != payload ||
+		entry.CorrelationID != "abc123" || !strings.Contains(entry.Error, "nil map") || entry.Stack == "" || entry.FailedAt == "" {
+		t.Errorf("Unexpected dead letter: %+v", entry)
+	}
+
+	// Errors from handlers that do not panic are passed through unchanged
+	want := fmt.Errorf("bad payload")
+	handle = recoverPanics(rdb, "channel", "test-panics", config, func(ctx context.Context, payload string) error { return want })
+	if err := handle(t.Context(), payload); err != want {
+		t.Errorf("Expected the handler error, got %v", err)
+	}
+	if entries := rdb.popList("dead-letter:slack-relay-view-submission"); len(entries) != 0 {
+		t.Errorf("Expected no dead letter for a handler error, got %v", entries)
+	}
+}
+
+func TestRedactPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"top-level token", `{"token":"abc","type":"block_actions"}`, `{"token":"[REDACTED]","type":"block_actions"}`},
+		{"nested response_url", `{"event":{"response_url":"https://hooks.slack.com/x","user":"U1"}}`, `{"event":{"response_url":"[REDACTED]","user":"U1"}}`},
+		{"inside array", `{"response_urls":[{"url":"x"}],"items":[{"token":"t"}]}`, `{"items":[{"token":"[REDACTED]"}],"response_urls":"[REDACTED]"}`},
+		{"not JSON", `not json`, `(8 bytes, not JSON)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactPayload(tt.payload); got != tt.want {
+				t.Errorf("redactPayload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	rdb := newFakeRedis()
+	config := Config{RedisReactionChannel: "slack-events", RedisDeadLetterPrefix: "dead-letter:"}
+	key := deadLetterKey("slack-events", config)
+
+	recent := time.Now().UTC().Add(-time.Minute).Format(time.RFC3339)
+	old := time.Now().UTC().Add(-48 * time.Hour).Format(time.RFC3339)
+	fixed := deadLetter{Handler: "reactions", Channel: "slack-events", Payload: `{"event":{"type":"reaction_removed"}}`, FailedAt: recent}
+	broken := deadLetter{Handler: "reactions", Channel: "slack-events", Payload: `not json`, FailedAt: recent}
+	stale := deadLetter{Handler: "reactions", Channel: "slack-events", Payload: `not json`, FailedAt: old}
+	for _, entry := range []deadLetter{fixed, broken, stale} {
+		if err := pushDeadLetter(t.Context(), rdb, entry, config); err != nil {
+			t.Fatalf("pushDeadLetter: %v", err)
+		}
+	}
+
+	var out strings.Builder
+	code := runReplay(t.Context(), rdb, newFakeSlack(), config, []string{"--channel", "slack-events", "--since", "24h"}, &out)
+	if code != 1 {
+		t.Errorf("Expected exit code 1 with a failed replay, got %d:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "1 replayed, 1 failed") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	// The replayed entry is removed; the failed and the old one stay
+	remaining := rdb.popList(key)
+	if len(remaining) != 2 || !strings.Contains(remaining[0], recent) || !strings.Contains(remaining[1], old) {
+		t.Errorf("Unexpected entries left in %s: %v", key, remaining)
+	}
+
+	out.Reset()
+	if code := runReplay(t.Context(), rdb, newFakeSlack(), config, []string{"--channel", "nope"}, &out); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown channel, got %d", code)
+	}
+	if !strings.Contains(out.String(), "slack-events") {
+		t.Errorf("Expected the known channels to be listed, got %q", out.String())
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"2h", now.Add(-2 * time.Hour), false},
+		{"2024-01-01T00:00:00Z", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.value, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseSince(%q) = %v, %v; want %v (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHealthcheckURL(t *testing.T) {
+	tests := map[string]string{
+		":8080":          "http://127.0.0.1:8080/readyz",
+		"0.0.0.0:9000":   "http://0.0.0.0:9000/readyz",
+		"localhost:8080": "http://localhost:8080/readyz",
+	}
+	for addr, want := range tests {
+		if got := healthcheckURL(addr); got != want {
+			t.Errorf("healthcheckURL(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestHandlerSupervisorDrain(t *testing.T) {
+	s := newHandlerSupervisor()
+	subscriberCtx, stopSubscribers := context.WithCancel(t.Context())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := make(chan error, 1)
+	handler := s.track("view-submissions", func(ctx context.Context, payload string) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	})
+	go func() { finished <- handler(subscriberCtx, "{}") }()
+	<-started
+
+	// Stopping the subscribers must not cancel the running handler
+	stopSubscribers()
+	close(release)
+	if abandoned := s.drain(time.Second); abandoned != nil {
+		t.Errorf("Expected no abandoned handlers, got %v", abandoned)
+	}
+	if err := <-finished; err != nil {
+		t.Errorf("Expected the handler context to outlive the subscriber context, got %v", err)
+	}
+}
+
+func TestHandlerSupervisorRejectsAfterDrain(t *testing.T) {
+	s := newHandlerSupervisor()
+	if abandoned := s.drain(time.Second); abandoned != nil {
+		t.Fatalf("Expected no abandoned handlers, got %v", abandoned)
+	}
+
+	// A subscriber that reads one more message after the drain has begun
+	ran := false
+	handler := s.track("reactions", func(ctx context.Context, payload string) error {
+		ran = true
+		return nil
+	})
+	if err := handler(t.Context(), "{}"); !errors.Is(err, errDraining) || ran {
+		t.Errorf("Expected the handler not to start during the drain, got ran=%v err=%v", ran, err)
+	}
+}
+
+func TestHandlerSupervisorDrainTimeout(t *testing.T) {
+	s := newHandlerSupervisor()
+
+	started := make(chan struct{})
+	finished := make(chan error, 1)
+	handler := s.track("poppit-output", func(ctx context.Context, payload string) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	go func() { finished <- handler(t.Context(), "{}") }()
+	<-started
+
+	abandoned := s.drain(10 * time.Millisecond)
+	if len(abandoned) != 1 || !strings.HasPrefix(abandoned[0], "poppit-output (running for ") {
+		t.Errorf("Expected poppit-output to be abandoned, got %v", abandoned)
+	}
+	if err := <-finished; err == nil {
+		t.Error("Expected the abandoned handler's context to be cancelled")
+	}
+}
+
+func TestLoggerCorrelationID(t *testing.T) {
+	var out strings.Builder
+	previous := logger
+	logger = newLogger(&out, "json")
+	t.Cleanup(func() { logger = previous })
+
+	ctx := withCorrelationID(t.Context(), "abc123")
+	InfoContext(ctx, "Created issue %s", "https://github.com/org/repo/issues/1")
+	Info("No correlation")
+	DebugContext(ctx, "Below the default level")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d:\n%s", len(lines), out.String())
+	}
+
+	var first, second map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Invalid JSON log line %q: %v", lines[0], err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("Invalid JSON log line %q: %v", lines[1], err)
+	}
+
+	if first["msg"] != "Created issue https://github.com/org/repo/issues/1" || first["level"] != "INFO" || first[correlationIDKey] != "abc123" {
+		t.Errorf("Unexpected first log line: %v", first)
+	}
+	if _, ok := second[correlationIDKey]; ok {
+		t.Errorf("Expected no correlation_id without one in context: %v", second)
+	}
+}
+
+func TestWithMetadataCorrelationID(t *testing.T) {
+	ctx := withMetadataCorrelationID(t.Context(), map[string]interface{}{correlationIDKey: "abc123"})
+	if id := correlationID(ctx); id != "abc123" {
+		t.Errorf("correlationID() = %q, want abc123", id)
+	}
+	if id := correlationID(withMetadataCorrelationID(t.Context(), nil)); id != "" {
+		t.Errorf("correlationID() = %q, want empty", id)
+	}
+	if id := newCorrelationID(); len(id) != 16 {
+		t.Errorf("newCorrelationID() = %q, want 16 characters", id)
+	}
+}
+
+func TestBuildConfirmationMessageWithCorrelationID(t *testing.T) {
+	msg := buildConfirmationMessage(IssueConfirmation{
+		Repo:          "org/repo",
+		Title:         "Title",
+		Username:      "alice",
+		IssueURL:      "https://github.com/org/repo/issues/1",
+		CorrelationID: "abc123",
+	}, Config{GitHubOrg: "org"})
+
+	payload := msg.Metadata["event_payload"].(map[string]interface{})
+	if payload[correlationIDKey] != "abc123" {
+		t.Errorf("event_payload[correlation_id] = %v, want abc123", payload[correlationIDKey])
+	}
+}
+
+func TestConfigFilePath(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	if got := configFilePath(""); got != defaultConfigFile {
+		t.Errorf("configFilePath(\"\") = %q, want %q", got, defaultConfigFile)
+	}
+	t.Setenv("CONFIG_FILE", "/etc/slashvibeissue.yaml")
+	if got := configFilePath(""); got != "/etc/slashvibeissue.yaml" {
+		t.Errorf("configFilePath(\"\") = %q, want CONFIG_FILE", got)
+	}
+	if got := configFilePath("custom.yaml"); got != "custom.yaml" {
+		t.Errorf("configFilePath(\"custom.yaml\") = %q, want the flag value", got)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	for _, key := range []string{"REDIS_ADDR", "CONFIRMATION_CHANNEL_ID", "LOG_LEVEL"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("GITHUB_ORG", "its-the-vibe")
+	previous := runtimeConfig.Load()
+	t.Cleanup(func() {
+		runtimeConfig.Store(previous)
+		SetLogLevel("INFO")
+	})
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+	}
+
+	write("redis_addr: \"redis-a:6379\"\nconfirmation_channel_id: \"C0000000001\"\n")
+	config := loadConfig(path)
+	runtimeConfig.Store(&config)
+
+	t.Run("applies reloadable settings only", func(t *testing.T) {
+		write("redis_addr: \"redis-b:6379\"\nconfirmation_channel_id: \"C0000000002\"\nlog_level: \"DEBUG\"\n")
+		applied, err := reloadConfig(path)
+		if err != nil {
+			t.Fatalf("reloadConfig() error = %v", err)
+		}
+		if strings.Join(applied, ",") != "CONFIRMATION_CHANNEL_ID,LOG_LEVEL" {
+			t.Errorf("applied = %v, want CONFIRMATION_CHANNEL_ID and LOG_LEVEL", applied)
+		}
+		got := currentConfig()
+		if got.ConfirmationChannelID != "C0000000002" || got.LogLevel != "DEBUG" {
+			t.Errorf("reloadable settings not applied: %+v", got)
+		}
+		if got.RedisAddr != "redis-a:6379" {
+			t.Errorf("RedisAddr = %q, want it unchanged until restart", got.RedisAddr)
+		}
+	})
+
+	t.Run("keeps the running config when the file is invalid", func(t *testing.T) {
+		write("confirmation_channel_id: \"C0000000003\"\nconfirmation_chanel: \"typo\"\n")
+		if _, err := reloadConfig(path); err == nil {
+			t.Fatal("Expected an error for an unknown key")
+		}
+		if got := currentConfig().ConfirmationChannelID; got != "C0000000002" {
+			t.Errorf("ConfirmationChannelID = %q, want the previous value", got)
+		}
+	})
+
+	t.Run("reports no changes when nothing reloadable changed", func(t *testing.T) {
+		write("redis_addr: \"redis-c:6379\"\nconfirmation_channel_id: \"C0000000002\"\nlog_level: \"DEBUG\"\n")
+		applied, err := reloadConfig(path)
+		if err != nil || applied != nil {
+			t.Errorf("reloadConfig() = %v, %v; want no changes", applied, err)
+		}
+	})
+}
+
+func TestRouteConfirmation(t *testing.T) {
+	config := Config{
+		ConfirmationChannelID: "CDEFAULT",
+		ConfirmationTTL:       172800,
+		ConfirmationRoutes: []confirmationRoute{
+			{SourceChannel: "CTEAM", Label: "bug", Channel: "CTEAMBUGS"},
+			{SourceChannel: "CTEAM", Channel: "CTEAM"},
+			{Repo: "its-the-vibe/infra-*", Channel: "CINFRA", TTL: "168h"},
+			{Repo: "Docs", Channel: "CDOCS", TTL: "0"},
+			{Label: "security", Channel: "CSECURITY"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		issue       IssueConfirmation
+		repo        string
+		wantChannel string
+		wantTTL     int
+	}{
+		{"no route matches", IssueConfirmation{SourceChannel: "COTHER"}, "its-the-vibe/SlashVibeIssue", "CDEFAULT", 172800},
+		{"all criteria must match", IssueConfirmation{SourceChannel: "CTEAM", Labels: []string{"Bug"}}, "its-the-vibe/app", "CTEAMBUGS", 172800},
+		{"first match wins", IssueConfirmation{SourceChannel: "CTEAM", Labels: []string{"security"}}, "its-the-vibe/infra-dns", "CTEAM", 172800},
+		{"repo glob", IssueConfirmation{}, "its-the-vibe/infra-dns", "CINFRA", 604800},
+		{"repo glob without org", IssueConfirmation{}, "other-org/docs", "CDOCS", 0},
+		{"label", IssueConfirmation{Labels: []string{"enhancement", "security"}}, "its-the-vibe/app", "CSECURITY", 172800},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel, ttl := routeConfirmation(tt.issue, tt.repo, config)
+			if channel != tt.wantChannel || ttl != tt.wantTTL {
+				t.Errorf("routeConfirmation() = %s, %d; want %s, %d", channel, ttl, tt.wantChannel, tt.wantTTL)
+			}
+		})
+	}
+
+	if got := confirmationChannels("its-the-vibe/infra-dns", config); strings.Join(got, ",") != "CTEAMBUGS,CTEAM,CINFRA,CSECURITY,CDEFAULT" {
+		t.Errorf("confirmationChannels() = %v", got)
+	}
+	if got := channelConfirmationTTL("CINFRA", config); got != 604800 {
+		t.Errorf("channelConfirmationTTL(CINFRA) = %d, want 604800", got)
+	}
+	if got := channelConfirmationTTL("CDOCS", config); got != 0 {
+		t.Errorf("channelConfirmationTTL(CDOCS) = %d, want 0 (never expires)", got)
+	}
+}
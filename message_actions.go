@@ -4,87 +4,115 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/slack-go/slack"
 )
 
-func subscribeToMessageActions(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, config Config) {
-	pubsub := rdb.Subscribe(ctx, config.RedisMessageActionChannel)
-	defer pubsub.Close()
-
-	Info("Subscribed to Redis channel: %s", config.RedisMessageActionChannel)
-
-	ch := pubsub.Channel()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case msg := <-ch:
-			if msg == nil {
-				continue
-			}
-			handleMessageAction(ctx, rdb, slackClient, msg.Payload, config)
-		}
+func subscribeToMessageActions(ctx context.Context, rdb *redis.Client, slackClient SlackAPI, config Config) error {
+	handler := func(ctx context.Context, payload string) error {
+		return handleMessageAction(ctx, rdb, slackClient, payload, currentConfig())
 	}
+	return consumeChannel(ctx, rdb, config.RedisMessageActionChannel, "message-actions", config,
+		withIdempotency(rdb, "message-actions", config, payloadKey("trigger_id"), handler))
 }
 
-func handleMessageAction(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, payload string, config Config) {
+func handleMessageAction(ctx context.Context, rdb RedisClient, slackClient SlackAPI, payload string, config Config) error {
 	var action MessageActionEvent
 	if err := json.Unmarshal([]byte(payload), &action); err != nil {
-		Error("Error unmarshaling message action: %v", err)
-		return
+		return fmt.Errorf("error unmarshaling message action: %v", err)
 	}
 
 	// Only handle message_action type with callback_id "create_github_issue"
-	if action.Type != "message_action" {
-		return
+	if action.Type != "message_action" || action.CallbackID != "create_github_issue" {
+		ignoreEvent(ctx)
+		return nil
 	}
 
-	if action.CallbackID != "create_github_issue" {
-		return
-	}
+	ctx = withCorrelationID(ctx, newCorrelationID())
+	InfoContext(ctx, "Received create_github_issue message action from user %s", action.User.Username)
 
-	Debug("Received create_github_issue message action from user %s", action.User.Username)
-
-	// Get the message text
+	// Get the message text; a message may be only files, such as a screenshot
 	messageText := action.Message.Text
-	if messageText == "" {
-		Warn("Message has no text, ignoring action")
-		return
+	if messageText == "" && len(action.Message.Files) == 0 {
+		WarnContext(ctx, "Message has no text or files, ignoring action")
+		return nil
 	}
 
-	Debug("Opening modal with loading state for message text (length: %d)", len(messageText))
+	DebugContext(ctx, "Opening modal with loading state for message text (length: %d)", len(messageText))
 
 	// Open modal immediately with loading state to avoid trigger_id expiration
 	// loadingModal := createIssueModal("⏳ Generating title...", messageText, false)
 	// NOTE: leaving blank otherwise Slack does not seem to update
-	loadingModal := createIssueModal("", messageText, false)
+	opts := issueModalOptions{
+		Description:  messageText,
+		AddToProject: true,
+		Metadata: IssueModalMetadata{
+			CorrelationID: correlationID(ctx),
+			SourceChannel: action.Channel.ID,
+			SourceTs:      action.MessageTs,
+		},
+	}
+	loadingModal := createIssueModalWithOptions(opts)
 	viewResponse, err := slackClient.OpenView(action.TriggerID, loadingModal)
 	if err != nil {
-		Error("Error opening modal: %v", err)
-		return
+		return fmt.Errorf("error opening modal: %v", err)
 	}
 
-	Debug("Modal opened successfully with view_id: %s", viewResponse.ID)
+	DebugContext(ctx, "Modal opened successfully with view_id: %s", viewResponse.ID)
+
+	// The permalink and files are fetched after the modal is open; the
+	// trigger_id would expire
+	permalink, err := slackClient.GetPermalink(&slack.PermalinkParameters{Channel: action.Channel.ID, Ts: action.MessageTs})
+	if err != nil {
+		WarnContext(ctx, "Error getting permalink for message %s, the issue will not link to it: %v", action.MessageTs, err)
+	}
+	opts.Metadata.SourcePermalink = permalink
+	opts.Metadata.Attachments = collectAttachments(ctx, slackClient, action.Message.Files, config)
+
+	// Put the permalink and attachments in the open view now: the user may
+	// submit or pick a repository before the title arrives, or its generation
+	// may fail
+	if permalink != "" || len(opts.Metadata.Attachments) > 0 {
+		if _, err := slackClient.UpdateView(createIssueModalWithOptions(opts), "", "", viewResponse.ID); err != nil {
+			WarnContext(ctx, "Error updating modal %s with the source message and attachments: %v", viewResponse.ID, err)
+		}
+	}
 
 	// Send command to Poppit to generate title with view_id for later update
-	err = generateIssueTitleViaCopilot(ctx, rdb, messageText, action.User.Username, viewResponse.ID, viewResponse.Hash, config)
+	summariserText := messageText
+	if summariserText == "" {
+		summariserText = describeFiles(action.Message.Files)
+	}
+	err = generateIssueTitleViaCopilot(ctx, rdb, summariserText, action.User.Username, viewResponse.ID, viewResponse.Hash, opts, config)
 	if err != nil {
-		Error("Error generating issue title: %v", err)
-		return
+		return fmt.Errorf("error generating issue title: %v", err)
 	}
 
-	Debug("Title generation command sent to Poppit for user: %s", action.User.Username)
+	DebugContext(ctx, "Title generation command sent to Poppit for user: %s", action.User.Username)
+	return nil
 }
 
-func generateIssueTitleViaCopilot(ctx context.Context, rdb *redis.Client, messageBody, username, viewID string, hash string, config Config) error {
-	// Escape single quotes in the message for shell command
-	escapedMessage := strings.ReplaceAll(messageBody, `'`, `'\''`)
-
-	// Build the issue-summariser command with the message as argument
-	copilotCmd := fmt.Sprintf("issue-summariser '%s'", escapedMessage)
+// generateIssueTitleViaCopilot asks Poppit to summarise messageBody into a
+// title and description for the modal viewID.  The rest of the modal is
+// restored from opts when the output arrives.  With the thread included the
+// summariser is given the transcript, which is added on submission, so the
+// description in opts is kept rather than replaced.
+func generateIssueTitleViaCopilot(ctx context.Context, rdb RedisClient, messageBody, username, viewID string, hash string, opts issueModalOptions, config Config) error {
+	// Build the issue-summariser command with the message as its only
+	// argument.  A long thread is cut short, as the start says what the issue
+	// is about
+	copilotCmd := newShellCommand("issue-summariser", truncate(messageBody, maxSummariserInput))
+
+	// Title and description are replaced by the generated ones
+	opts.Title = ""
+	if !opts.IncludeThread {
+		opts.Description = ""
+	}
+	modal, err := json.Marshal(opts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal modal state: %v", err)
+	}
 
 	// Create Poppit command message with metadata including view_id
 	poppitCmd := PoppitCommand{
@@ -92,155 +120,180 @@ func generateIssueTitleViaCopilot(ctx context.Context, rdb *redis.Client, messag
 		Branch:   "refs/heads/main",
 		Type:     "slash-vibe-issue-ticket-title",
 		Dir:      config.AgentWorkingDir,
-		Commands: []string{copilotCmd},
+		Commands: []string{copilotCmd.String()},
 		Metadata: map[string]interface{}{
 			"username": username,
 			"view_id":  viewID,
 			"hash":     hash,
+			"modal":    string(modal),
 		},
 	}
 
-	payload, err := json.Marshal(poppitCmd)
-	if err != nil {
-		return fmt.Errorf("failed to marshal Poppit command: %v", err)
-	}
-
-	// Push command to Poppit list
-	err = rdb.RPush(ctx, config.RedisPoppitList, payload).Err()
-	if err != nil {
-		return fmt.Errorf("failed to push command to Poppit: %v", err)
+	if err := pushPoppitCommand(ctx, rdb, config.RedisPoppitList, poppitCmd); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func handleTitleGenerationOutput(ctx context.Context, slackClient *slack.Client, output PoppitOutput, config Config) {
-	Debug("Received Poppit output for title generation")
+func handleTitleGenerationOutput(ctx context.Context, rdb RedisClient, slackClient SlackAPI, output PoppitOutput, config Config) error {
+	DebugContext(ctx, "Received Poppit output for title generation")
 
 	// Extract metadata
 	metadata := output.Metadata
 	if metadata == nil {
-		Warn("No metadata in Poppit output")
-		return
+		WarnContext(ctx, "No metadata in Poppit output")
+		return nil
 	}
 
 	username, _ := metadata["username"].(string)
 	viewID, _ := metadata["view_id"].(string)
 	hash, _ := metadata["hash"].(string)
+	modal, _ := metadata["modal"].(string)
 
 	if username == "" {
-		Warn("Missing username in metadata")
-		return
+		WarnContext(ctx, "Missing username in metadata")
+		return nil
 	}
 
 	if viewID == "" {
-		Warn("Missing view_id in metadata")
-		return
+		WarnContext(ctx, "Missing view_id in metadata")
+		return nil
 	}
 
 	if hash == "" {
-		Warn("Missing hash in metadata")
-		return
+		WarnContext(ctx, "Missing hash in metadata")
+		return nil
 	}
 
 	// Parse the JSON output
 	var titleOutput TitleGenerationOutput
 	if err := json.Unmarshal([]byte(output.Output), &titleOutput); err != nil {
-		Error("Error unmarshaling title generation output: %v", err)
-		return
+		return fmt.Errorf("error unmarshaling title generation output: %v", err)
 	}
 
 	if titleOutput.Title == "" {
-		Warn("Generated title is empty")
-		return
+		WarnContext(ctx, "Generated title is empty")
+		return nil
 	}
 
-	Info("Generated title for user %s: %s", username, titleOutput.Title)
+	InfoContext(ctx, "Generated title for user %s: %s", username, titleOutput.Title)
 
-	// Update modal with generated title and description
-	updatedModal := createIssueModal(titleOutput.Title, titleOutput.Prompt, false)
+	// Restore the modal as it was when the title was requested
+	opts := issueModalOptions{AddToProject: true}
+	if modal != "" {
+		if err := json.Unmarshal([]byte(modal), &opts); err != nil {
+			return fmt.Errorf("error unmarshaling modal state: %v", err)
+		}
+	}
+	if opts.Repo != "" {
+		details, found, err := loadRepoDetails(ctx, rdb, viewID, config)
+		if err != nil {
+			return err
+		}
+		if found {
+			opts.setRepoDetails(details)
+		}
+	}
+	if opts.Metadata.CorrelationID == "" {
+		opts.Metadata.CorrelationID = correlationID(ctx)
+	}
+
+	// Update modal with generated title and description.  The summariser
+	// echoes its input as the prompt, which is the thread transcript when it
+	// is included
+	opts.Title = titleOutput.Title
+	if !opts.IncludeThread {
+		opts.Description = titleOutput.Prompt
+	}
+	updatedModal := createIssueModalWithOptions(opts)
 
 	// NOTE: not using hash
 	viewResp, err := slackClient.UpdateView(updatedModal, "", "", viewID)
 	if err != nil {
-		Error("Error updating modal: %v", err)
-		return
+		return fmt.Errorf("error updating modal: %v", err)
 	}
 	// Optionally log the response for debugging
 	if viewResp != nil {
-		Debug("Slack API UpdateView response: %+v", viewResp)
+		DebugContext(ctx, "Slack API UpdateView response: %+v", viewResp)
 	}
 
-	Debug("Modal updated successfully for user %s", username)
+	DebugContext(ctx, "Modal updated successfully for user %s", username)
+	return nil
 }
 
-func handleIssueSanitisationOutput(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, output PoppitOutput, config Config) {
-	Debug("Received Poppit output for issue sanitisation")
+func handleIssueSanitisationOutput(ctx context.Context, rdb RedisClient, slackClient SlackAPI, output PoppitOutput, config Config) error {
+	DebugContext(ctx, "Received Poppit output for issue sanitisation")
 
 	// Extract metadata
 	metadata := output.Metadata
 	if metadata == nil {
-		Warn("No metadata in Poppit output for issue sanitisation")
-		return
+		WarnContext(ctx, "No metadata in Poppit output for issue sanitisation")
+		return nil
 	}
 
 	issueURL, ok := metadata["issueURL"].(string)
 	if !ok {
-		Warn("issueURL in metadata is not a string for issue sanitisation")
-		return
+		WarnContext(ctx, "issueURL in metadata is not a string for issue sanitisation")
+		return nil
 	}
 	if issueURL == "" {
-		Warn("issueURL in metadata is empty for issue sanitisation")
-		return
+		WarnContext(ctx, "issueURL in metadata is empty for issue sanitisation")
+		return nil
+	}
+
+	if reason, failed := poppitFailure(output); failed {
+		notifyCommandFailure(ctx, rdb, slackClient, output, reason, config)
+		return nil
 	}
 
-	Info("Issue sanitisation completed for: %s", issueURL)
+	InfoContext(ctx, "Issue sanitisation completed for: %s", issueURL)
 
 	// Check if we need to assign to Copilot after sanitisation
 	deferCopilotAssignment, _ := metadata["deferCopilotAssignment"].(bool)
 	if deferCopilotAssignment {
 		repository, _ := metadata["repository"].(string)
 		if repository == "" {
-			Warn("Repository metadata missing for deferred Copilot assignment")
+			WarnContext(ctx, "Repository metadata missing for deferred Copilot assignment")
 		} else {
-			Info("Assigning issue to Copilot after sanitisation: %s", issueURL)
-			err := assignIssueToCopilot(ctx, rdb, issueURL, repository, config)
+			InfoContext(ctx, "Assigning issue to Copilot after sanitisation: %s", issueURL)
+			userID, _ := metadata["user_id"].(string)
+			err := assignIssueToCopilot(ctx, rdb, issueURL, repository, userID, config)
 			if err != nil {
-				Error("Error assigning issue to Copilot after sanitisation: %v", err)
+				ErrorContext(ctx, "Error assigning issue to Copilot after sanitisation: %v", err)
 			} else {
-				Info("Successfully assigned issue to Copilot after sanitisation: %s", issueURL)
+				InfoContext(ctx, "Successfully assigned issue to Copilot after sanitisation: %s", issueURL)
 			}
 		}
 	}
 
 	// Find the confirmation message with matching issue URL
-	channelID, messageTs, err := findMessageByIssueURL(ctx, slackClient, issueURL, config)
+	channelID, messageTs, err := findMessageByIssueURL(ctx, rdb, slackClient, issueURL, config)
 	if err != nil {
-		Error("Error finding message by issue URL: %v", err)
-		return
+		return fmt.Errorf("error finding message by issue URL: %v", err)
 	}
 
 	if channelID == "" || messageTs == "" {
-		Debug("No message found for issue URL: %s", issueURL)
-		return
+		DebugContext(ctx, "No message found for issue URL: %s", issueURL)
+		return nil
 	}
 
-	Debug("Found message for issue %s at channel=%s, ts=%s", issueURL, channelID, messageTs)
+	DebugContext(ctx, "Found message for issue %s at channel=%s, ts=%s", issueURL, channelID, messageTs)
 
 	// Remove :brain: reaction
 	err = removeReactionFromSlackLiner(ctx, rdb, issueSanitisingReactionEmoji, channelID, messageTs, config)
 	if err != nil {
-		Error("Error removing brain reaction: %v", err)
+		ErrorContext(ctx, "Error removing brain reaction: %v", err)
 	} else {
-		Debug("Removed %s reaction for sanitised issue", issueSanitisingReactionEmoji)
+		DebugContext(ctx, "Removed %s reaction for sanitised issue", issueSanitisingReactionEmoji)
 	}
 
 	// Send :ticket: reaction to SlackLiner
 	err = sendReactionToSlackLiner(ctx, rdb, issueSanitisedReactionEmoji, channelID, messageTs, config)
 	if err != nil {
-		Error("Error sending reaction: %v", err)
-		return
+		return fmt.Errorf("error sending reaction: %v", err)
 	}
 
-	Info("Sent %s reaction for sanitised issue: %s", issueSanitisedReactionEmoji, issueURL)
+	InfoContext(ctx, "Sent %s reaction for sanitised issue: %s", issueSanitisedReactionEmoji, issueURL)
+	return nil
 }
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The metrics below are exposed on /metrics in the Prometheus text format.  They
+// are kept by hand rather than with the Prometheus client library because the
+// service only needs a few counters and histograms.
+
+// Event outcomes counted per handler in slashvibeissue_events_total.
+const (
+	outcomeReceived  = "received"
+	outcomeIgnored   = "ignored"
+	outcomeSucceeded = "succeeded"
+	outcomeFailed    = "failed"
+)
+
+// latencyBuckets are the histogram upper bounds, in seconds.  Poppit round trips
+// include running gh, so the buckets reach well past typical Slack API latency.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+var (
+	eventsTotal = newCounterVec("slashvibeissue_events_total",
+		"Events read from Redis, by handler and outcome.", "handler", "outcome")
+	slackRequestDuration = newHistogramVec("slashvibeissue_slack_api_request_duration_seconds",
+		"Slack Web API request latency, by API method.", "method")
+	poppitRoundTripDuration = newHistogramVec("slashvibeissue_poppit_round_trip_seconds",
+		"Time from pushing a command to Poppit to receiving its output, by command type.", "type")
+)
+
+// counterVec is a set of counters partitioned by label values.
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counterVec) inc(labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) get(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\xff")]
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, formatLabels(c.labels, strings.Split(key, "\xff")), formatFloat(c.values[key]))
+	}
+}
+
+// histogramVec is a set of histograms partitioned by a single label.
+type histogramVec struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // one per latencyBuckets entry, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name, help, label string) *histogramVec {
+	return &histogramVec{name: name, help: help, label: label, series: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(labelValue string, seconds float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.series[labelValue]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		h.series[labelValue] = series
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			series.counts[i]++
+			break
+		}
+	}
+	series.sum += seconds
+	series.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, value := range sortedKeys(h.series) {
+		series := h.series[value]
+		labels := formatLabels([]string{h.label}, []string{value})
+
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, labels, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, labels, series.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, labels, formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, labels, series.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		var value string
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, labelValueEscaper.Replace(value))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeMetrics renders every metric in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, status *subscriberStatus) {
+	eventsTotal.write(w)
+	slackRequestDuration.write(w)
+	poppitRoundTripDuration.write(w)
+	subscriberRestarts.write(w)
+	handlerPanics.write(w)
+	deadLettersTotal.write(w)
+	configReloads.write(w)
+	status.write(w)
+}
+
+// eventOutcome lets a handler report that it ignored an event, which it
+// otherwise signals the same way as success: by returning nil.
+type eventOutcome struct {
+	ignored bool
+}
+
+type eventOutcomeKey struct{}
+
+// ignoreEvent records that the event being handled was not relevant to the
+// handler.  It has no effect outside instrumentHandler, e.g. in tests.
+func ignoreEvent(ctx context.Context) {
+	if outcome, ok := ctx.Value(eventOutcomeKey{}).(*eventOutcome); ok {
+		outcome.ignored = true
+	}
+}
+
+// instrumentHandler counts the events handled by the named handler and their outcome.
+func instrumentHandler(name string, handle messageHandler) messageHandler {
+	return func(ctx context.Context, payload string) error {
+		eventsTotal.inc(name, outcomeReceived)
+
+		outcome := &eventOutcome{}
+		err := handle(context.WithValue(ctx, eventOutcomeKey{}, outcome), payload)
+		switch {
+		case err != nil:
+			eventsTotal.inc(name, outcomeFailed)
+		case outcome.ignored:
+			eventsTotal.inc(name, outcomeIgnored)
+		default:
+			eventsTotal.inc(name, outcomeSucceeded)
+		}
+		return err
+	}
+}
+
+// slackMetricsTransport times Slack Web API requests by API method.
+type slackMetricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t slackMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	slackRequestDuration.observe(path.Base(req.URL.Path), time.Since(start).Seconds())
+	return resp, err
+}
+
+// newSlackHTTPClient returns the HTTP client used for the Slack Web API.  Its
+// timeout leaves room for attachment downloads, which have their own.
+func newSlackHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: slackMetricsTransport{base: http.DefaultTransport},
+		Timeout:   attachmentTimeout,
+	}
+}
+
+// observePoppitRoundTrip records how long a Poppit command took from being
+// pushed to its output arriving, using the sent_at stamp added by pushPoppitCommand.
+func observePoppitRoundTrip(output PoppitOutput) {
+	sentAt, _ := output.Metadata[poppitSentAtKey].(string)
+	if sentAt == "" {
+		return
+	}
+	sent, err := time.Parse(time.RFC3339Nano, sentAt)
+	if err != nil {
+		Debug("Invalid %s in %s output: %v", poppitSentAtKey, output.Type, err)
+		return
+	}
+	poppitRoundTripDuration.observe(output.Type, time.Since(sent).Seconds())
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+// ghFailurePrefixes are line prefixes that gh and our helper tools print when a
+// command fails.  They are used when Poppit does not report an exit status.
+var ghFailurePrefixes = []string{
+	"GraphQL:",
+	"HTTP 4",
+	"HTTP 5",
+	"error:",
+	"Error:",
+	"failed to",
+	"Failed to",
+	"could not",
+	"Could not",
+	"unknown flag",
+	"unknown command",
+	"gh: ",
+	"To get started with GitHub CLI",
+}
+
+// poppitCommandDescriptions describes each Poppit command type in failure notices.
+var poppitCommandDescriptions = map[string]string{
+	"slash-vibe-issue":                "Creating the GitHub issue",
+	"slash-vibe-issue-project":        "Adding the issue to the project",
+	"slash-vibe-issue-assign-copilot": "Assigning the issue to Copilot",
+	"slash-vibe-issue-assign-jules":   "Labelling the issue for Jules",
+	"slash-vibe-issue-sanitise":       "Sanitising the issue",
+	"slash-vibe-issue-comment":        "Commenting on the existing issue",
+}
+
+const (
+	maxFailureReasonLength      = 500
+	maxFailureDescriptionLength = 2500
+)
+
+// poppitFailure reports whether a Poppit command failed, and why.  Output with
+// an issue URL means gh got as far as creating or commenting on the issue, so
+// it is a success even if something else was reported; a retry would create a
+// duplicate.  Otherwise an explicit non-zero exit status or error from Poppit
+// wins, and stderr is checked for known gh failure text.  Stdout is never
+// scanned: it carries the command's result, which can contain any text.
+func poppitFailure(output PoppitOutput) (string, bool) {
+	if extractIssueURL(output.Output) != "" {
+		return "", false
+	}
+	if output.ExitCode != nil && *output.ExitCode != 0 {
+		return firstNonEmpty(output.Error, output.Stderr, output.Output, fmt.Sprintf("exit status %d", *output.ExitCode)), true
+	}
+	if output.Error != "" {
+		return output.Error, true
+	}
+
+	for _, line := range strings.Split(output.Stderr, "\n") {
+		line = strings.TrimSpace(line)
+		for _, prefix := range ghFailurePrefixes {
+			if strings.HasPrefix(line, prefix) {
+				return line, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	// Don't cut a multi-byte character in half
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "…"
+}
+
+// newRandomID returns a random 128-bit hex identifier.
+func newRandomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+func failedCommandKey(id string, config Config) string {
+	return config.RedisFailedCommandPrefix + id
+}
+
+// storeFailedCommand saves the failed command so it can be retried and returns its ID.
+func storeFailedCommand(ctx context.Context, rdb RedisClient, failed FailedCommand, config Config) (string, error) {
+	id := newRandomID()
+	if err := putFailedCommand(ctx, rdb, id, failed, config); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func putFailedCommand(ctx context.Context, rdb RedisClient, id string, failed FailedCommand, config Config) error {
+	payload, err := json.Marshal(failed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal failed command: %v", err)
+	}
+
+	ttl := time.Duration(config.FailedCommandTTL) * time.Second
+	if err := rdb.Set(ctx, failedCommandKey(id, config), payload, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store failed command: %v", err)
+	}
+	return nil
+}
+
+// takeFailedCommand loads and deletes a stored failed command so it is retried
+// at most once.  A retry that fails puts it back with putFailedCommand.
+func takeFailedCommand(ctx context.Context, rdb RedisClient, id string, config Config) (FailedCommand, bool, error) {
+	data, err := rdb.GetDel(ctx, failedCommandKey(id, config)).Result()
+	if errors.Is(err, redis.Nil) {
+		return FailedCommand{}, false, nil
+	}
+	if err != nil {
+		return FailedCommand{}, false, fmt.Errorf("failed to load failed command: %v", err)
+	}
+
+	var failed FailedCommand
+	if err := json.Unmarshal([]byte(data), &failed); err != nil {
+		return FailedCommand{}, false, fmt.Errorf("failed to unmarshal failed command: %v", err)
+	}
+	return failed, true, nil
+}
+
+// issueRequestFromMetadata rebuilds the original IssueRequest from the metadata
+// attached to a "slash-vibe-issue" Poppit command.
+func issueRequestFromMetadata(metadata map[string]interface{}) IssueRequest {
+	var req IssueRequest
+	req.Repo, _ = metadata["repo"].(string)
+	req.Title, _ = metadata["title"].(string)
+	req.Description, _ = metadata["description"].(string)
+	req.Username, _ = metadata["username"].(string)
+	req.UserID, _ = metadata["user_id"].(string)
+	req.AddToProject, _ = metadata["addToProject"].(bool)
+	req.SanitiseIssue, _ = metadata["sanitiseIssue"].(bool)
+	assignedToCopilot, _ := metadata["assignedToCopilot"].(bool)
+	deferCopilotAssignment, _ := metadata["deferCopilotAssignment"].(bool)
+	req.AssignToCopilot = assignedToCopilot || deferCopilotAssignment
+	req.Labels = metadataStrings(metadata["labels"])
+	req.Assignees = metadataStrings(metadata["assignees"])
+	req.Milestone, _ = metadata["milestone"].(string)
+	req.AssignToMe, _ = metadata["assignToMe"].(bool)
+	req.SourceChannel, _ = metadata["source_channel"].(string)
+	req.SourceTs, _ = metadata["source_ts"].(string)
+	req.SourcePermalink, _ = metadata["source_permalink"].(string)
+	req.Thread, _ = metadata["thread"].(string)
+	req.Attachments = metadataAttachments(metadata["attachments"])
+	return req
+}
+
+// metadataAttachments reads the attachments back from Poppit metadata, where
+// they arrive as generic JSON values.
+func metadataAttachments(value interface{}) []IssueAttachment {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var attachments []IssueAttachment
+	if err := json.Unmarshal(data, &attachments); err != nil {
+		Warn("Ignoring malformed attachments in metadata: %v", err)
+		return nil
+	}
+	return attachments
+}
+
+// metadataStrings reads a string list from Poppit metadata, which arrives as
+// []interface{} after a JSON round trip.
+func metadataStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// buildFailureBlocks renders the failure notice sent to the user, with a Retry
+// button when retryID is set.
+func buildFailureBlocks(output PoppitOutput, reason, retryID string) []slack.Block {
+	description, ok := poppitCommandDescriptions[output.Type]
+	if !ok {
+		description = "Running a GitHub command"
+	}
+
+	text := fmt.Sprintf("❌ *%s failed*\n```%s```", description, truncate(reason, maxFailureReasonLength))
+	if issueURL, _ := output.Metadata["issueURL"].(string); issueURL != "" {
+		text += fmt.Sprintf("\n*Issue:* %s", issueURL)
+	}
+
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+	}
+
+	// Echo back what the user typed so nothing is lost
+	if output.Type == "slash-vibe-issue" {
+		req := issueRequestFromMetadata(output.Metadata)
+		details := fmt.Sprintf("*Repository:* %s\n*Title:* %s", req.Repo, req.Title)
+		if req.Description != "" {
+			details += fmt.Sprintf("\n*Description:*\n```%s```", truncate(req.Description, maxFailureDescriptionLength))
+		}
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, details, false, false), nil, nil))
+	}
+
+	if retryID != "" {
+		retryButton := slack.NewButtonBlockElement(retryFailedCommandActionID, retryID,
+			slack.NewTextBlockObject(slack.PlainTextType, "Retry", false, false))
+		retryButton.Style = slack.StylePrimary
+		blocks = append(blocks, slack.NewActionBlock("failure_actions_block", retryButton))
+	}
+
+	return blocks
+}
+
+// notifyCommandFailure logs a failed Poppit command and sends the user who
+// triggered it a direct message with the error and a Retry button.
+func notifyCommandFailure(ctx context.Context, rdb RedisClient, slackClient SlackAPI, output PoppitOutput, reason string, config Config) {
+	ErrorContext(ctx, "Poppit command %s failed: %s", output.Type, reason)
+
+	userID, _ := output.Metadata["user_id"].(string)
+	if userID == "" {
+		WarnContext(ctx, "No user to notify about failed %s command", output.Type)
+		return
+	}
+
+	retryID, err := storeFailedCommand(ctx, rdb, FailedCommand{Type: output.Type, Metadata: output.Metadata}, config)
+	if err != nil {
+		ErrorContext(ctx, "Error storing failed command for retry: %v", err)
+	}
+
+	blocks := buildFailureBlocks(output, reason, retryID)
+	fallback := fmt.Sprintf("A GitHub command failed: %s", truncate(reason, maxFailureReasonLength))
+
+	_, _, err = slackClient.PostMessage(userID, slack.MsgOptionText(fallback, false), slack.MsgOptionBlocks(blocks...))
+	if err != nil {
+		ErrorContext(ctx, "Error sending failure notification to user %s: %v", userID, err)
+		return
+	}
+
+	InfoContext(ctx, "Sent failure notification for %s command to user %s", output.Type, userID)
+}
+
+// retryFailedCommand handles a click on the Retry button of a failure notice.
+// Issue creation re-opens a pre-filled modal; other commands are re-queued.
+func retryFailedCommand(ctx context.Context, rdb RedisClient, slackClient SlackAPI, event BlockActionEvent, action BlockAction, config Config) error {
+	failed, found, err := takeFailedCommand(ctx, rdb, action.Value, config)
+	if err != nil {
+		return err
+	}
+	if !found {
+		WarnContext(ctx, "Failed command %s has expired or was already retried", action.Value)
+		if err := postToResponseURL(ctx, event.ResponseURL, SlackResponseMessage{
+			ReplaceOriginal: true,
+			Text:            "⌛ This retry has expired or was already used.",
+		}); err != nil {
+			ErrorContext(ctx, "Error updating failure notification: %v", err)
+		}
+		return nil
+	}
+
+	InfoContext(ctx, "Retrying failed %s command for user %s", failed.Type, event.User.Username)
+
+	metadata := failed.Metadata
+	ctx = withMetadataCorrelationID(ctx, metadata)
+	issueURL, _ := metadata["issueURL"].(string)
+	repository, _ := metadata["repository"].(string)
+	userID := event.User.ID
+
+	switch failed.Type {
+	case "slash-vibe-issue":
+		// The modal gets the description as the user entered it; the thread
+		// and attachments are added again on submission
+		req := issueRequestFromMetadata(metadata)
+		modal := createIssueModalWithOptions(issueModalOptions{
+			Title:           req.Title,
+			Description:     req.Description,
+			Repo:            req.Repo,
+			AssignToCopilot: req.AssignToCopilot,
+			AddToProject:    req.AddToProject,
+			SanitiseIssue:   req.SanitiseIssue,
+			AssignToMe:      req.AssignToMe,
+			IncludeThread:   req.Thread != "",
+			Metadata: IssueModalMetadata{
+				Labels:          req.Labels,
+				Assignees:       req.Assignees,
+				Milestone:       req.Milestone,
+				CorrelationID:   correlationID(ctx),
+				SourceChannel:   req.SourceChannel,
+				SourceTs:        req.SourceTs,
+				SourcePermalink: req.SourcePermalink,
+				Attachments:     req.Attachments,
+			},
+		})
+		var view *slack.ViewResponse
+		view, err = slackClient.OpenView(event.TriggerID, modal)
+		if err == nil && req.Thread != "" {
+			err = storeTranscript(ctx, rdb, view.ID, req.Thread, config)
+		}
+	case "slash-vibe-issue-project":
+		err = addIssueToProject(ctx, rdb, issueURL, userID, config)
+	case "slash-vibe-issue-assign-copilot":
+		err = assignIssueToCopilot(ctx, rdb, issueURL, repository, userID, config)
+	case "slash-vibe-issue-assign-jules":
+		err = assignIssueToJules(ctx, rdb, issueURL, repository, userID, config)
+	case "slash-vibe-issue-comment":
+		body, _ := metadata["body"].(string)
+		if body == "" {
+			err = fmt.Errorf("no comment body stored for %s", issueURL)
+			break
+		}
+		err = commentOnIssue(ctx, rdb, issueURL, body, userID, config)
+	case "slash-vibe-issue-sanitise":
+		deferCopilotAssignment, _ := metadata["deferCopilotAssignment"].(bool)
+		err = sanitiseIssue(ctx, rdb, issueURL, repository, userID, deferCopilotAssignment, config)
+	default:
+		err = fmt.Errorf("unknown command type %q", failed.Type)
+	}
+
+	if err != nil {
+		// Keep the Retry button working, e.g. after the trigger_id expired
+		if putErr := putFailedCommand(ctx, rdb, action.Value, failed, config); putErr != nil {
+			ErrorContext(ctx, "Error restoring failed command %s: %v", action.Value, putErr)
+		}
+		return fmt.Errorf("error retrying %s command: %v", failed.Type, err)
+	}
+
+	if err := postToResponseURL(ctx, event.ResponseURL, SlackResponseMessage{
+		ReplaceOriginal: true,
+		Text:            fmt.Sprintf("🔁 Retrying: %s", strings.ToLower(poppitCommandDescriptions[failed.Type])),
+	}); err != nil {
+		ErrorContext(ctx, "Error updating failure notification: %v", err)
+	}
+	return nil
+}
@@ -3,63 +3,79 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/redis/go-redis/v9"
-	"github.com/slack-go/slack"
 )
 
-func subscribeToPoppitOutput(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, config Config) {
-	pubsub := rdb.Subscribe(ctx, config.RedisPoppitOutputChannel)
-	defer pubsub.Close()
-
-	Info("Subscribed to Redis channel: %s", config.RedisPoppitOutputChannel)
-
-	ch := pubsub.Channel()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case msg := <-ch:
-			if msg == nil {
-				continue
-			}
-			handlePoppitOutput(ctx, rdb, slackClient, msg.Payload, config)
-		}
+func subscribeToPoppitOutput(ctx context.Context, rdb *redis.Client, slackClient SlackAPI, config Config) error {
+	handler := func(ctx context.Context, payload string) error {
+		return handlePoppitOutput(ctx, rdb, slackClient, payload, currentConfig())
 	}
+	return consumeChannel(ctx, rdb, config.RedisPoppitOutputChannel, "poppit-output", config,
+		withIdempotency(rdb, "poppit-output", config, payloadKey(), handler))
 }
 
-func handlePoppitOutput(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, payload string, config Config) {
+func handlePoppitOutput(ctx context.Context, rdb RedisClient, slackClient SlackAPI, payload string, config Config) error {
 	var output PoppitOutput
 	if err := json.Unmarshal([]byte(payload), &output); err != nil {
-		Error("Error unmarshaling Poppit output: %v", err)
-		return
+		return fmt.Errorf("error unmarshaling Poppit output: %v", err)
 	}
 
+	observePoppitRoundTrip(output)
+
+	ctx = withMetadataCorrelationID(ctx, output.Metadata)
+	DebugContext(ctx, "Received Poppit output for %s", output.Type)
+
 	// Handle title generation output
 	if output.Type == "slash-vibe-issue-ticket-title" {
-		handleTitleGenerationOutput(ctx, slackClient, output, config)
-		return
+		return handleTitleGenerationOutput(ctx, rdb, slackClient, output, config)
 	}
 
 	// Handle issue sanitisation output
 	if output.Type == "slash-vibe-issue-sanitise" {
-		handleIssueSanitisationOutput(ctx, rdb, slackClient, output, config)
-		return
+		return handleIssueSanitisationOutput(ctx, rdb, slackClient, output, config)
+	}
+
+	// Handle repository details for an open modal
+	if output.Type == "slash-vibe-issue-repo-details" {
+		return handleRepoDetailsOutput(ctx, rdb, slackClient, output, config)
+	}
+
+	// Duplicate search that runs before an issue is created
+	if output.Type == "slash-vibe-issue-duplicates" {
+		return handleDuplicateCheckOutput(ctx, rdb, slackClient, output, config)
+	}
+
+	// Replies to /issue subcommands
+	switch output.Type {
+	case "slash-vibe-issue-list", "slash-vibe-issue-search", "slash-vibe-issue-close", "slash-vibe-issue-assign-user":
+		return handleSubcommandOutput(ctx, output)
+	}
+
+	// Follow-up commands need no further action unless they failed
+	switch output.Type {
+	case "slash-vibe-issue-project", "slash-vibe-issue-assign-copilot", "slash-vibe-issue-assign-jules", "slash-vibe-issue-comment":
+		if reason, failed := poppitFailure(output); failed {
+			notifyCommandFailure(ctx, rdb, slackClient, output, reason, config)
+		}
+		return nil
 	}
 
 	// Only handle slash-vibe-issue type
 	if output.Type != "slash-vibe-issue" {
-		return
+		ignoreEvent(ctx)
+		return nil
 	}
 
-	Debug("Received Poppit output for slash-vibe-issue")
+	DebugContext(ctx, "Received Poppit output for slash-vibe-issue")
 
 	// Extract metadata
 	metadata := output.Metadata
 	if metadata == nil {
-		Warn("No metadata in Poppit output")
-		return
+		WarnContext(ctx, "No metadata in Poppit output")
+		return nil
 	}
 
 	repo, _ := metadata["repo"].(string)
@@ -68,95 +84,136 @@ func handlePoppitOutput(ctx context.Context, rdb *redis.Client, slackClient *sla
 	assignedToCopilot, _ := metadata["assignedToCopilot"].(bool)
 	shouldSanitiseIssue, _ := metadata["sanitiseIssue"].(bool)
 	deferCopilotAssignment, _ := metadata["deferCopilotAssignment"].(bool)
+	userID, _ := metadata["user_id"].(string)
+	milestone, _ := metadata["milestone"].(string)
+	githubLogin, _ := metadata["github_login"].(string)
+	sourceChannel, _ := metadata["source_channel"].(string)
+	sourceTs, _ := metadata["source_ts"].(string)
 
 	if repo == "" || title == "" || username == "" {
-		Warn("Missing required metadata: repo=%s, title=%s, username=%s", repo, title, username)
-		return
+		WarnContext(ctx, "Missing required metadata: repo=%s, title=%s, username=%s", repo, title, username)
+		return nil
 	}
 
 	// Only process output from "gh issue create" commands
 	if !strings.HasPrefix(output.Command, "gh issue create") {
-		Debug("Ignoring non-issue-create command: %s", output.Command)
-		return
+		DebugContext(ctx, "Ignoring non-issue-create command: %s", output.Command)
+		return nil
+	}
+
+	if reason, failed := poppitFailure(output); failed {
+		notifyCommandFailure(ctx, rdb, slackClient, output, reason, config)
+		return nil
 	}
 
 	// Parse issue URL from output
 	issueURL := extractIssueURL(output.Output)
 	if issueURL == "" {
-		Error("Failed to extract issue URL from output: %s", output.Output)
-		return
+		notifyCommandFailure(ctx, rdb, slackClient, output,
+			firstNonEmpty(output.Output, "gh issue create produced no issue URL"), config)
+		return nil
 	}
 
-	Info("Extracted issue URL: %s", issueURL)
+	InfoContext(ctx, "Extracted issue URL: %s", issueURL)
+
+	confirmation := IssueConfirmation{
+		Repo:              repo,
+		Title:             title,
+		Username:          username,
+		IssueURL:          issueURL,
+		AssignedToCopilot: assignedToCopilot,
+		Labels:            metadataStrings(metadata["labels"]),
+		Assignees:         metadataStrings(metadata["assignees"]),
+		Milestone:         milestone,
+		GitHubLogin:       githubLogin,
+		CorrelationID:     correlationID(ctx),
+		SourceChannel:     sourceChannel,
+		SourceTs:          sourceTs,
+	}
+
+	// Tell the author of the message the issue was created from
+	if err := postIssueThreadReply(ctx, rdb, confirmation, config); err != nil {
+		ErrorContext(ctx, "Error replying in the source thread: %v", err)
+	}
 
 	// Check if we should add to project
 	addToProject, _ := metadata["addToProject"].(bool)
 	if addToProject {
-		Debug("Adding issue to project")
-		err := addIssueToProject(ctx, rdb, issueURL, config)
+		DebugContext(ctx, "Adding issue to project")
+		err := addIssueToProject(ctx, rdb, issueURL, userID, config)
 		if err != nil {
-			Error("Error adding issue to project: %v", err)
+			ErrorContext(ctx, "Error adding issue to project: %v", err)
 		}
 	}
 
 	// Check if we should sanitise the issue
 	// Only sanitise if not already assigned to Copilot (assignedToCopilot is false when deferring)
 	if shouldSanitiseIssue && !assignedToCopilot {
-		Debug("Triggering automatic issue sanitisation")
+		DebugContext(ctx, "Triggering automatic issue sanitisation")
 
 		// Send the confirmation message first via HTTP so we get the channel and ts
 		// back synchronously, then immediately add the :brain: reaction to it.
 		if config.SlackLinerURL != "" {
-			channelID, messageTs, httpErr := sendConfirmationHTTP(ctx, repo, title, username, issueURL, assignedToCopilot, config)
+			channelID, messageTs, httpErr := sendIndexedConfirmation(ctx, rdb, confirmation, config)
 			if httpErr != nil {
-				Error("Error sending confirmation via HTTP: %v", httpErr)
+				ErrorContext(ctx, "Error sending confirmation via HTTP: %v", httpErr)
 			} else if channelID != "" && messageTs != "" {
 				// Add :brain: reaction to indicate sanitisation is starting
 				reactionErr := sendReactionToSlackLiner(ctx, rdb, issueSanitisingReactionEmoji, channelID, messageTs, config)
 				if reactionErr != nil {
-					Error("Error sending brain reaction: %v", reactionErr)
+					ErrorContext(ctx, "Error sending brain reaction: %v", reactionErr)
 				} else {
-					Debug("Sent %s reaction for sanitisation start", issueSanitisingReactionEmoji)
+					DebugContext(ctx, "Sent %s reaction for sanitisation start", issueSanitisingReactionEmoji)
 				}
 			}
 
 			// Trigger issue sanitisation
-			err := sanitiseIssue(ctx, rdb, issueURL, repo, deferCopilotAssignment, config)
+			err := sanitiseIssue(ctx, rdb, issueURL, repo, userID, deferCopilotAssignment, config)
 			if err != nil {
-				Error("Error triggering issue sanitisation: %v", err)
+				ErrorContext(ctx, "Error triggering issue sanitisation: %v", err)
 			} else {
-				Info("Automatic issue sanitisation triggered for: %s", issueURL)
+				InfoContext(ctx, "Automatic issue sanitisation triggered for: %s", issueURL)
 			}
 
 			// Confirmation already sent via HTTP; return early.
-			return
+			return nil
 		}
 
 		// SlackLiner URL not configured: fall back to searching for the message
 		// after the confirmation has been published via Redis.  This means the
 		// brain reaction may fail if the message has not yet been delivered.
-		channelID, messageTs, findErr := findMessageByIssueURL(ctx, slackClient, issueURL, config)
+		channelID, messageTs, findErr := findMessageByIssueURL(ctx, rdb, slackClient, issueURL, config)
 		if findErr != nil {
-			Error("Error finding message for brain reaction: %v", findErr)
+			ErrorContext(ctx, "Error finding message for brain reaction: %v", findErr)
 		} else if channelID != "" && messageTs != "" {
 			// Add :brain: reaction to indicate sanitisation is starting
 			reactionErr := sendReactionToSlackLiner(ctx, rdb, issueSanitisingReactionEmoji, channelID, messageTs, config)
 			if reactionErr != nil {
-				Error("Error sending brain reaction: %v", reactionErr)
+				ErrorContext(ctx, "Error sending brain reaction: %v", reactionErr)
 			} else {
-				Debug("Sent %s reaction for sanitisation start", issueSanitisingReactionEmoji)
+				DebugContext(ctx, "Sent %s reaction for sanitisation start", issueSanitisingReactionEmoji)
 			}
 		}
 
 		// Trigger issue sanitisation
-		err := sanitiseIssue(ctx, rdb, issueURL, repo, deferCopilotAssignment, config)
+		err := sanitiseIssue(ctx, rdb, issueURL, repo, userID, deferCopilotAssignment, config)
 		if err != nil {
-			Error("Error triggering issue sanitisation: %v", err)
+			ErrorContext(ctx, "Error triggering issue sanitisation: %v", err)
 		} else {
-			Info("Automatic issue sanitisation triggered for: %s", issueURL)
+			InfoContext(ctx, "Automatic issue sanitisation triggered for: %s", issueURL)
+		}
+	}
+
+	// Prefer the SlackLiner HTTP API so the confirmation can be indexed; fall back
+	// to the Redis list when it is not configured or the request fails.
+	if config.SlackLinerURL != "" {
+		_, _, httpErr := sendIndexedConfirmation(ctx, rdb, confirmation, config)
+		if httpErr == nil {
+			return nil
 		}
+		ErrorContext(ctx, "Error sending confirmation via HTTP, falling back to Redis: %v", httpErr)
 	}
 
 	// Send confirmation message with issue URL
-	sendConfirmation(ctx, rdb, repo, title, username, issueURL, assignedToCopilot, config)
+	return sendConfirmation(ctx, rdb, confirmation, config)
 }
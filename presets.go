@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// issuePreset pre-fills the create-issue modal, either from its trigger
+// ("/issue :sparkles:", "/issue bug Login is broken") or by name
+// ("/issue preset copilot-instructions").  Title and body are text/template
+// templates executed with presetData.
+type issuePreset struct {
+	Name            string   `yaml:"name"`
+	Trigger         string   `yaml:"trigger"`
+	Title           string   `yaml:"title"`
+	Body            string   `yaml:"body"`
+	Repo            string   `yaml:"repo"`
+	Labels          []string `yaml:"labels"`
+	AssignToCopilot bool     `yaml:"assign_to_copilot"`
+	AddToProject    *bool    `yaml:"add_to_project"`
+	SanitiseIssue   bool     `yaml:"sanitise_issue"`
+	AssignToMe      bool     `yaml:"assign_to_me"`
+}
+
+// presetData is available to preset title and body templates.
+type presetData struct {
+	// Text is whatever followed the trigger, e.g. "Login is broken"
+	Text        string
+	Username    string
+	UserID      string
+	ChannelID   string
+	ChannelName string
+	Date        string
+}
+
+// defaultPresets are used when config.yaml defines no presets.
+func defaultPresets() []issuePreset {
+	return []issuePreset{
+		{
+			Name:            "copilot-instructions",
+			Trigger:         ":sparkles:",
+			Title:           "✨ Set up Copilot instructions",
+			Body:            "Configure instructions for this repository as documented in [Best practices for Copilot coding agent in your repository](https://gh.io/copilot-coding-agent-tips).\n\n<Onboard this repo>",
+			AssignToCopilot: true,
+		},
+	}
+}
+
+// loadPresets returns the configured presets, dropping any that are unnamed
+// or whose templates do not parse.  With none configured the defaults apply.
+// Dropped presets, and triggers that a subcommand takes over, are returned as
+// problems for Validate.
+func loadPresets(presets []issuePreset) ([]issuePreset, []error) {
+	if len(presets) == 0 {
+		return defaultPresets(), nil
+	}
+
+	var valid []issuePreset
+	var problems []error
+	problemf := func(format string, args ...interface{}) {
+		problem := fmt.Errorf("presets: "+format, args...)
+		Warn("%v", problem)
+		problems = append(problems, problem)
+	}
+	for i, preset := range presets {
+		if preset.Name == "" {
+			problemf("preset %d has no name", i+1)
+			continue
+		}
+		if sub, _, ok := lookupSubcommand(preset.Trigger); ok {
+			problemf("preset %s trigger %q is shadowed by the /issue %s subcommand", preset.Name, preset.Trigger, sub.Name)
+		}
+		if err := preset.validate(); err != nil {
+			problemf("preset %s: %v", preset.Name, err)
+			continue
+		}
+		valid = append(valid, preset)
+	}
+	return valid, problems
+}
+
+func (p issuePreset) validate() error {
+	for field, text := range map[string]string{"title": p.Title, "body": p.Body} {
+		if _, err := template.New(field).Parse(text); err != nil {
+			return fmt.Errorf("invalid %s template: %v", field, err)
+		}
+	}
+	return nil
+}
+
+// findPreset returns the preset with the given name.
+func findPreset(presets []issuePreset, name string) (issuePreset, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return issuePreset{}, false
+	}
+	for _, preset := range presets {
+		if strings.EqualFold(preset.Name, name) {
+			return preset, true
+		}
+	}
+	return issuePreset{}, false
+}
+
+// matchPresetTrigger returns the preset whose trigger starts text, and the
+// text that follows the trigger.
+func matchPresetTrigger(presets []issuePreset, text string) (issuePreset, string, bool) {
+	for _, preset := range presets {
+		if preset.Trigger == "" {
+			continue
+		}
+		if text == preset.Trigger {
+			return preset, "", true
+		}
+		if rest, ok := strings.CutPrefix(text, preset.Trigger+" "); ok {
+			return preset, strings.TrimSpace(rest), true
+		}
+	}
+	return issuePreset{}, "", false
+}
+
+// modalOptions renders the preset into the modal's initial state.
+func (p issuePreset) modalOptions(data presetData) (issueModalOptions, error) {
+	title, err := renderPresetTemplate(p.Name+" title", p.Title, data)
+	if err != nil {
+		return issueModalOptions{}, err
+	}
+	body, err := renderPresetTemplate(p.Name+" body", p.Body, data)
+	if err != nil {
+		return issueModalOptions{}, err
+	}
+
+	// A preset without a title template takes the text after its trigger
+	if strings.TrimSpace(p.Title) == "" {
+		title = data.Text
+	}
+
+	addToProject := true
+	if p.AddToProject != nil {
+		addToProject = *p.AddToProject
+	}
+
+	return issueModalOptions{
+		Title:           strings.TrimSpace(title),
+		Description:     strings.TrimSpace(body),
+		Repo:            p.Repo,
+		AssignToCopilot: p.AssignToCopilot,
+		AddToProject:    addToProject,
+		SanitiseIssue:   p.SanitiseIssue,
+		AssignToMe:      p.AssignToMe,
+		Metadata:        IssueModalMetadata{Labels: p.Labels},
+	}, nil
+}
+
+func renderPresetTemplate(name, text string, data presetData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing preset %s template: %v", name, err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("error rendering preset %s template: %v", name, err)
+	}
+	return out.String(), nil
+}
+
+// openPresetModal opens the create-issue modal pre-filled from preset.  When
+// the preset names a repository its templates, labels and so on are loaded
+// straight away, as if the user had picked it.
+func openPresetModal(ctx context.Context, rdb RedisClient, slackClient SlackAPI, cmd SlackCommand, preset issuePreset, text string, config Config) error {
+	opts, err := preset.modalOptions(presetData{
+		Text:        text,
+		Username:    cmd.UserName,
+		UserID:      cmd.UserID,
+		ChannelID:   cmd.ChannelID,
+		ChannelName: cmd.ChannelName,
+		Date:        time.Now().Format("2006-01-02"),
+	})
+	if err != nil {
+		return err
+	}
+
+	opts.Metadata.SourceChannel = cmd.ChannelID
+
+	view, err := slackClient.OpenView(cmd.TriggerID, createIssueModalWithOptions(opts))
+	if err != nil {
+		return fmt.Errorf("error opening modal: %v", err)
+	}
+
+	DebugContext(ctx, "Modal opened with preset %s", preset.Name)
+
+	if opts.Repo != "" && view != nil {
+		if err := requestRepoDetails(ctx, rdb, view.ID, cmd.UserID, opts, config); err != nil {
+			WarnContext(ctx, "Error loading details for preset %s repo %s: %v", preset.Name, opts.Repo, err)
+		}
+	}
+	return nil
+}
@@ -3,62 +3,54 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/slack-go/slack"
 )
 
-func subscribeToReactions(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, config Config) {
-	pubsub := rdb.Subscribe(ctx, config.RedisReactionChannel)
-	defer pubsub.Close()
-
-	Info("Subscribed to Redis channel: %s", config.RedisReactionChannel)
-
-	ch := pubsub.Channel()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case msg := <-ch:
-			if msg == nil {
-				continue
-			}
-			handleReactionAdded(ctx, rdb, slackClient, msg.Payload, config)
-		}
+func subscribeToReactions(ctx context.Context, rdb *redis.Client, slackClient SlackAPI, config Config) error {
+	handler := func(ctx context.Context, payload string) error {
+		return handleReactionAdded(ctx, rdb, slackClient, payload, currentConfig())
 	}
+	return consumeChannel(ctx, rdb, config.RedisReactionChannel, "reactions", config,
+		withIdempotency(rdb, "reactions", config, payloadKey("event_id"), handler))
 }
 
-func handleReactionAdded(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, payload string, config Config) {
+func handleReactionAdded(ctx context.Context, rdb RedisClient, slackClient SlackAPI, payload string, config Config) error {
 	var reaction ReactionAddedEvent
 	if err := json.Unmarshal([]byte(payload), &reaction); err != nil {
-		Error("Error unmarshaling reaction event: %v", err)
-		return
+		return fmt.Errorf("error unmarshaling reaction event: %v", err)
 	}
 
 	// Only handle reaction_added events
 	if reaction.Event.Type != "reaction_added" {
-		return
+		ignoreEvent(ctx)
+		return nil
 	}
 
 	// Ignore reactions from bots
 	for _, auth := range reaction.Authorizations {
 		if auth.IsBot && auth.UserID == reaction.Event.User {
-			Debug("Ignoring reaction from bot user: %s", reaction.Event.User)
-			return
+			DebugContext(ctx, "Ignoring reaction from bot user: %s", reaction.Event.User)
+			ignoreEvent(ctx)
+			return nil
 		}
 	}
 
 	// Only handle sparkles, ticket or octopus emoji
 	if reaction.Event.Reaction != "sparkles" && reaction.Event.Reaction != "ticket" && reaction.Event.Reaction != julesReactionEmoji {
-		return
+		ignoreEvent(ctx)
+		return nil
 	}
 
 	// Only handle message reactions
 	if reaction.Event.Item.Type != "message" {
-		return
+		ignoreEvent(ctx)
+		return nil
 	}
 
-	Info("Received %s reaction from user %s on message %s", reaction.Event.Reaction, reaction.Event.User, reaction.Event.Item.Ts)
+	InfoContext(ctx, "Received %s reaction from user %s on message %s", reaction.Event.Reaction, reaction.Event.User, reaction.Event.Item.Ts)
 
 	// Fetch the message from Slack to get metadata
 	historyParams := &slack.GetConversationHistoryParameters{
@@ -71,21 +63,20 @@ func handleReactionAdded(ctx context.Context, rdb *redis.Client, slackClient *sl
 
 	history, err := slackClient.GetConversationHistory(historyParams)
 	if err != nil {
-		Error("Error fetching message from Slack: %v", err)
-		return
+		return fmt.Errorf("error fetching message from Slack: %v", err)
 	}
 
 	if len(history.Messages) == 0 {
-		Warn("No message found for timestamp: %s", reaction.Event.Item.Ts)
-		return
+		WarnContext(ctx, "No message found for timestamp: %s", reaction.Event.Item.Ts)
+		return nil
 	}
 
 	message := history.Messages[0]
 
 	// Check if message has metadata
 	if message.Metadata.EventType == "" {
-		Debug("Message has no metadata, ignoring reaction")
-		return
+		DebugContext(ctx, "Message has no metadata, ignoring reaction")
+		return nil
 	}
 
 	// Parse metadata
@@ -95,18 +86,19 @@ func handleReactionAdded(ctx context.Context, rdb *redis.Client, slackClient *sl
 	// Convert EventPayload to map
 	if payloadBytes, err := json.Marshal(message.Metadata.EventPayload); err == nil {
 		if err := json.Unmarshal(payloadBytes, &metadata.EventPayload); err != nil {
-			Error("Error unmarshaling event payload: %v", err)
-			return
+			return fmt.Errorf("error unmarshaling event payload: %v", err)
 		}
 	} else {
-		Error("Error marshaling event payload: %v", err)
-		return
+		return fmt.Errorf("error marshaling event payload: %v", err)
 	}
 
+	// Follow-up commands continue the issue's correlation ID
+	ctx = withMetadataCorrelationID(ctx, metadata.EventPayload)
+
 	// Check if it's an issue_created event
 	if metadata.EventType != issueCreatedEventType {
-		Debug("Event type is not issue_created: %s", metadata.EventType)
-		return
+		DebugContext(ctx, "Event type is not issue_created: %s", metadata.EventType)
+		return nil
 	}
 
 	// Extract issue data from metadata
@@ -115,65 +107,64 @@ func handleReactionAdded(ctx context.Context, rdb *redis.Client, slackClient *sl
 	assignedToCopilot, _ := metadata.EventPayload["assignedToCopilot"].(bool)
 
 	if issueURL == "" {
-		Warn("Missing issue_url in metadata")
-		return
+		WarnContext(ctx, "Missing issue_url in metadata")
+		return nil
 	}
 
 	// Handle different reactions
 	switch reaction.Event.Reaction {
 	case julesReactionEmoji:
-		Info("Assigning issue to Jules: %s", issueURL)
+		InfoContext(ctx, "Assigning issue to Jules: %s", issueURL)
 
 		// Add jules label to issue
-		err = assignIssueToJules(ctx, rdb, issueURL, repository, config)
+		err = assignIssueToJules(ctx, rdb, issueURL, repository, reaction.Event.User, config)
 		if err != nil {
-			Error("Error assigning issue to Jules: %v", err)
-			return
+			return fmt.Errorf("error assigning issue to Jules: %v", err)
 		}
 
-		Info("Successfully sent Jules assignment command for: %s", issueURL)
+		InfoContext(ctx, "Successfully sent Jules assignment command for: %s", issueURL)
 	case "sparkles":
 		if assignedToCopilot {
-			Debug("Issue already assigned to Copilot, ignoring reaction: %s", issueURL)
-			return
+			DebugContext(ctx, "Issue already assigned to Copilot, ignoring reaction: %s", issueURL)
+			return nil
 		}
 
-		Info("Assigning issue to Copilot: %s", issueURL)
+		InfoContext(ctx, "Assigning issue to Copilot: %s", issueURL)
 
 		// Assign issue to Copilot
-		err = assignIssueToCopilot(ctx, rdb, issueURL, repository, config)
+		err = assignIssueToCopilot(ctx, rdb, issueURL, repository, reaction.Event.User, config)
 		if err != nil {
-			Error("Error assigning issue to Copilot: %v", err)
-			return
+			return fmt.Errorf("error assigning issue to Copilot: %v", err)
 		}
 
-		Info("Successfully assigned issue to Copilot: %s", issueURL)
+		InfoContext(ctx, "Successfully assigned issue to Copilot: %s", issueURL)
 	case "ticket":
 		// Handle issue sanitisation
 		// Skip if repository metadata is missing or issue is already assigned to Copilot
 		// (Copilot-assigned issues will be handled by Copilot itself)
 		if repository == "" || assignedToCopilot {
-			Debug("Skipping sanitisation: repository=%s, assignedToCopilot=%v", repository, assignedToCopilot)
-			return
+			DebugContext(ctx, "Skipping sanitisation: repository=%s, assignedToCopilot=%v", repository, assignedToCopilot)
+			return nil
 		}
 
-		Info("Triggering issue sanitisation for: %s", issueURL)
+		InfoContext(ctx, "Triggering issue sanitisation for: %s", issueURL)
 
 		// Add :brain: reaction to indicate sanitisation is starting
 		reactionErr := sendReactionToSlackLiner(ctx, rdb, issueSanitisingReactionEmoji, reaction.Event.Item.Channel, reaction.Event.Item.Ts, config)
 		if reactionErr != nil {
-			Error("Error sending brain reaction: %v", reactionErr)
+			ErrorContext(ctx, "Error sending brain reaction: %v", reactionErr)
 		} else {
-			Debug("Sent %s reaction for sanitisation start", issueSanitisingReactionEmoji)
+			DebugContext(ctx, "Sent %s reaction for sanitisation start", issueSanitisingReactionEmoji)
 		}
 
 		// Trigger issue sanitisation (no deferred copilot assignment for manual sanitisation)
-		err = sanitiseIssue(ctx, rdb, issueURL, repository, false, config)
+		err = sanitiseIssue(ctx, rdb, issueURL, repository, reaction.Event.User, false, config)
 		if err != nil {
-			Error("Error sanitising issue: %v", err)
-			return
+			return fmt.Errorf("error sanitising issue: %v", err)
 		}
 
-		Info("Successfully triggered issue sanitisation: %s", issueURL)
+		InfoContext(ctx, "Successfully triggered issue sanitisation: %s", issueURL)
 	}
+
+	return nil
 }
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+const configPollInterval = 5 * time.Second
+
+// reloadableSettings are applied when the config file is reloaded.  Everything
+// else shapes the Redis connection, subscriptions or HTTP server and only
+// takes effect on restart.
+var reloadableSettings = map[string]bool{
+	"CONFIRMATION_CHANNEL_ID":   true,
+	"CONFIRMATION_TTL":          true,
+	"CONFIRMATION_SEARCH_LIMIT": true,
+	"REPO_DETAILS_TTL":          true,
+	"PENDING_ISSUE_TTL":         true,
+	"FAILED_COMMAND_TTL":        true,
+	"ISSUE_THREAD_TTL":          true,
+	"ISSUE_SOURCE_FOOTER":       true,
+	"ATTACHMENT_MAX_BYTES":      true,
+	"ATTACHMENT_TYPES":          true,
+	"GITHUB_LINK_ADMINS":        true,
+	"PROJECT_ID":                true,
+	"PROJECT_ORG":               true,
+	"LOG_LEVEL":                 true,
+	"presets":                   true,
+	"confirmation_routes":       true,
+}
+
+var configReloads = newCounterVec("slashvibeissue_config_reloads_total",
+	"Config file reloads, by result.", "result")
+
+// runtimeConfig is the configuration handlers read for each event.  main
+// stores the startup config in it; reloads replace it.
+var runtimeConfig atomic.Pointer[Config]
+
+// currentConfig returns the configuration in effect now.
+func currentConfig() Config {
+	return *runtimeConfig.Load()
+}
+
+// reloadConfig re-reads path and, if the result is valid, applies its
+// reloadable settings to runtimeConfig.  It returns the settings that changed
+// and were applied; an invalid file leaves the running configuration as it is.
+func reloadConfig(path string) ([]string, error) {
+	current := currentConfig()
+	next := loadConfig(path)
+	if err := next.Validate(); err != nil {
+		configReloads.inc("invalid")
+		return nil, err
+	}
+
+	applied, ignored := diffSettings(current, next)
+	for _, key := range ignored {
+		Warn("Config setting %s changed; restart to apply it", key)
+	}
+	if len(applied) == 0 {
+		configReloads.inc("unchanged")
+		return nil, nil
+	}
+
+	updated := applyReloadable(current, next)
+	runtimeConfig.Store(&updated)
+	if updated.LogLevel != current.LogLevel {
+		SetLogLevel(updated.LogLevel)
+	}
+	configReloads.inc("applied")
+	return applied, nil
+}
+
+// diffSettings lists the settings whose value differs between current and
+// next, split into those a reload applies and those that need a restart.
+func diffSettings(current, next Config) (applied, ignored []string) {
+	before := make(map[string]string, len(current.settings))
+	for _, s := range current.settings {
+		before[s.Key] = s.Value
+	}
+	for _, s := range next.settings {
+		changed := before[s.Key] != s.Value
+		switch s.Key {
+		case "presets":
+			changed = !reflect.DeepEqual(current.Presets, next.Presets)
+		case "confirmation_routes":
+			changed = !reflect.DeepEqual(current.ConfirmationRoutes, next.ConfirmationRoutes)
+		case "github_logins":
+			changed = !reflect.DeepEqual(current.GitHubLogins, next.GitHubLogins)
+		}
+		if !changed {
+			continue
+		}
+		if reloadableSettings[s.Key] {
+			applied = append(applied, s.Key)
+		} else {
+			ignored = append(ignored, s.Key)
+		}
+	}
+	return applied, ignored
+}
+
+// applyReloadable returns current with the reloadable settings taken from next.
+func applyReloadable(current, next Config) Config {
+	current.ConfirmationChannelID = next.ConfirmationChannelID
+	current.ConfirmationTTL = next.ConfirmationTTL
+	current.ConfirmationSearchLimit = next.ConfirmationSearchLimit
+	current.RepoDetailsTTL = next.RepoDetailsTTL
+	current.PendingIssueTTL = next.PendingIssueTTL
+	current.FailedCommandTTL = next.FailedCommandTTL
+	current.IssueThreadTTL = next.IssueThreadTTL
+	current.IssueSourceFooter = next.IssueSourceFooter
+	current.AttachmentMaxBytes = next.AttachmentMaxBytes
+	current.AttachmentTypes = next.AttachmentTypes
+	current.GitHubLinkAdmins = next.GitHubLinkAdmins
+	current.ProjectID = next.ProjectID
+	current.ProjectOrg = next.ProjectOrg
+	current.LogLevel = next.LogLevel
+	current.Presets = next.Presets
+	current.ConfirmationRoutes = next.ConfirmationRoutes
+
+	// Diff the next reload against this file, so a restart-only change is
+	// warned about once rather than on every reload
+	current.settings = next.settings
+	return current
+}
+
+// watchConfig reloads the config file at path when its modification time
+// changes or the process receives SIGHUP, until ctx is cancelled.
+func watchConfig(ctx context.Context, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+
+		modTime := configModTime(path)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				Info("Received SIGHUP, reloading %s", path)
+			case <-ticker.C:
+				t := configModTime(path)
+				if t.Equal(modTime) {
+					continue
+				}
+				modTime = t
+				Info("%s changed, reloading", path)
+			}
+
+			applied, err := reloadConfig(path)
+			switch {
+			case err != nil:
+				for _, problem := range strings.Split(err.Error(), "\n") {
+					Error("Not reloading invalid configuration: %s", problem)
+				}
+			case len(applied) == 0:
+				Info("Configuration reloaded, no changes to apply")
+			default:
+				Info("Configuration reloaded: %s", strings.Join(applied, ", "))
+			}
+		}
+	}()
+}
+
+// configModTime returns the modification time of path, or the zero time if it
+// does not exist.
+func configModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// eventHandler is the signature shared by the handle* functions.
+type eventHandler func(ctx context.Context, rdb RedisClient, slackClient SlackAPI, payload string, config Config) error
+
+// channelHandlers maps each source channel to the function that handles its events.
+func channelHandlers(config Config) map[string]eventHandler {
+	return map[string]eventHandler{
+		config.RedisChannel:               handleSlashCommand,
+		config.RedisViewSubmissionChannel: handleViewSubmission,
+		config.RedisPoppitOutputChannel:   handlePoppitOutput,
+		config.RedisReactionChannel:       handleReactionAdded,
+		config.RedisMessageActionChannel:  handleMessageAction,
+		config.RedisGitHubWebhookChannel:  handleGitHubIssueEvent,
+		config.RedisBlockActionChannel:    handleBlockAction,
+	}
+}
+
+// parseSince parses the --since flag: a duration back from now, such as "2h",
+// or an RFC 3339 timestamp.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q: use a duration such as 2h or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+// runReplay implements "slashvibeissue replay --channel <name> [--since <when>]".
+// Each dead-lettered event of the channel is handed to its handle* function
+// again, skipping the idempotency check, and removed from the list if it now
+// succeeds.  It returns the process exit code.
+func runReplay(ctx context.Context, rdb RedisClient, slackClient SlackAPI, config Config, args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(out)
+	channel := flags.String("channel", "", "source channel whose dead-lettered events are replayed")
+	sinceFlag := flags.String("since", "", "only replay events that failed after this duration ago (e.g. 2h) or RFC 3339 time")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	handlers := channelHandlers(config)
+	handle, ok := handlers[*channel]
+	if !ok {
+		fmt.Fprintf(out, "unknown --channel %q; expected one of: %s\n", *channel, strings.Join(sortedKeys(handlers), ", "))
+		return 2
+	}
+	since, err := parseSince(*sinceFlag, time.Now())
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+
+	key := deadLetterKey(*channel, config)
+	entries, err := rdb.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		fmt.Fprintf(out, "error reading %s: %v\n", key, err)
+		return 1
+	}
+
+	var replayed, failed int
+	for _, raw := range entries {
+		var entry deadLetter
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			fmt.Fprintf(out, "skipping unreadable entry: %v\n", err)
+			continue
+		}
+		if failedAt, err := time.Parse(time.RFC3339, entry.FailedAt); err == nil && failedAt.Before(since) {
+			continue
+		}
+
+		if err := replayEvent(ctx, rdb, slackClient, handle, entry, config); err != nil {
+			failed++
+			fmt.Fprintf(out, "failed  %s %s: %v\n", entry.FailedAt, entry.Handler, err)
+			continue
+		}
+		if err := rdb.LRem(ctx, key, 1, raw).Err(); err != nil {
+			fmt.Fprintf(out, "replayed %s %s but could not remove it: %v\n", entry.FailedAt, entry.Handler, err)
+		} else {
+			fmt.Fprintf(out, "replayed %s %s\n", entry.FailedAt, entry.Handler)
+		}
+		replayed++
+	}
+
+	fmt.Fprintf(out, "%d replayed, %d failed (%s)\n", replayed, failed, key)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// replayEvent runs one dead-lettered event through handle, under its original
+// correlation ID.  A panic is returned as an error.
+func replayEvent(ctx context.Context, rdb RedisClient, slackClient SlackAPI, handle eventHandler, entry deadLetter, config Config) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	if entry.CorrelationID == "" {
+		entry.CorrelationID = newCorrelationID()
+	}
+	ctx = withCorrelationID(ctx, entry.CorrelationID)
+	return handle(ctx, rdb, slackClient, entry.Payload, config)
+}
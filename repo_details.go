@@ -0,0 +1,621 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+)
+
+// maxRepoDetailsItems caps how many labels, assignable users and milestones
+// are fetched for a repository, a page of 100 at a time.  The pickers are
+// static selects, as this service cannot answer Slack's options requests, so
+// the whole list is sent in every view update; past 100 it is shown in option
+// groups of 100
+const maxRepoDetailsItems = 300
+
+// repoDetailsQuery fetches everything the modal needs to know about a
+// repository: the files under .github/ISSUE_TEMPLATE, its labels, the users
+// who can be assigned and its open milestones.  The first request fetches
+// the templates and the first page of each list; later ones fetch only the
+// next page of the lists that have more.
+const repoDetailsQuery = `query($owner: String!, $name: String!, $templates: Boolean!,
+    $labels: Boolean!, $labelsAfter: String,
+    $assignees: Boolean!, $assigneesAfter: String,
+    $milestones: Boolean!, $milestonesAfter: String) {
+  repository(owner: $owner, name: $name) {
+    issueTemplates: object(expression: "HEAD:.github/ISSUE_TEMPLATE") @include(if: $templates) {
+      ... on Tree {
+        entries {
+          name
+          object {
+            ... on Blob {
+              text
+            }
+          }
+        }
+      }
+    }
+    labels(first: 100, after: $labelsAfter, orderBy: {field: NAME, direction: ASC}) @include(if: $labels) {
+      totalCount
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        name
+        description
+      }
+    }
+    assignableUsers(first: 100, after: $assigneesAfter) @include(if: $assignees) {
+      totalCount
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        login
+        name
+      }
+    }
+    milestones(first: 100, after: $milestonesAfter, states: OPEN, orderBy: {field: DUE_DATE, direction: ASC}) @include(if: $milestones) {
+      totalCount
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        title
+        number
+      }
+    }
+  }
+}`
+
+// repoDetailsResponse mirrors the gh api graphql output for repoDetailsQuery.
+type repoDetailsResponse struct {
+	Data struct {
+		Repository *struct {
+			IssueTemplates *struct {
+				Entries []struct {
+					Name   string `json:"name"`
+					Object *struct {
+						Text *string `json:"text"`
+					} `json:"object"`
+				} `json:"entries"`
+			} `json:"issueTemplates"`
+			Labels          *repoConnection[RepoLabel]     `json:"labels"`
+			AssignableUsers *repoConnection[RepoUser]      `json:"assignableUsers"`
+			Milestones      *repoConnection[RepoMilestone] `json:"milestones"`
+		} `json:"repository"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// repoConnection is one page of a GraphQL connection in repoDetailsResponse.
+type repoConnection[T any] struct {
+	TotalCount int `json:"totalCount"`
+	PageInfo   struct {
+		HasNextPage bool   `json:"hasNextPage"`
+		EndCursor   string `json:"endCursor"`
+	} `json:"pageInfo"`
+	Nodes []T `json:"nodes"`
+}
+
+// next returns the cursor of the page after this one, or "" if it was the
+// last.
+func (c *repoConnection[T]) next() string {
+	if c == nil || !c.PageInfo.HasNextPage {
+		return ""
+	}
+	return c.PageInfo.EndCursor
+}
+
+// repoDetailsCursors says which page of each list to fetch next; an empty
+// cursor means the list is complete.
+type repoDetailsCursors struct {
+	Labels     string
+	Assignees  string
+	Milestones string
+}
+
+func (c repoDetailsCursors) done() bool {
+	return c == repoDetailsCursors{}
+}
+
+// repoDetailsCursorsFrom reads the cursors a repo details command was sent
+// with back from its metadata.
+func repoDetailsCursorsFrom(metadata map[string]interface{}) repoDetailsCursors {
+	var cursors repoDetailsCursors
+	cursors.Labels, _ = metadata["labels_after"].(string)
+	cursors.Assignees, _ = metadata["assignees_after"].(string)
+	cursors.Milestones, _ = metadata["milestones_after"].(string)
+	return cursors
+}
+
+// repoDetailsKey returns the Redis key caching the repo details for a modal.
+func repoDetailsKey(viewID string, config Config) string {
+	return config.RedisRepoDetailsPrefix + viewID
+}
+
+func storeRepoDetails(ctx context.Context, rdb RedisClient, viewID string, details RepoDetails, config Config) error {
+	payload, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal repo details: %v", err)
+	}
+
+	ttl := time.Duration(config.RepoDetailsTTL) * time.Second
+	if err := rdb.Set(ctx, repoDetailsKey(viewID, config), payload, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store repo details: %v", err)
+	}
+	return nil
+}
+
+// loadRepoDetails returns the cached repo details for a modal, reporting
+// whether they were found.
+func loadRepoDetails(ctx context.Context, rdb RedisClient, viewID string, config Config) (RepoDetails, bool, error) {
+	data, err := rdb.Get(ctx, repoDetailsKey(viewID, config)).Result()
+	if errors.Is(err, redis.Nil) {
+		return RepoDetails{}, false, nil
+	}
+	if err != nil {
+		return RepoDetails{}, false, fmt.Errorf("failed to load repo details: %v", err)
+	}
+
+	var details RepoDetails
+	if err := json.Unmarshal([]byte(data), &details); err != nil {
+		return RepoDetails{}, false, fmt.Errorf("failed to unmarshal repo details: %v", err)
+	}
+	return details, true, nil
+}
+
+// requestRepoDetails asks Poppit to fetch the selected repository's details.
+// The modal's current input travels in the metadata so the modal can be
+// rebuilt around it when the output arrives.
+func requestRepoDetails(ctx context.Context, rdb RedisClient, viewID, userID string, opts issueModalOptions, config Config) error {
+	repoFullName := parseRepoFullName(opts.Repo, config.GitHubOrg)
+	if err := validateRepoFullName(repoFullName); err != nil {
+		return err
+	}
+
+	modal, err := json.Marshal(opts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal modal state: %v", err)
+	}
+
+	return pushRepoDetailsCommand(ctx, rdb, repoFullName, viewID, userID, string(modal), repoDetailsCursors{}, config)
+}
+
+// pushRepoDetailsCommand sends the repo details query to Poppit: the first
+// page of everything when cursors is empty, otherwise the pages it points at.
+func pushRepoDetailsCommand(ctx context.Context, rdb RedisClient, repoFullName, viewID, userID, modal string, cursors repoDetailsCursors, config Config) error {
+	first := cursors.done()
+	owner, name, _ := strings.Cut(repoFullName, "/")
+	ghCmd := newShellCommand("gh", "api", "graphql").
+		Flag("-f", "query="+repoDetailsQuery).
+		Flag("-f", "owner="+owner).
+		Flag("-f", "name="+name).
+		Flag("-F", fmt.Sprintf("templates=%t", first)).
+		Flag("-F", fmt.Sprintf("labels=%t", first || cursors.Labels != "")).
+		Flag("-F", fmt.Sprintf("assignees=%t", first || cursors.Assignees != "")).
+		Flag("-F", fmt.Sprintf("milestones=%t", first || cursors.Milestones != ""))
+
+	metadata := map[string]interface{}{
+		"view_id": viewID,
+		"repo":    repoFullName,
+		"user_id": userID,
+		"modal":   modal,
+	}
+	for _, page := range []struct{ variable, key, cursor string }{
+		{"labelsAfter", "labels_after", cursors.Labels},
+		{"assigneesAfter", "assignees_after", cursors.Assignees},
+		{"milestonesAfter", "milestones_after", cursors.Milestones},
+	} {
+		if page.cursor != "" {
+			ghCmd.Flag("-f", page.variable+"="+page.cursor)
+			metadata[page.key] = page.cursor
+		}
+	}
+
+	poppitCmd := PoppitCommand{
+		Repo:     repoFullName,
+		Branch:   "refs/heads/main",
+		Type:     "slash-vibe-issue-repo-details",
+		Dir:      config.WorkingDir,
+		Commands: []string{ghCmd.String()},
+		Metadata: metadata,
+	}
+
+	if err := pushPoppitCommand(ctx, rdb, config.RedisPoppitList, poppitCmd); err != nil {
+		return err
+	}
+
+	DebugContext(ctx, "Repo details command sent to Poppit for repo: %s", repoFullName)
+	return nil
+}
+
+// handleRepoSelected fires when a repository is picked in the create-issue
+// modal and starts loading that repository's issue templates.
+func handleRepoSelected(ctx context.Context, rdb RedisClient, event BlockActionEvent, action BlockAction, config Config) error {
+	if action.SelectedOption == nil || action.SelectedOption.Value == "" {
+		return nil
+	}
+
+	opts := issueModalOptionsFromView(event.View.State.Values, event.View.Blocks)
+	opts.Repo = action.SelectedOption.Value
+	// Template defaults belong to the previously selected repository
+	opts.Metadata = decodeModalMetadata(event.View.PrivateMetadata)
+	opts.Metadata.Template = ""
+	opts.Metadata.Labels = nil
+	opts.Metadata.Assignees = nil
+	opts.Metadata.Milestone = ""
+
+	return requestRepoDetails(ctx, rdb, event.View.ID, event.User.ID, opts, config)
+}
+
+// handleRepoDetailsOutput caches the fetched repo details and rebuilds the
+// modal with a template picker.  While labels, assignable users or milestones
+// have more pages, up to maxRepoDetailsItems, the next page is requested
+// first and the modal is rebuilt once they are all in.
+func handleRepoDetailsOutput(ctx context.Context, rdb RedisClient, slackClient SlackAPI, output PoppitOutput, config Config) error {
+	viewID, _ := output.Metadata["view_id"].(string)
+	repo, _ := output.Metadata["repo"].(string)
+	userID, _ := output.Metadata["user_id"].(string)
+	modal, _ := output.Metadata["modal"].(string)
+	if viewID == "" || repo == "" {
+		WarnContext(ctx, "Missing view_id or repo in repo details metadata")
+		return nil
+	}
+
+	// Earlier pages are cached; the first page starts from nothing
+	cursors := repoDetailsCursorsFrom(output.Metadata)
+	var details RepoDetails
+	if !cursors.done() {
+		var found bool
+		var err error
+		details, found, err = loadRepoDetails(ctx, rdb, viewID, config)
+		if err != nil {
+			return err
+		}
+		if !found {
+			WarnContext(ctx, "No cached details for view %s, dropping the next page for repo %s", viewID, repo)
+			return nil
+		}
+	}
+
+	// The details are a convenience: a failed lookup leaves the modal as it
+	// is, or with the pages fetched so far
+	if reason, failed := poppitFailure(output); failed {
+		WarnContext(ctx, "Could not fetch details for repo %s: %s", repo, reason)
+		if cursors.done() {
+			return nil
+		}
+		return showRepoDetails(ctx, slackClient, viewID, repo, modal, details)
+	}
+
+	page, next, err := parseRepoDetails(repo, output.Output)
+	if err != nil {
+		WarnContext(ctx, "Could not parse details for repo %s: %v", repo, err)
+		if cursors.done() {
+			return nil
+		}
+		return showRepoDetails(ctx, slackClient, viewID, repo, modal, details)
+	}
+
+	if cursors.done() {
+		details = page
+	} else {
+		details.addPage(page, cursors)
+	}
+	if len(details.Labels) >= maxRepoDetailsItems {
+		next.Labels = ""
+	}
+	if len(details.Assignees) >= maxRepoDetailsItems {
+		next.Assignees = ""
+	}
+	if len(details.Milestones) >= maxRepoDetailsItems {
+		next.Milestones = ""
+	}
+
+	if err := storeRepoDetails(ctx, rdb, viewID, details, config); err != nil {
+		return err
+	}
+
+	if !next.done() {
+		return pushRepoDetailsCommand(ctx, rdb, repo, viewID, userID, modal, next, config)
+	}
+	return showRepoDetails(ctx, slackClient, viewID, repo, modal, details)
+}
+
+// addPage appends a later page of labels, assignable users and milestones,
+// taking the lists that cursors says were requested.
+func (details *RepoDetails) addPage(page RepoDetails, cursors repoDetailsCursors) {
+	if cursors.Labels != "" {
+		details.Labels = append(details.Labels, page.Labels...)
+		details.LabelsTotal = page.LabelsTotal
+	}
+	if cursors.Assignees != "" {
+		details.Assignees = append(details.Assignees, page.Assignees...)
+		details.AssigneesTotal = page.AssigneesTotal
+	}
+	if cursors.Milestones != "" {
+		details.Milestones = append(details.Milestones, page.Milestones...)
+		details.MilestonesTotal = page.MilestonesTotal
+	}
+}
+
+// showRepoDetails rebuilds the modal from the state it was in when the
+// details were requested, with the repository's details added.
+func showRepoDetails(ctx context.Context, slackClient SlackAPI, viewID, repo, modal string, details RepoDetails) error {
+	var opts issueModalOptions
+	if err := json.Unmarshal([]byte(modal), &opts); err != nil {
+		return fmt.Errorf("error unmarshaling modal state: %v", err)
+	}
+	opts.setRepoDetails(details)
+
+	if _, err := slackClient.UpdateView(createIssueModalWithOptions(opts), "", "", viewID); err != nil {
+		// The user may already have submitted or closed the modal
+		WarnContext(ctx, "Error updating modal with details for repo %s: %v", repo, err)
+		return nil
+	}
+
+	InfoContext(ctx, "Loaded %d issue templates, %d labels, %d assignees and %d milestones for repo %s",
+		len(details.Templates), len(details.Labels), len(details.Assignees), len(details.Milestones), repo)
+	return nil
+}
+
+// handleTemplateSelected applies the chosen issue template to the modal.
+// Title and description are only filled when the user has not typed into
+// them; Slack keeps typed input across view updates.
+func handleTemplateSelected(ctx context.Context, rdb RedisClient, slackClient SlackAPI, event BlockActionEvent, action BlockAction, config Config) error {
+	if action.SelectedOption == nil {
+		return nil
+	}
+
+	details, found, err := loadRepoDetails(ctx, rdb, event.View.ID, config)
+	if err != nil {
+		return err
+	}
+	if !found {
+		WarnContext(ctx, "No cached templates for view %s", event.View.ID)
+		return nil
+	}
+
+	tmpl, err := templateOption(details.Templates, action.SelectedOption.Value)
+	if err != nil {
+		return err
+	}
+
+	opts := issueModalOptionsFromView(event.View.State.Values, event.View.Blocks)
+	opts.setRepoDetails(details)
+	previous := applyModalSelections(decodeModalMetadata(event.View.PrivateMetadata), event.View.State.Values)
+	opts.Metadata = previous
+	opts.Metadata.Template = tmpl.Name
+	opts.Metadata.Labels = tmpl.Labels
+	opts.Metadata.Assignees = tmpl.Assignees
+
+	// Replace text that came from the previously selected template
+	for _, t := range details.Templates {
+		if t.Name == previous.Template {
+			if opts.Title == t.Title {
+				opts.Title = ""
+			}
+			if opts.Description == t.Body {
+				opts.Description = ""
+			}
+		}
+	}
+	if opts.Title == "" {
+		opts.Title = tmpl.Title
+	}
+	if opts.Description == "" {
+		opts.Description = tmpl.Body
+	}
+
+	if _, err := slackClient.UpdateView(createIssueModalWithOptions(opts), "", "", event.View.ID); err != nil {
+		return fmt.Errorf("error updating modal with template: %v", err)
+	}
+
+	DebugContext(ctx, "Applied issue template %q for user %s", tmpl.Name, event.User.Username)
+	return nil
+}
+
+// parseRepoDetails parses the gh api graphql output for repoDetailsQuery,
+// returning the cursors of the lists that have another page.
+func parseRepoDetails(repo, output string) (RepoDetails, repoDetailsCursors, error) {
+	var resp repoDetailsResponse
+	if err := json.Unmarshal([]byte(output), &resp); err != nil {
+		return RepoDetails{}, repoDetailsCursors{}, fmt.Errorf("invalid GraphQL response: %v", err)
+	}
+	if len(resp.Errors) > 0 {
+		return RepoDetails{}, repoDetailsCursors{}, fmt.Errorf("GraphQL error: %s", resp.Errors[0].Message)
+	}
+
+	details := RepoDetails{Repo: repo}
+	repository := resp.Data.Repository
+	if repository == nil {
+		return details, repoDetailsCursors{}, nil
+	}
+
+	if labels := repository.Labels; labels != nil {
+		details.Labels = labels.Nodes
+		details.LabelsTotal = labels.TotalCount
+	}
+	if users := repository.AssignableUsers; users != nil {
+		details.Assignees = users.Nodes
+		details.AssigneesTotal = users.TotalCount
+	}
+	if milestones := repository.Milestones; milestones != nil {
+		details.Milestones = milestones.Nodes
+		details.MilestonesTotal = milestones.TotalCount
+	}
+	next := repoDetailsCursors{
+		Labels:     repository.Labels.next(),
+		Assignees:  repository.AssignableUsers.next(),
+		Milestones: repository.Milestones.next(),
+	}
+
+	if repository.IssueTemplates == nil {
+		return details, next, nil
+	}
+
+	for _, entry := range repository.IssueTemplates.Entries {
+		if entry.Object == nil || entry.Object.Text == nil {
+			continue
+		}
+		if tmpl, ok := parseIssueTemplate(entry.Name, *entry.Object.Text); ok {
+			details.Templates = append(details.Templates, tmpl)
+		}
+	}
+
+	sort.Slice(details.Templates, func(i, j int) bool {
+		return strings.ToLower(details.Templates[i].Name) < strings.ToLower(details.Templates[j].Name)
+	})
+	return details, next, nil
+}
+
+// templateList accepts the shapes GitHub allows for labels and assignees in
+// templates: a YAML list or a comma-separated string.
+type templateList []string
+
+func (l *templateList) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		*l = parseList(value.Value)
+		return nil
+	case yaml.SequenceNode:
+		var items []string
+		if err := value.Decode(&items); err != nil {
+			return err
+		}
+		*l = parseList(strings.Join(items, ","))
+		return nil
+	}
+	return fmt.Errorf("expected a list or comma-separated string")
+}
+
+// markdownTemplate is the front matter of a .github/ISSUE_TEMPLATE/*.md file.
+type markdownTemplate struct {
+	Name      string       `yaml:"name"`
+	About     string       `yaml:"about"`
+	Title     string       `yaml:"title"`
+	Labels    templateList `yaml:"labels"`
+	Assignees templateList `yaml:"assignees"`
+}
+
+// issueForm is a .github/ISSUE_TEMPLATE/*.yml issue form.
+type issueForm struct {
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description"`
+	Title       string       `yaml:"title"`
+	Labels      templateList `yaml:"labels"`
+	Assignees   templateList `yaml:"assignees"`
+	Body        []struct {
+		Type       string `yaml:"type"`
+		Attributes struct {
+			Label   string `yaml:"label"`
+			Value   string `yaml:"value"`
+			Options []struct {
+				Label string `yaml:"label"`
+			} `yaml:"options"`
+		} `yaml:"attributes"`
+	} `yaml:"body"`
+}
+
+// parseIssueTemplate parses one file from .github/ISSUE_TEMPLATE.  The chooser
+// config and unrecognised files are skipped.
+func parseIssueTemplate(filename, text string) (IssueTemplate, bool) {
+	ext := strings.ToLower(path.Ext(filename))
+	base := strings.TrimSuffix(filename, path.Ext(filename))
+
+	var tmpl IssueTemplate
+	var err error
+	switch ext {
+	case ".md", ".markdown":
+		tmpl, err = parseMarkdownTemplate(text)
+	case ".yml", ".yaml":
+		if strings.EqualFold(base, "config") {
+			return IssueTemplate{}, false
+		}
+		tmpl, err = parseIssueForm(text)
+	default:
+		return IssueTemplate{}, false
+	}
+	if err != nil {
+		Warn("Skipping issue template %s: %v", filename, err)
+		return IssueTemplate{}, false
+	}
+
+	if tmpl.Name == "" {
+		tmpl.Name = base
+	}
+	return tmpl, true
+}
+
+// parseMarkdownTemplate splits a Markdown template into its YAML front matter
+// and body.
+func parseMarkdownTemplate(text string) (IssueTemplate, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var front markdownTemplate
+	body := text
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		header, after, found := strings.Cut(rest, "\n---")
+		if !found {
+			return IssueTemplate{}, fmt.Errorf("unterminated front matter")
+		}
+		if err := yaml.Unmarshal([]byte(header), &front); err != nil {
+			return IssueTemplate{}, err
+		}
+		// Drop the rest of the closing delimiter line
+		_, body, _ = strings.Cut(after, "\n")
+	}
+
+	return IssueTemplate{
+		Name:      front.Name,
+		About:     front.About,
+		Title:     front.Title,
+		Body:      strings.TrimSpace(body),
+		Labels:    front.Labels,
+		Assignees: front.Assignees,
+	}, nil
+}
+
+// parseIssueForm renders a YAML issue form as the Markdown GitHub would produce
+// for it, with a heading per field and any default values filled in.
+func parseIssueForm(text string) (IssueTemplate, error) {
+	var form issueForm
+	if err := yaml.Unmarshal([]byte(text), &form); err != nil {
+		return IssueTemplate{}, err
+	}
+
+	var sections []string
+	for _, element := range form.Body {
+		// Markdown elements are instructions and are not part of the issue
+		if element.Type == "markdown" || element.Attributes.Label == "" {
+			continue
+		}
+
+		section := "### " + element.Attributes.Label + "\n\n"
+		switch element.Type {
+		case "checkboxes":
+			var items []string
+			for _, option := range element.Attributes.Options {
+				items = append(items, "- [ ] "+option.Label)
+			}
+			section += strings.Join(items, "\n")
+		default:
+			section += strings.TrimSpace(element.Attributes.Value)
+		}
+		sections = append(sections, section)
+	}
+
+	return IssueTemplate{
+		Name:      form.Name,
+		About:     form.Description,
+		Title:     form.Title,
+		Body:      strings.TrimSpace(strings.Join(sections, "\n\n")),
+		Labels:    form.Labels,
+		Assignees: form.Assignees,
+	}, nil
+}
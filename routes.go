@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// confirmationRoute sends the confirmations of matching issues to another
+// channel, optionally with its own TTL.  Every criterion that is set must
+// match; routes are tried in order and the first match wins.  Issues no route
+// matches are confirmed in ConfirmationChannelID.
+type confirmationRoute struct {
+	// SourceChannel is the Slack channel ID /issue or the shortcut was used in
+	SourceChannel string `yaml:"source_channel"`
+	// Repo is a glob such as "its-the-vibe/infra-*"; without an org it is
+	// matched against the repository name only
+	Repo    string `yaml:"repo"`
+	Label   string `yaml:"label"`
+	Channel string `yaml:"channel"`
+	// TTL defaults to CONFIRMATION_TTL
+	TTL string `yaml:"ttl"`
+}
+
+// matches reports whether the route applies to issue, whose repository is
+// repoFullName ("org/repo").
+func (r confirmationRoute) matches(issue IssueConfirmation, repoFullName string) bool {
+	if r.SourceChannel != "" && r.SourceChannel != issue.SourceChannel {
+		return false
+	}
+	if !r.matchesRepo(repoFullName) {
+		return false
+	}
+	if r.Label != "" && !containsFold(issue.Labels, r.Label) {
+		return false
+	}
+	return true
+}
+
+// matchesRepo reports whether repoFullName could match the route's repo glob.
+// A route without a repo glob matches every repository.
+func (r confirmationRoute) matchesRepo(repoFullName string) bool {
+	if r.Repo == "" {
+		return true
+	}
+	name := strings.ToLower(repoFullName)
+	if !strings.Contains(r.Repo, "/") {
+		name = name[strings.LastIndex(name, "/")+1:]
+	}
+	ok, _ := path.Match(strings.ToLower(r.Repo), name)
+	return ok
+}
+
+// ttl returns the route's confirmation TTL in seconds.
+func (r confirmationRoute) ttl(config Config) int {
+	if r.TTL == "" {
+		return config.ConfirmationTTL
+	}
+	seconds, err := parseSeconds(r.TTL)
+	if err != nil {
+		// Rejected by Validate; only reachable with an unvalidated config
+		return config.ConfirmationTTL
+	}
+	return seconds
+}
+
+// validate returns the problems with the route at position i (1-based).
+func (r confirmationRoute) validate(i int) []error {
+	var problems []error
+	if r.SourceChannel == "" && r.Repo == "" && r.Label == "" {
+		problems = append(problems, fmt.Errorf("confirmation_routes[%d]: needs a source_channel, repo or label to match", i))
+	}
+	if !slackChannelIDPattern.MatchString(r.Channel) {
+		problems = append(problems, fmt.Errorf("confirmation_routes[%d]: channel %q is not a Slack channel ID such as C0123456789", i, r.Channel))
+	}
+	if _, err := path.Match(r.Repo, ""); err != nil {
+		problems = append(problems, fmt.Errorf("confirmation_routes[%d]: repo %q is not a valid glob", i, r.Repo))
+	}
+	if r.TTL != "" {
+		if seconds, err := parseSeconds(r.TTL); err != nil || seconds < 0 {
+			problems = append(problems, fmt.Errorf("confirmation_routes[%d]: ttl %q is not a duration such as 48h", i, r.TTL))
+		}
+	}
+	return problems
+}
+
+// routeConfirmation returns the channel and TTL for issue's confirmation.
+func routeConfirmation(issue IssueConfirmation, repoFullName string, config Config) (string, int) {
+	for _, route := range config.ConfirmationRoutes {
+		if route.matches(issue, repoFullName) {
+			return route.Channel, route.ttl(config)
+		}
+	}
+	return config.ConfirmationChannelID, config.ConfirmationTTL
+}
+
+// confirmationChannels returns the channels a confirmation for an issue in
+// repoFullName may have been posted to, in route order with the default
+// channel last.  The source channel and labels are not known from an issue
+// URL alone, so routes on those are included too.
+func confirmationChannels(repoFullName string, config Config) []string {
+	var channels []string
+	for _, route := range config.ConfirmationRoutes {
+		if route.matchesRepo(repoFullName) && !slices.Contains(channels, route.Channel) {
+			channels = append(channels, route.Channel)
+		}
+	}
+	if config.ConfirmationChannelID != "" && !slices.Contains(channels, config.ConfirmationChannelID) {
+		channels = append(channels, config.ConfirmationChannelID)
+	}
+	return channels
+}
+
+// channelConfirmationTTL returns the longest TTL a confirmation posted to
+// channelID can have, or 0 if one of them never expires.
+func channelConfirmationTTL(channelID string, config Config) int {
+	var ttls []int
+	for _, route := range config.ConfirmationRoutes {
+		if route.Channel == channelID {
+			ttls = append(ttls, route.ttl(config))
+		}
+	}
+	if len(ttls) == 0 || channelID == config.ConfirmationChannelID {
+		ttls = append(ttls, config.ConfirmationTTL)
+	}
+
+	longest := 0
+	for _, ttl := range ttls {
+		if ttl <= 0 {
+			return 0
+		}
+		longest = max(longest, ttl)
+	}
+	return longest
+}
@@ -0,0 +1,932 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// The scenarios below drive the handlers end to end against fakeRedis and
+// fakeSlack, playing the part of Poppit, SlackLiner and Slack in between.
+
+func scenarioConfig() Config {
+	return Config{
+		GitHubOrg:                "its-the-vibe",
+		ConfirmationChannelID:    "C_CONFIRM",
+		ConfirmationSearchLimit:  100,
+		RedisPoppitList:          "poppit:notifications",
+		RedisSlackLinerList:      "slack_messages",
+		RedisSlackReactionsList:  "slack_reactions",
+		RedisTimeBombChannel:     "timebomb-messages",
+		RedisIssueIndexPrefix:    "slashvibeissue:issue-message:",
+		RedisIssueThreadPrefix:   "slashvibeissue:issue-thread:",
+		IssueSourceFooter:        "Source: {{.Permalink}}",
+		RedisFailedCommandPrefix: "slashvibeissue:failed-command:",
+		RedisGitHubLoginsKey:     "slashvibeissue:github-logins",
+		RedisPendingIssuePrefix:  "slashvibeissue:pending-issue:",
+		RedisTranscriptPrefix:    "slashvibeissue:transcript:",
+		ProjectID:                "PVT_test",
+		WorkingDir:               "/tmp",
+	}
+}
+
+const scenarioViewSubmission = `{
+	"type": "view_submission",
+	"view": {
+		"callback_id": "create_github_issue_modal",
+		"state": {
+			"values": {
+				"repo_selection_block": {
+					"SlashVibeIssue": {"type": "static_select", "selected_option": {"value": "SlashVibeIssue"}}
+				},
+				"title_block": {
+					"issue_title": {"type": "plain_text_input", "value": "Modal loses title on retry"}
+				},
+				"description_block": {
+					"issue_description": {"type": "plain_text_input", "value": "Steps to reproduce"}
+				}
+			}
+		}
+	},
+	"user": {"id": "U123", "username": "alice"}
+}`
+
+const scenarioIssueURL = "https://github.com/its-the-vibe/SlashVibeIssue/issues/42"
+
+func TestScenarioIssueLifecycle(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := scenarioConfig()
+
+	// The modal is submitted and the issue is sent to Poppit
+	if err := handleViewSubmission(ctx, rdb, slackClient, scenarioViewSubmission, config); err != nil {
+		t.Fatalf("handleViewSubmission returned error: %v", err)
+	}
+	commands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(commands) != 1 || commands[0].Type != "slash-vibe-issue" {
+		t.Fatalf("Expected one slash-vibe-issue command, got %+v", commands)
+	}
+	create := commands[0]
+	if !strings.HasPrefix(create.Commands[0], "gh issue create") ||
+		!strings.Contains(create.Commands[0], "its-the-vibe/SlashVibeIssue") {
+		t.Errorf("Unexpected issue create command: %s", create.Commands[0])
+	}
+	correlation, _ := create.Metadata[correlationIDKey].(string)
+	if correlation == "" {
+		t.Error("Expected the issue create command to carry a correlation ID")
+	}
+
+	// Poppit reports the new issue; the confirmation goes to SlackLiner
+	if err := handlePoppitOutput(ctx, rdb, slackClient, poppitOutputFor(t, create, scenarioIssueURL+"\n"), config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+	confirmations := rdb.popList(config.RedisSlackLinerList)
+	if len(confirmations) != 1 {
+		t.Fatalf("Expected one confirmation, got %d", len(confirmations))
+	}
+	var confirmation SlackLinerMessage
+	if err := json.Unmarshal([]byte(confirmations[0]), &confirmation); err != nil {
+		t.Fatalf("Invalid confirmation: %v", err)
+	}
+	if confirmation.Channel != config.ConfirmationChannelID || !strings.Contains(confirmation.Text, scenarioIssueURL) {
+		t.Errorf("Unexpected confirmation: %+v", confirmation)
+	}
+	if len(rdb.popPoppitCommands(t, config.RedisPoppitList)) != 0 {
+		t.Error("Expected no follow-up commands when no options were ticked")
+	}
+
+	// SlackLiner posts the confirmation, and someone reacts with :sparkles:
+	ts := slackClient.addConfirmation(confirmation)
+	reaction := `{
+		"type": "event_callback",
+		"event_id": "Ev1",
+		"event": {
+			"type": "reaction_added",
+			"user": "U456",
+			"reaction": "sparkles",
+			"item": {"type": "message", "channel": "C_CONFIRM", "ts": "` + ts + `"}
+		}
+	}`
+	if err := handleReactionAdded(ctx, rdb, slackClient, reaction, config); err != nil {
+		t.Fatalf("handleReactionAdded returned error: %v", err)
+	}
+	commands = rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(commands) != 1 || commands[0].Type != "slash-vibe-issue-assign-copilot" {
+		t.Fatalf("Expected one slash-vibe-issue-assign-copilot command, got %+v", commands)
+	}
+	if !strings.Contains(commands[0].Commands[0], scenarioIssueURL) {
+		t.Errorf("Expected Copilot assignment for %s, got %s", scenarioIssueURL, commands[0].Commands[0])
+	}
+	if got, _ := commands[0].Metadata[correlationIDKey].(string); got != correlation {
+		t.Errorf("Expected correlation ID %q to follow the issue, got %q", correlation, got)
+	}
+
+	// GitHub reports the issue closed; the confirmation gets a reaction and a TTL
+	closed := `{"action": "closed", "issue": {"number": 42, "title": "Modal loses title on retry", "html_url": "` + scenarioIssueURL + `"}}`
+	if err := handleGitHubIssueEvent(ctx, rdb, slackClient, closed, config); err != nil {
+		t.Fatalf("handleGitHubIssueEvent returned error: %v", err)
+	}
+	reactions := rdb.popList(config.RedisSlackReactionsList)
+	if len(reactions) != 1 || !strings.Contains(reactions[0], issueClosedReactionEmoji) || !strings.Contains(reactions[0], ts) {
+		t.Errorf("Expected a %s reaction on %s, got %v", issueClosedReactionEmoji, ts, reactions)
+	}
+	if ttls := rdb.popPublished(config.RedisTimeBombChannel); len(ttls) != 1 || !strings.Contains(ttls[0], ts) {
+		t.Errorf("Expected a TTL for %s, got %v", ts, ttls)
+	}
+}
+
+func TestScenarioDuplicateCreateAnyway(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := scenarioConfig()
+	config.DuplicateCheck = true
+
+	var mu sync.Mutex
+	var responses []string
+	responseURL := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		responses = append(responses, string(body))
+		mu.Unlock()
+	}))
+	defer responseURL.Close()
+
+	// The modal is submitted; a duplicate search runs first
+	if err := handleViewSubmission(ctx, rdb, slackClient, scenarioViewSubmission, config); err != nil {
+		t.Fatalf("handleViewSubmission returned error: %v", err)
+	}
+	commands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(commands) != 1 || commands[0].Type != "slash-vibe-issue-duplicates" {
+		t.Fatalf("Expected one slash-vibe-issue-duplicates command, got %+v", commands)
+	}
+	pendingID, _ := commands[0].Metadata["pending_id"].(string)
+
+	// Poppit finds a similar open issue, so the user is asked first
+	existing := `[{"number": 7, "title": "Modal loses title on retry sometimes", "url": "https://github.com/its-the-vibe/SlashVibeIssue/issues/7"}]`
+	if err := handlePoppitOutput(ctx, rdb, slackClient, poppitOutputFor(t, commands[0], existing), config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+	if len(slackClient.posted) != 1 || slackClient.posted[0].Channel != "U123" {
+		t.Fatalf("Expected a duplicate notice sent to U123, got %+v", slackClient.posted)
+	}
+	if !strings.Contains(slackClient.posted[0].Text, "may already be tracked") {
+		t.Errorf("Unexpected duplicate notice: %s", slackClient.posted[0].Text)
+	}
+	if len(rdb.popPoppitCommands(t, config.RedisPoppitList)) != 0 {
+		t.Fatal("Expected the issue to wait for the user")
+	}
+
+	// The user clicks "Create anyway"
+	click := `{
+		"type": "block_actions",
+		"response_url": "` + responseURL.URL + `",
+		"user": {"id": "U123", "username": "alice"},
+		"container": {"type": "message"},
+		"actions": [{"action_id": "` + createIssueAnywayActionID + `", "type": "button", "value": "` + pendingID + `"}]
+	}`
+	if err := handleBlockAction(ctx, rdb, slackClient, click, config); err != nil {
+		t.Fatalf("handleBlockAction returned error: %v", err)
+	}
+	commands = rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(commands) != 1 || commands[0].Type != "slash-vibe-issue" {
+		t.Fatalf("Expected one slash-vibe-issue command, got %+v", commands)
+	}
+	mu.Lock()
+	if len(responses) != 1 || !strings.Contains(responses[0], "Creating") {
+		t.Errorf("Expected the notice to be replaced, got %v", responses)
+	}
+	mu.Unlock()
+
+	// A second click finds nothing pending
+	if err := handleBlockAction(ctx, rdb, slackClient, click, config); err != nil {
+		t.Fatalf("handleBlockAction returned error: %v", err)
+	}
+	if len(rdb.popPoppitCommands(t, config.RedisPoppitList)) != 0 {
+		t.Error("Expected a repeated click not to create the issue twice")
+	}
+}
+
+func TestScenarioRoutedConfirmation(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := scenarioConfig()
+	config.ConfirmationTTL = 172800
+	config.ConfirmationRoutes = []confirmationRoute{
+		{SourceChannel: "C_TEAM", Channel: "C_TEAM_ISSUES", TTL: "168h"},
+	}
+
+	// /issue is run in the team's channel
+	command := `{"command": "/issue", "text": "Modal loses title on retry", "trigger_id": "T1", "user_id": "U123", "user_name": "alice", "channel_id": "C_TEAM"}`
+	if err := handleSlashCommand(ctx, rdb, slackClient, command, config); err != nil {
+		t.Fatalf("handleSlashCommand returned error: %v", err)
+	}
+	if len(slackClient.openedViews) != 1 {
+		t.Fatalf("Expected one modal, got %d", len(slackClient.openedViews))
+	}
+
+	// The modal carries the source channel through to the submission
+	create := submitModal(t, rdb, slackClient, slackClient.openedViews[0].PrivateMetadata, config)
+
+	// The confirmation goes to the team's issues channel with the route's TTL
+	if err := handlePoppitOutput(ctx, rdb, slackClient, poppitOutputFor(t, create, scenarioIssueURL+"\n"), config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+	var confirmation SlackLinerMessage
+	if err := json.Unmarshal([]byte(rdb.popList(config.RedisSlackLinerList)[0]), &confirmation); err != nil {
+		t.Fatalf("Invalid confirmation: %v", err)
+	}
+	if confirmation.Channel != "C_TEAM_ISSUES" || confirmation.TTL != 7*86400 {
+		t.Fatalf("Expected the confirmation routed to C_TEAM_ISSUES for 7 days, got channel=%s ttl=%d", confirmation.Channel, confirmation.TTL)
+	}
+
+	// Closing the issue finds the confirmation in the routed channel
+	ts := slackClient.addConfirmation(confirmation)
+	closed := `{"action": "closed", "issue": {"number": 42, "title": "Modal loses title on retry", "html_url": "` + scenarioIssueURL + `"}}`
+	if err := handleGitHubIssueEvent(ctx, rdb, slackClient, closed, config); err != nil {
+		t.Fatalf("handleGitHubIssueEvent returned error: %v", err)
+	}
+	reactions := rdb.popList(config.RedisSlackReactionsList)
+	if len(reactions) != 1 || !strings.Contains(reactions[0], "C_TEAM_ISSUES") || !strings.Contains(reactions[0], ts) {
+		t.Errorf("Expected a reaction on %s in C_TEAM_ISSUES, got %v", ts, reactions)
+	}
+}
+
+// submitModal submits the scenario modal with the private_metadata of view.
+func submitModal(t *testing.T, rdb *fakeRedis, slackClient *fakeSlack, privateMetadata string, config Config) PoppitCommand {
+	t.Helper()
+
+	var submission map[string]interface{}
+	if err := json.Unmarshal([]byte(scenarioViewSubmission), &submission); err != nil {
+		t.Fatalf("Invalid scenario payload: %v", err)
+	}
+	submission["view"].(map[string]interface{})["private_metadata"] = privateMetadata
+	payload, _ := json.Marshal(submission)
+	if err := handleViewSubmission(context.Background(), rdb, slackClient, string(payload), config); err != nil {
+		t.Fatalf("handleViewSubmission returned error: %v", err)
+	}
+	commands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(commands) != 1 || commands[0].Type != "slash-vibe-issue" {
+		t.Fatalf("Expected one slash-vibe-issue command, got %+v", commands)
+	}
+	return commands[0]
+}
+
+func TestScenarioMessageShortcutThread(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := scenarioConfig()
+
+	// The shortcut is used on a message; its title is generated by Poppit
+	shortcut := `{
+		"type": "message_action",
+		"callback_id": "create_github_issue",
+		"trigger_id": "T1",
+		"message_ts": "1700000000.000100",
+		"user": {"id": "U123", "username": "alice"},
+		"channel": {"id": "C_DISCUSS", "name": "discuss"},
+		"message": {"type": "message", "user": "U789", "ts": "1700000000.000100", "text": "The modal forgets my title when I retry"}
+	}`
+	if err := handleMessageAction(ctx, rdb, slackClient, shortcut, config); err != nil {
+		t.Fatalf("handleMessageAction returned error: %v", err)
+	}
+	titleCommands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(titleCommands) != 1 {
+		t.Fatalf("Expected one title generation command, got %+v", titleCommands)
+	}
+	title := `{"version": 1, "title": "Modal loses title on retry", "prompt": "Steps to reproduce"}`
+	if err := handlePoppitOutput(ctx, rdb, slackClient, poppitOutputFor(t, titleCommands[0], title), config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+	if len(slackClient.updatedViews) != 2 {
+		t.Fatalf("Expected the modal to be updated with the permalink and the title, got %d updates", len(slackClient.updatedViews))
+	}
+
+	// The issue is created, linking back to the message, and the author of
+	// the message is told in its thread
+	create := submitModal(t, rdb, slackClient, slackClient.updatedViews[1].PrivateMetadata, config)
+	if !strings.Contains(create.Commands[0], "---\nSource: https://example.slack.com/archives/C_DISCUSS/p1700000000000100\n\nRequested by Slack user alice") {
+		t.Errorf("Expected the issue body to link to the message, got %s", create.Commands[0])
+	}
+	output := poppitOutputFor(t, create, scenarioIssueURL+"\n")
+	if err := handlePoppitOutput(ctx, rdb, slackClient, output, config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+	var reply SlackLinerMessage
+	messages := rdb.popList(config.RedisSlackLinerList)
+	if len(messages) != 2 {
+		t.Fatalf("Expected a thread reply and a confirmation, got %v", messages)
+	}
+	if err := json.Unmarshal([]byte(messages[0]), &reply); err != nil {
+		t.Fatalf("Invalid thread reply: %v", err)
+	}
+	if reply.Channel != "C_DISCUSS" || reply.ThreadTs != "1700000000.000100" || !strings.Contains(reply.Text, scenarioIssueURL) {
+		t.Errorf("Unexpected thread reply: %+v", reply)
+	}
+
+	// A redelivered Poppit output does not reply twice
+	if err := handlePoppitOutput(ctx, rdb, slackClient, output, config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+	if messages := rdb.popList(config.RedisSlackLinerList); len(messages) != 1 {
+		t.Errorf("Expected only the confirmation to be resent, got %v", messages)
+	}
+
+	// Assignment and closing are followed up in the same thread
+	for _, event := range []string{
+		`{"action": "assigned", "assignee": {"login": "bob"}, "issue": {"number": 42, "title": "Modal loses title on retry", "html_url": "` + scenarioIssueURL + `"}}`,
+		`{"action": "closed", "issue": {"number": 42, "title": "Modal loses title on retry", "html_url": "` + scenarioIssueURL + `"}}`,
+	} {
+		if err := handleGitHubIssueEvent(ctx, rdb, slackClient, event, config); err != nil {
+			t.Fatalf("handleGitHubIssueEvent returned error: %v", err)
+		}
+	}
+	followUps := rdb.popList(config.RedisSlackLinerList)
+	if len(followUps) != 2 || !strings.Contains(followUps[0], "assigned to bob") || !strings.Contains(followUps[1], "was closed") {
+		t.Fatalf("Expected assigned and closed follow-ups, got %v", followUps)
+	}
+	for _, raw := range followUps {
+		var msg SlackLinerMessage
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil || msg.ThreadTs != "1700000000.000100" {
+			t.Errorf("Expected a reply in the source thread, got %s", raw)
+		}
+	}
+}
+
+func TestScenarioMessageShortcutSubmitBeforeTitle(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := scenarioConfig()
+
+	shortcut := `{
+		"type": "message_action",
+		"callback_id": "create_github_issue",
+		"trigger_id": "T1",
+		"message_ts": "1700000000.000100",
+		"user": {"id": "U123", "username": "alice"},
+		"channel": {"id": "C_DISCUSS", "name": "discuss"},
+		"message": {"type": "message", "user": "U789", "ts": "1700000000.000100", "text": "The modal forgets my title when I retry"}
+	}`
+	if err := handleMessageAction(ctx, rdb, slackClient, shortcut, config); err != nil {
+		t.Fatalf("handleMessageAction returned error: %v", err)
+	}
+	if titleCommands := rdb.popPoppitCommands(t, config.RedisPoppitList); len(titleCommands) != 1 {
+		t.Fatalf("Expected one title generation command, got %+v", titleCommands)
+	}
+	if len(slackClient.updatedViews) != 1 {
+		t.Fatalf("Expected the open modal to be updated with the permalink, got %d updates", len(slackClient.updatedViews))
+	}
+
+	// The user types a title and submits before the summariser replies
+	create := submitModal(t, rdb, slackClient, slackClient.updatedViews[0].PrivateMetadata, config)
+	if !strings.Contains(create.Commands[0], "Source: https://example.slack.com/archives/C_DISCUSS/p1700000000000100") {
+		t.Errorf("Expected the issue body to link to the message, got %s", create.Commands[0])
+	}
+}
+
+func TestScenarioMessageShortcutIncludeThread(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := scenarioConfig()
+
+	parent := slack.Message{}
+	parent.Channel, parent.Timestamp, parent.ThreadTimestamp = "C_DISCUSS", "1700000000.000100", "1700000000.000100"
+	parent.User, parent.Text = "U789", "The modal forgets my title when I retry"
+	reply := slack.Message{}
+	reply.Channel, reply.Timestamp, reply.ThreadTimestamp = "C_DISCUSS", "1700000060.000200", "1700000000.000100"
+	reply.User, reply.Text = "U456", "Same here\nafter a failed create"
+	bot := slack.Message{}
+	bot.Channel, bot.Timestamp, bot.ThreadTimestamp = "C_DISCUSS", "1700000120.000300", "1700000000.000100"
+	bot.BotProfile, bot.Text = &slack.BotProfile{Name: "Poppit"}, "Build failed"
+	slackClient.history = []slack.Message{parent, reply, bot}
+	slackClient.users = map[string]*slack.User{"U456": {Name: "bob", Profile: slack.UserProfile{DisplayName: "Bob"}}}
+
+	shortcut := `{
+		"type": "message_action",
+		"callback_id": "create_github_issue",
+		"trigger_id": "T1",
+		"message_ts": "1700000000.000100",
+		"user": {"id": "U123", "username": "alice"},
+		"channel": {"id": "C_DISCUSS", "name": "discuss"},
+		"message": {"type": "message", "user": "U789", "ts": "1700000000.000100", "text": "The modal forgets my title when I retry"}
+	}`
+	if err := handleMessageAction(ctx, rdb, slackClient, shortcut, config); err != nil {
+		t.Fatalf("handleMessageAction returned error: %v", err)
+	}
+	rdb.popPoppitCommands(t, config.RedisPoppitList)
+
+	// The user ticks "Include thread replies" in the modal
+	toggle, _ := json.Marshal(map[string]interface{}{
+		"type": "block_actions",
+		"user": map[string]string{"id": "U123", "username": "alice"},
+		"view": map[string]interface{}{
+			"id":               "V1",
+			"hash":             "hash-1",
+			"callback_id":      "create_github_issue_modal",
+			"private_metadata": slackClient.openedViews[0].PrivateMetadata,
+			"state": map[string]interface{}{"values": map[string]interface{}{
+				"thread_block": map[string]interface{}{
+					includeThreadActionID: map[string]interface{}{"selected_options": []interface{}{map[string]string{"value": "true"}}},
+				},
+			}},
+		},
+		"actions": []map[string]string{{"action_id": includeThreadActionID, "block_id": "thread_block", "type": "checkboxes"}},
+	})
+	if err := handleBlockAction(ctx, rdb, slackClient, string(toggle), config); err != nil {
+		t.Fatalf("handleBlockAction returned error: %v", err)
+	}
+
+	// The whole thread is summarised and kept for the submission, with authors and times
+	titleCommands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(titleCommands) != 1 || titleCommands[0].Type != "slash-vibe-issue-ticket-title" {
+		t.Fatalf("Expected one title generation command, got %+v", titleCommands)
+	}
+	transcript := rdb.strings[transcriptKey("V1", config)]
+	for _, want := range []string{
+		"**U789** · 2023-11-14 22:13 UTC\n> The modal forgets my title when I retry",
+		"**Bob** · 2023-11-14 22:14 UTC\n> Same here\n> after a failed create",
+		"**Poppit** · 2023-11-14 22:15 UTC\n> Build failed",
+	} {
+		if !strings.Contains(transcript, want) || !strings.Contains(titleCommands[0].Commands[0], "Same here") {
+			t.Errorf("Expected the transcript %q to contain %q and be summarised, got command %q", transcript, want, titleCommands[0].Commands[0])
+		}
+	}
+
+	// The summariser echoes the transcript back, but it stays out of the
+	// modal, and the checkbox stays ticked
+	title := summariserOutputFor(t, titleCommands[0], "Modal loses title on retry")
+	if err := handlePoppitOutput(ctx, rdb, slackClient, title, config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+	if len(slackClient.updatedViews) != 3 {
+		t.Fatalf("Expected permalink, loading and title updates, got %d updates", len(slackClient.updatedViews))
+	}
+	updated, _ := json.Marshal(slackClient.updatedViews[2])
+	if strings.Contains(string(updated), threadHeading) || strings.Contains(string(updated), "Same here") {
+		t.Errorf("Expected the transcript to be kept out of the modal, got %s", updated)
+	}
+	var description string
+	for _, block := range slackClient.updatedViews[2].Blocks.BlockSet {
+		if input, ok := block.(*slack.InputBlock); ok && input.BlockID == "description_block" {
+			description = input.Element.(*slack.PlainTextInputBlockElement).InitialValue
+		}
+	}
+	if description != "The modal forgets my title when I retry" {
+		t.Errorf("Expected the description to be the source message, got %q", description)
+	}
+	if !strings.Contains(string(updated), `"initial_options":[{"text":{"type":"plain_text","text":"Include thread replies"`) {
+		t.Errorf("Expected Include thread replies to stay ticked, got %s", updated)
+	}
+	if metadata := decodeModalMetadata(slackClient.updatedViews[2].PrivateMetadata); metadata.SourceTs != "1700000000.000100" {
+		t.Errorf("Expected the source message to be kept, got %+v", metadata)
+	}
+
+	// On submission the transcript follows the description
+	var submission map[string]interface{}
+	if err := json.Unmarshal([]byte(scenarioViewSubmission), &submission); err != nil {
+		t.Fatalf("Invalid scenario payload: %v", err)
+	}
+	view := submission["view"].(map[string]interface{})
+	view["id"] = "V1"
+	view["private_metadata"] = slackClient.updatedViews[2].PrivateMetadata
+	values := view["state"].(map[string]interface{})["values"].(map[string]interface{})
+	values["description_block"] = map[string]interface{}{
+		"issue_description": map[string]interface{}{"type": "plain_text_input", "value": description},
+	}
+	values["thread_block"] = map[string]interface{}{
+		includeThreadActionID: map[string]interface{}{"selected_options": []interface{}{map[string]string{"value": "true"}}},
+	}
+	payload, _ := json.Marshal(submission)
+	if err := handleViewSubmission(ctx, rdb, slackClient, string(payload), config); err != nil {
+		t.Fatalf("handleViewSubmission returned error: %v", err)
+	}
+	commands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(commands) != 1 || commands[0].Type != "slash-vibe-issue" {
+		t.Fatalf("Expected one slash-vibe-issue command, got %+v", commands)
+	}
+	body := commands[0].Commands[0]
+	if !strings.Contains(body, "The modal forgets my title when I retry\n\n### Slack thread\n\n**U789**") {
+		t.Errorf("Expected the issue body to include the thread, got %s", body)
+	}
+	if strings.Count(body, threadHeading) != 1 || strings.Count(body, "Same here") != 1 {
+		t.Errorf("Expected the thread in the issue body exactly once, got %s", body)
+	}
+}
+
+func TestScenarioRetryFailedIssueFromMessage(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := scenarioConfig()
+
+	// The modal was opened from a message with a screenshot, and the thread
+	// is included
+	submit := func(viewID, privateMetadata string) PoppitCommand {
+		t.Helper()
+		var submission map[string]interface{}
+		if err := json.Unmarshal([]byte(scenarioViewSubmission), &submission); err != nil {
+			t.Fatalf("Invalid scenario payload: %v", err)
+		}
+		view := submission["view"].(map[string]interface{})
+		view["id"] = viewID
+		view["private_metadata"] = privateMetadata
+		view["state"].(map[string]interface{})["values"].(map[string]interface{})["thread_block"] = map[string]interface{}{
+			includeThreadActionID: map[string]interface{}{"selected_options": []interface{}{map[string]string{"value": "true"}}},
+		}
+		payload, _ := json.Marshal(submission)
+		if err := handleViewSubmission(ctx, rdb, slackClient, string(payload), config); err != nil {
+			t.Fatalf("handleViewSubmission returned error: %v", err)
+		}
+		commands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+		if len(commands) != 1 || commands[0].Type != "slash-vibe-issue" {
+			t.Fatalf("Expected one slash-vibe-issue command, got %+v", commands)
+		}
+		return commands[0]
+	}
+	transcript := "**Bob** · 2023-11-14 22:14 UTC\n> Same here"
+	if err := storeTranscript(ctx, rdb, "V0", transcript, config); err != nil {
+		t.Fatalf("storeTranscript returned error: %v", err)
+	}
+	create := submit("V0", encodeModalMetadata(IssueModalMetadata{
+		SourceChannel:   "C_DISCUSS",
+		SourceTs:        "1700000000.000100",
+		SourcePermalink: "https://example.slack.com/archives/C_DISCUSS/p1700000000000100",
+		Attachments:     []IssueAttachment{{Name: "checkout.png", URL: "https://team.slack.com/files/U789/F1"}},
+	}))
+
+	// gh fails, and the user clicks Retry on the notification
+	var output PoppitOutput
+	if err := json.Unmarshal([]byte(poppitOutputFor(t, create, "")), &output); err != nil {
+		t.Fatalf("Invalid Poppit output: %v", err)
+	}
+	exitCode := 1
+	output.ExitCode, output.Stderr = &exitCode, "HTTP 502: Bad Gateway"
+	failed, _ := json.Marshal(output)
+	if err := handlePoppitOutput(ctx, rdb, slackClient, string(failed), config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+	var retryID string
+	for key := range rdb.strings {
+		if id, ok := strings.CutPrefix(key, config.RedisFailedCommandPrefix); ok {
+			retryID = id
+		}
+	}
+	event := BlockActionEvent{TriggerID: "T2"}
+	event.User.ID, event.User.Username = "U123", "alice"
+	if err := retryFailedCommand(ctx, rdb, slackClient, event, BlockAction{ActionID: retryFailedCommandActionID, Value: retryID}, config); err != nil {
+		t.Fatalf("retryFailedCommand returned error: %v", err)
+	}
+	if len(slackClient.openedViews) != 1 {
+		t.Fatalf("Expected the retry modal to open, got %d views", len(slackClient.openedViews))
+	}
+
+	// The modal shows only what the user wrote
+	modal := slackClient.openedViews[0]
+	for _, block := range modal.Blocks.BlockSet {
+		if input, ok := block.(*slack.InputBlock); ok && input.BlockID == "description_block" {
+			if got := input.Element.(*slack.PlainTextInputBlockElement).InitialValue; got != "Steps to reproduce" {
+				t.Errorf("Expected the retry modal to show the entered description, got %q", got)
+			}
+		}
+	}
+
+	// Resubmitting adds the thread, attachments and footers once each
+	body := submit("V1", modal.PrivateMetadata).Commands[0]
+	for _, section := range []string{threadHeading, "Same here", "### Attachments", "checkout.png", "Source: ", "Requested by"} {
+		if count := strings.Count(body, section); count != 1 {
+			t.Errorf("Expected %q once in the retried issue body, got %d in %s", section, count, body)
+		}
+	}
+}
+
+func TestScenarioMessageShortcutAttachments(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+
+	var mu sync.Mutex
+	stored := make(map[string]string)
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPut || strings.HasPrefix(r.URL.Path, "/uploads/F3/") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		stored[r.URL.Path] = r.Header.Get("Content-Type") + " " + string(body)
+		mu.Unlock()
+	}))
+	defer storage.Close()
+
+	config := scenarioConfig()
+	config.AttachmentUploadURL = storage.URL + "/uploads/"
+	config.AttachmentPublicURL = "https://files.example.com/uploads"
+	config.AttachmentMaxBytes = 1024
+	config.AttachmentTypes = []string{"image/*", "text/plain"}
+
+	slackClient.files = map[string]string{
+		"https://files.slack.com/F1/download/login error.png": "PNG",
+		"https://files.slack.com/F3/download/console.txt":     "TypeError",
+	}
+	shortcut := `{
+		"type": "message_action",
+		"callback_id": "create_github_issue",
+		"trigger_id": "T1",
+		"message_ts": "1700000000.000100",
+		"user": {"id": "U123", "username": "alice"},
+		"channel": {"id": "C_DISCUSS", "name": "discuss"},
+		"message": {"type": "message", "user": "U789", "ts": "1700000000.000100", "text": "Login fails, see screenshot", "files": [
+			{"id": "F1", "name": "login error.png", "mimetype": "image/png", "size": 3,
+			 "url_private_download": "https://files.slack.com/F1/download/login error.png", "permalink": "https://team.slack.com/files/U789/F1"},
+			{"id": "F2", "name": "capture.mov", "mimetype": "video/quicktime", "size": 512,
+			 "url_private_download": "https://files.slack.com/F2/download/capture.mov", "permalink": "https://team.slack.com/files/U789/F2"},
+			{"id": "F3", "name": "console.txt", "mimetype": "text/plain", "size": 9,
+			 "url_private_download": "https://files.slack.com/F3/download/console.txt", "permalink": "https://team.slack.com/files/U789/F3"},
+			{"id": "F4", "name": "dump.txt", "mimetype": "text/plain", "size": 4096,
+			 "url_private_download": "https://files.slack.com/F4/download/dump.txt", "permalink": "https://team.slack.com/files/U789/F4"}
+		]}
+	}`
+	if err := handleMessageAction(ctx, rdb, slackClient, shortcut, config); err != nil {
+		t.Fatalf("handleMessageAction returned error: %v", err)
+	}
+
+	// The image is uploaded; the video and the oversized dump are left out
+	mu.Lock()
+	if got := stored["/uploads/F1/login error.png"]; got != "image/png PNG" || len(stored) != 1 {
+		t.Errorf("Expected only the screenshot to be uploaded, got %v", stored)
+	}
+	mu.Unlock()
+
+	titleCommands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(titleCommands) != 1 {
+		t.Fatalf("Expected one title generation command, got %+v", titleCommands)
+	}
+	title := `{"version": 1, "title": "Login fails", "prompt": "Login shows an error"}`
+	if err := handlePoppitOutput(ctx, rdb, slackClient, poppitOutputFor(t, titleCommands[0], title), config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+	updated, _ := json.Marshal(slackClient.updatedViews[0])
+	if !strings.Contains(string(updated), "Attached to the issue:* login error.png, console.txt") {
+		t.Errorf("Expected the modal to list the attachments, got %s", updated)
+	}
+
+	// Selecting the repository keeps the attachments
+	selectRepo, _ := json.Marshal(map[string]interface{}{
+		"type": "block_actions",
+		"user": map[string]string{"id": "U123", "username": "alice"},
+		"view": map[string]interface{}{
+			"id":               "V1",
+			"callback_id":      "create_github_issue_modal",
+			"private_metadata": slackClient.updatedViews[0].PrivateMetadata,
+		},
+		"actions": []map[string]interface{}{{
+			"action_id":       repoSelectActionID,
+			"block_id":        "repo_selection_block",
+			"type":            "static_select",
+			"selected_option": map[string]string{"value": "SlashVibeIssue"},
+		}},
+	})
+	if err := handleBlockAction(ctx, rdb, slackClient, string(selectRepo), config); err != nil {
+		t.Fatalf("handleBlockAction returned error: %v", err)
+	}
+	detailsCommands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(detailsCommands) != 1 || detailsCommands[0].Type != "slash-vibe-issue-repo-details" {
+		t.Fatalf("Expected one repo details command, got %+v", detailsCommands)
+	}
+	var modal issueModalOptions
+	if err := json.Unmarshal([]byte(detailsCommands[0].Metadata["modal"].(string)), &modal); err != nil {
+		t.Fatalf("Invalid modal state: %v", err)
+	}
+
+	// The issue body embeds the uploaded image and links the file whose
+	// upload failed in Slack
+	create := submitModal(t, rdb, slackClient, encodeModalMetadata(modal.Metadata), config)
+	for _, want := range []string{
+		"### Attachments",
+		"- ![login error.png](https://files.example.com/uploads/F1/login%20error.png)",
+		"- [console.txt](https://team.slack.com/files/U789/F3)",
+	} {
+		if !strings.Contains(create.Commands[0], want) {
+			t.Errorf("Expected the issue command to contain %q, got %s", want, create.Commands[0])
+		}
+	}
+	if strings.Contains(create.Commands[0], "capture.mov") || strings.Contains(create.Commands[0], "dump.txt") {
+		t.Errorf("Expected skipped files to be left out, got %s", create.Commands[0])
+	}
+}
+
+func TestScenarioMessageShortcutAttachmentsWithoutTitle(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	slackClient.permalinkErr = errors.New("message_not_found")
+	config := scenarioConfig()
+	config.AttachmentTypes = []string{"image/*"}
+
+	shortcut := `{
+		"type": "message_action",
+		"callback_id": "create_github_issue",
+		"trigger_id": "T1",
+		"message_ts": "1700000000.000100",
+		"user": {"id": "U123", "username": "alice"},
+		"channel": {"id": "C_DISCUSS", "name": "discuss"},
+		"message": {"type": "message", "user": "U789", "ts": "1700000000.000100", "text": "Checkout is broken", "files": [
+			{"id": "F1", "name": "checkout.png", "mimetype": "image/png", "size": 3,
+			 "url_private_download": "https://files.slack.com/F1/download/checkout.png", "permalink": "https://team.slack.com/files/U789/F1"}
+		]}
+	}`
+	if err := handleMessageAction(ctx, rdb, slackClient, shortcut, config); err != nil {
+		t.Fatalf("handleMessageAction returned error: %v", err)
+	}
+	if len(slackClient.updatedViews) != 1 {
+		t.Fatalf("Expected the open modal to be updated with the attachments, got %d updates", len(slackClient.updatedViews))
+	}
+	metadata := slackClient.updatedViews[0].PrivateMetadata
+
+	// The summariser comes back without a title, so the modal is not updated again
+	titleCommands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(titleCommands) != 1 {
+		t.Fatalf("Expected one title generation command, got %+v", titleCommands)
+	}
+	if err := handlePoppitOutput(ctx, rdb, slackClient, summariserOutputFor(t, titleCommands[0], ""), config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+	if len(slackClient.updatedViews) != 1 {
+		t.Fatalf("Expected no update for an empty title, got %d updates", len(slackClient.updatedViews))
+	}
+
+	// Picking a repository and submitting keeps the screenshot
+	selectRepo, _ := json.Marshal(map[string]interface{}{
+		"type": "block_actions",
+		"user": map[string]string{"id": "U123", "username": "alice"},
+		"view": map[string]interface{}{
+			"id":               "V1",
+			"callback_id":      "create_github_issue_modal",
+			"private_metadata": metadata,
+		},
+		"actions": []map[string]interface{}{{
+			"action_id":       repoSelectActionID,
+			"block_id":        "repo_selection_block",
+			"type":            "external_select",
+			"selected_option": map[string]string{"value": "SlashVibeIssue"},
+		}},
+	})
+	if err := handleBlockAction(ctx, rdb, slackClient, string(selectRepo), config); err != nil {
+		t.Fatalf("handleBlockAction returned error: %v", err)
+	}
+	detailsCommands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(detailsCommands) != 1 || !strings.Contains(detailsCommands[0].Metadata["modal"].(string), "checkout.png") {
+		t.Errorf("Expected the repo details request to carry the attachment, got %+v", detailsCommands)
+	}
+	create := submitModal(t, rdb, slackClient, metadata, config)
+	if !strings.Contains(create.Commands[0], "- [checkout.png](https://team.slack.com/files/U789/F1)") {
+		t.Errorf("Expected the issue body to link the screenshot, got %s", create.Commands[0])
+	}
+}
+
+func TestScenarioMessageShortcutFilesOnly(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := scenarioConfig()
+	config.AttachmentTypes = []string{"image/*"}
+
+	// A screenshot posted without any text
+	shortcut := `{
+		"type": "message_action",
+		"callback_id": "create_github_issue",
+		"trigger_id": "T1",
+		"message_ts": "1700000000.000100",
+		"user": {"id": "U123", "username": "alice"},
+		"channel": {"id": "C_DISCUSS", "name": "discuss"},
+		"message": {"type": "message", "user": "U789", "ts": "1700000000.000100", "text": "", "files": [
+			{"id": "F1", "name": "checkout.png", "mimetype": "image/png", "size": 3,
+			 "url_private_download": "https://files.slack.com/F1/download/checkout.png", "permalink": "https://team.slack.com/files/U789/F1"}
+		]}
+	}`
+	if err := handleMessageAction(ctx, rdb, slackClient, shortcut, config); err != nil {
+		t.Fatalf("handleMessageAction returned error: %v", err)
+	}
+	if len(slackClient.openedViews) != 1 {
+		t.Fatalf("Expected the modal to open, got %d views", len(slackClient.openedViews))
+	}
+
+	titleCommands := rdb.popPoppitCommands(t, config.RedisPoppitList)
+	if len(titleCommands) != 1 || !strings.Contains(titleCommands[0].Commands[0], "Files shared in Slack: checkout.png") {
+		t.Fatalf("Expected a title to be generated from the file names, got %+v", titleCommands)
+	}
+	modal, _ := titleCommands[0].Metadata["modal"].(string)
+	if !strings.Contains(modal, "https://team.slack.com/files/U789/F1") {
+		t.Errorf("Expected the screenshot to be attached, got %s", modal)
+	}
+}
+
+func TestScenarioConfirmationSearchSkipsFailingChannel(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := scenarioConfig()
+	config.ConfirmationRoutes = []confirmationRoute{{SourceChannel: "C_OLD", Channel: "C_ARCHIVED"}}
+
+	ts := slackClient.addConfirmation(buildConfirmationMessage(IssueConfirmation{
+		Repo: "SlashVibeIssue", Title: "Modal loses title on retry", Username: "alice", IssueURL: scenarioIssueURL,
+	}, config))
+
+	// The routed channel can no longer be read; the default one still is
+	slackClient.historyErrs = map[string]error{"C_ARCHIVED": errors.New("not_in_channel")}
+	channelID, found, err := findMessageByIssueURL(ctx, rdb, slackClient, scenarioIssueURL, config)
+	if err != nil || channelID != "C_CONFIRM" || found != ts {
+		t.Fatalf("Expected the confirmation at %s in C_CONFIRM, got %q %q %v", ts, channelID, found, err)
+	}
+
+	// Only when every channel fails is the search an error, so the event is retried
+	const otherIssueURL = "https://github.com/its-the-vibe/SlashVibeIssue/issues/43"
+	slackClient.historyErrs["C_CONFIRM"] = errors.New("ratelimited")
+	if _, _, err := findMessageByIssueURL(ctx, rdb, slackClient, otherIssueURL, config); err == nil {
+		t.Error("Expected an error when no channel can be searched")
+	}
+}
+
+func TestScenarioFollowUpNotRepeatedOnRedelivery(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+	config := scenarioConfig()
+	rdb.strings[issueThreadKey(scenarioIssueURL, config)] = `{"channel": "C_DISCUSS", "ts": "1700000000.000100"}`
+
+	// Looking up the confirmation fails, so the event is redelivered
+	closed := `{"action": "closed", "issue": {"number": 42, "title": "Modal loses title on retry", "html_url": "` + scenarioIssueURL + `"}}`
+	slackClient.historyErrs = map[string]error{"C_CONFIRM": errors.New("ratelimited")}
+	if err := handleGitHubIssueEvent(ctx, rdb, slackClient, closed, config); err == nil {
+		t.Fatal("Expected the history error to be returned")
+	}
+	slackClient.historyErrs = nil
+	if err := handleGitHubIssueEvent(ctx, rdb, slackClient, closed, config); err != nil {
+		t.Fatalf("handleGitHubIssueEvent returned error: %v", err)
+	}
+
+	followUps := rdb.popList(config.RedisSlackLinerList)
+	if len(followUps) != 1 || !strings.Contains(followUps[0], "was closed") {
+		t.Errorf("Expected one closed follow-up, got %v", followUps)
+	}
+}
+
+func TestScenarioIssueIndex(t *testing.T) {
+	ctx := context.Background()
+	rdb := newFakeRedis()
+	slackClient := newFakeSlack()
+
+	// SlackLiner's HTTP API returns where it posted the confirmation
+	slackLiner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"channel": "C_CONFIRM", "ts": "1700000100.000001"}`))
+	}))
+	defer slackLiner.Close()
+	config := scenarioConfig()
+	config.SlackLinerURL = slackLiner.URL
+
+	if err := handleViewSubmission(ctx, rdb, slackClient, scenarioViewSubmission, config); err != nil {
+		t.Fatalf("handleViewSubmission returned error: %v", err)
+	}
+	create := rdb.popPoppitCommands(t, config.RedisPoppitList)[0]
+	if err := handlePoppitOutput(ctx, rdb, slackClient, poppitOutputFor(t, create, scenarioIssueURL+"\n"), config); err != nil {
+		t.Fatalf("handlePoppitOutput returned error: %v", err)
+	}
+
+	// The confirmation is found in the index without reading channel history
+	channelID, ts, err := findMessageByIssueURL(ctx, rdb, slackClient, scenarioIssueURL, config)
+	if err != nil || channelID != "C_CONFIRM" || ts != "1700000100.000001" {
+		t.Fatalf("Expected the indexed confirmation, got %q %q %v", channelID, ts, err)
+	}
+	if slackClient.historyCalls != 0 {
+		t.Errorf("Expected no history scan for an indexed issue, got %d", slackClient.historyCalls)
+	}
+
+	// Confirmations sent through the SlackLiner list are not indexed until the
+	// first history scan finds them
+	const listIssueURL = "https://github.com/its-the-vibe/SlashVibeIssue/issues/43"
+	listTs := slackClient.addConfirmation(buildConfirmationMessage(IssueConfirmation{
+		Repo: "SlashVibeIssue", Title: "Another", Username: "alice", IssueURL: listIssueURL,
+	}, config))
+	for i := 0; i < 2; i++ {
+		channelID, ts, err := findMessageByIssueURL(ctx, rdb, slackClient, listIssueURL, config)
+		if err != nil || channelID != "C_CONFIRM" || ts != listTs {
+			t.Fatalf("Expected the confirmation at %s, got %q %q %v", listTs, channelID, ts, err)
+		}
+	}
+	if slackClient.historyCalls != 1 {
+		t.Errorf("Expected one history scan that back-fills the index, got %d", slackClient.historyCalls)
+	}
+}
@@ -1,10 +1,71 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/slack-go/slack"
 )
 
+const (
+	repoSelectActionID     = "SlashVibeIssue"
+	issueTemplateActionID  = "issue_template"
+	issueLabelsActionID    = "issue_labels"
+	issueAssigneesActionID = "issue_assignees"
+	issueMilestoneActionID = "issue_milestone"
+	maxOptionTextChars     = 74   // Slack allows 75, leaving room for the ellipsis
+	maxInitialValueChars   = 2999 // likewise for the 3000 of a text input
+	// Slack allows at most 100 options in a static select, or in each of its
+	// option groups
+	maxSelectOptions = 100
+)
+
+// issueModalOptions describes the initial state of the create-issue modal.
+// It is also serialised into Poppit metadata so the modal can be rebuilt once
+// an asynchronous lookup completes.
+type issueModalOptions struct {
+	Title           string             `json:"title,omitempty"`
+	Description     string             `json:"description,omitempty"`
+	Repo            string             `json:"repo,omitempty"`
+	AssignToCopilot bool               `json:"assignToCopilot,omitempty"`
+	AddToProject    bool               `json:"addToProject,omitempty"`
+	SanitiseIssue   bool               `json:"sanitiseIssue,omitempty"`
+	AssignToMe      bool               `json:"assignToMe,omitempty"`
+	IncludeThread   bool               `json:"includeThread,omitempty"`
+	Templates       []IssueTemplate    `json:"-"`
+	Labels          []RepoLabel        `json:"-"`
+	Assignable      []RepoUser         `json:"-"`
+	Milestones      []RepoMilestone    `json:"-"`
+	LabelsTotal     int                `json:"-"`
+	AssignableTotal int                `json:"-"`
+	MilestonesTotal int                `json:"-"`
+	Metadata        IssueModalMetadata `json:"metadata"`
+}
+
+// setRepoDetails makes the selected repository's templates, labels, assignable
+// users and milestones available to the modal.
+func (opts *issueModalOptions) setRepoDetails(details RepoDetails) {
+	opts.Templates = details.Templates
+	opts.Labels = details.Labels
+	opts.Assignable = details.Assignees
+	opts.Milestones = details.Milestones
+	opts.LabelsTotal = details.LabelsTotal
+	opts.AssignableTotal = details.AssigneesTotal
+	opts.MilestonesTotal = details.MilestonesTotal
+}
+
 func createIssueModal(initialTitle, initialDescription string, preselectCopilot bool) slack.ModalViewRequest {
+	return createIssueModalWithOptions(issueModalOptions{
+		Title:           initialTitle,
+		Description:     initialDescription,
+		AssignToCopilot: preselectCopilot,
+		AddToProject:    true,
+	})
+}
+
+func createIssueModalWithOptions(opts issueModalOptions) slack.ModalViewRequest {
 	titleInput := &slack.PlainTextInputBlockElement{
 		Type:     slack.METPlainTextInput,
 		ActionID: "issue_title",
@@ -15,8 +76,8 @@ func createIssueModal(initialTitle, initialDescription string, preselectCopilot
 	}
 
 	// Pre-populate title if provided
-	if initialTitle != "" {
-		titleInput.InitialValue = initialTitle
+	if opts.Title != "" {
+		titleInput.InitialValue = opts.Title
 	}
 
 	descriptionInput := &slack.PlainTextInputBlockElement{
@@ -29,9 +90,30 @@ func createIssueModal(initialTitle, initialDescription string, preselectCopilot
 		},
 	}
 
-	// Pre-populate description if provided
-	if initialDescription != "" {
-		descriptionInput.InitialValue = initialDescription
+	// Pre-populate description if provided; Slack rejects the whole view if
+	// it is too long
+	if opts.Description != "" {
+		descriptionInput.InitialValue = truncate(opts.Description, maxInitialValueChars)
+	}
+
+	repoSelect := &slack.SelectBlockElement{
+		Type:     slack.OptTypeExternal,
+		ActionID: repoSelectActionID,
+		Placeholder: &slack.TextBlockObject{
+			Type: slack.PlainTextType,
+			Text: "Search for a repo...",
+		},
+	}
+
+	// Pre-select the repository if provided
+	if opts.Repo != "" {
+		repoSelect.InitialOption = &slack.OptionBlockObject{
+			Text: &slack.TextBlockObject{
+				Type: slack.PlainTextType,
+				Text: opts.Repo,
+			},
+			Value: opts.Repo,
+		}
 	}
 
 	// Create checkbox option
@@ -50,7 +132,7 @@ func createIssueModal(initialTitle, initialDescription string, preselectCopilot
 	)
 
 	// Pre-select the checkbox if requested
-	if preselectCopilot {
+	if opts.AssignToCopilot {
 		checkboxElement.InitialOptions = []*slack.OptionBlockObject{copilotOption}
 	}
 
@@ -63,12 +145,14 @@ func createIssueModal(initialTitle, initialDescription string, preselectCopilot
 		Value: "true",
 	}
 
-	// Create project checkbox element (selected by default)
+	// Create project checkbox element
 	projectCheckboxElement := slack.NewCheckboxGroupsBlockElement(
 		"add_to_project",
 		projectOption,
 	)
-	projectCheckboxElement.InitialOptions = []*slack.OptionBlockObject{projectOption}
+	if opts.AddToProject {
+		projectCheckboxElement.InitialOptions = []*slack.OptionBlockObject{projectOption}
+	}
 
 	// Create sanitize issue checkbox option
 	sanitizeOption := &slack.OptionBlockObject{
@@ -84,10 +168,105 @@ func createIssueModal(initialTitle, initialDescription string, preselectCopilot
 		"sanitise_issue",
 		sanitizeOption,
 	)
+	if opts.SanitiseIssue {
+		sanitizeCheckboxElement.InitialOptions = []*slack.OptionBlockObject{sanitizeOption}
+	}
+
+	// Create assign to me checkbox option; the submitter's GitHub login comes
+	// from their /issue link-github mapping
+	assignToMeOption := &slack.OptionBlockObject{
+		Text: &slack.TextBlockObject{
+			Type: slack.PlainTextType,
+			Text: "Assign to me",
+		},
+		Value: "true",
+	}
+
+	assignToMeCheckboxElement := slack.NewCheckboxGroupsBlockElement(
+		"assign_to_me",
+		assignToMeOption,
+	)
+	if opts.AssignToMe {
+		assignToMeCheckboxElement.InitialOptions = []*slack.OptionBlockObject{assignToMeOption}
+	}
+
+	blocks := []slack.Block{
+		&slack.SectionBlock{
+			Type: slack.MBTSection,
+			Text: &slack.TextBlockObject{
+				Type: slack.MarkdownType,
+				Text: "Fill out the details below to open a new issue in your repository.",
+			},
+		},
+		&slack.InputBlock{
+			Type:    slack.MBTInput,
+			BlockID: "repo_selection_block",
+			Label: &slack.TextBlockObject{
+				Type: slack.PlainTextType,
+				Text: "Select Repository",
+			},
+			Element: repoSelect,
+			// Fire a block action on selection so the repo's templates can be loaded
+			DispatchAction: true,
+		},
+	}
+
+	blocks = append(blocks, templateBlocks(opts)...)
+
+	blocks = append(blocks,
+		&slack.InputBlock{
+			Type:    slack.MBTInput,
+			BlockID: "title_block",
+			Label: &slack.TextBlockObject{
+				Type: slack.PlainTextType,
+				Text: "Issue Title",
+			},
+			Element: titleInput,
+		},
+		&slack.InputBlock{
+			Type:    slack.MBTInput,
+			BlockID: "description_block",
+			Label: &slack.TextBlockObject{
+				Type: slack.PlainTextType,
+				Text: "Description",
+			},
+			Element: descriptionInput,
+		},
+	)
+
+	blocks = append(blocks, issueFieldBlocks(opts)...)
+
+	if len(opts.Metadata.Attachments) > 0 {
+		names := make([]string, len(opts.Metadata.Attachments))
+		for i, attachment := range opts.Metadata.Attachments {
+			names[i] = attachment.Name
+		}
+		blocks = append(blocks, slack.NewContextBlock("attachments_block",
+			slack.NewTextBlockObject(slack.MarkdownType, "📎 *Attached to the issue:* "+strings.Join(names, ", "), false, false)))
+	}
+	if opts.Metadata.SourceTs != "" {
+		blocks = append(blocks, threadBlock(opts))
+	}
+
+	blocks = append(blocks,
+		&slack.ActionBlock{
+			Type:    slack.MBTAction,
+			BlockID: "assignment_block",
+			Elements: &slack.BlockElements{
+				ElementSet: []slack.BlockElement{
+					checkboxElement,
+					projectCheckboxElement,
+					sanitizeCheckboxElement,
+					assignToMeCheckboxElement,
+				},
+			},
+		},
+	)
 
 	return slack.ModalViewRequest{
-		Type:       slack.VTModal,
-		CallbackID: "create_github_issue_modal",
+		Type:            slack.VTModal,
+		CallbackID:      "create_github_issue_modal",
+		PrivateMetadata: encodeModalMetadata(opts.Metadata),
 		Title: &slack.TextBlockObject{
 			Type: slack.PlainTextType,
 			Text: "New GitHub Issue",
@@ -100,61 +279,220 @@ func createIssueModal(initialTitle, initialDescription string, preselectCopilot
 			Type: slack.PlainTextType,
 			Text: "Cancel",
 		},
-		Blocks: slack.Blocks{
-			BlockSet: []slack.Block{
-				&slack.SectionBlock{
-					Type: slack.MBTSection,
-					Text: &slack.TextBlockObject{
-						Type: slack.MarkdownType,
-						Text: "Fill out the details below to open a new issue in your repository.",
-					},
-				},
-				&slack.InputBlock{
-					Type:    slack.MBTInput,
-					BlockID: "repo_selection_block",
-					Label: &slack.TextBlockObject{
-						Type: slack.PlainTextType,
-						Text: "Select Repository",
-					},
-					Element: &slack.SelectBlockElement{
-						Type:     slack.OptTypeExternal,
-						ActionID: "SlashVibeIssue",
-						Placeholder: &slack.TextBlockObject{
-							Type: slack.PlainTextType,
-							Text: "Search for a repo...",
-						},
-					},
-				},
-				&slack.InputBlock{
-					Type:    slack.MBTInput,
-					BlockID: "title_block",
-					Label: &slack.TextBlockObject{
-						Type: slack.PlainTextType,
-						Text: "Issue Title",
-					},
-					Element: titleInput,
-				},
-				&slack.InputBlock{
-					Type:    slack.MBTInput,
-					BlockID: "description_block",
-					Label: &slack.TextBlockObject{
-						Type: slack.PlainTextType,
-						Text: "Description",
-					},
-					Element: descriptionInput,
-				},
-				&slack.ActionBlock{
-					Type:    slack.MBTAction,
-					BlockID: "assignment_block",
-					Elements: &slack.BlockElements{
-						ElementSet: []slack.BlockElement{
-							checkboxElement,
-							projectCheckboxElement,
-							sanitizeCheckboxElement,
-						},
-					},
-				},
-			},
-		},
+		Blocks: slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// threadBlock renders the "Include thread replies" checkbox for modals opened
+// from a message.  Toggling it generates the title and description again.
+func threadBlock(opts issueModalOptions) slack.Block {
+	option := slack.NewOptionBlockObject("true",
+		slack.NewTextBlockObject(slack.PlainTextType, "Include thread replies", false, false), nil)
+	checkbox := slack.NewCheckboxGroupsBlockElement(includeThreadActionID, option)
+	if opts.IncludeThread {
+		checkbox.InitialOptions = []*slack.OptionBlockObject{option}
+	}
+	return slack.NewActionBlock("thread_block", checkbox)
+}
+
+// templateBlocks renders the issue template picker, plus a summary of the
+// labels, assignees and milestone the issue will be created with.  The picker
+// is only shown once the selected repository is known to have templates.
+func templateBlocks(opts issueModalOptions) []slack.Block {
+	var blocks []slack.Block
+	if len(opts.Templates) > 0 {
+		blocks = append(blocks, templatePickerBlock(opts))
+	}
+
+	// Values with a picker of their own are shown there instead
+	var defaults []string
+	if len(opts.Metadata.Labels) > 0 && len(opts.Labels) == 0 {
+		defaults = append(defaults, "*Labels:* "+strings.Join(opts.Metadata.Labels, ", "))
+	}
+	if len(opts.Metadata.Assignees) > 0 && len(opts.Assignable) == 0 {
+		defaults = append(defaults, "*Assignees:* "+strings.Join(opts.Metadata.Assignees, ", "))
+	}
+	if opts.Metadata.Milestone != "" && len(opts.Milestones) == 0 {
+		defaults = append(defaults, "*Milestone:* "+opts.Metadata.Milestone)
+	}
+	if len(defaults) > 0 {
+		blocks = append(blocks, slack.NewContextBlock("template_defaults_block",
+			slack.NewTextBlockObject(slack.MarkdownType, strings.Join(defaults, "  ·  "), false, false)))
+	}
+
+	return blocks
+}
+
+func templatePickerBlock(opts issueModalOptions) slack.Block {
+	options := make([]*slack.OptionBlockObject, 0, len(opts.Templates))
+	var selected *slack.OptionBlockObject
+	for i, tmpl := range opts.Templates {
+		var description *slack.TextBlockObject
+		if tmpl.About != "" {
+			description = slack.NewTextBlockObject(slack.PlainTextType, truncate(tmpl.About, maxOptionTextChars), false, false)
+		}
+		option := slack.NewOptionBlockObject(strconv.Itoa(i),
+			slack.NewTextBlockObject(slack.PlainTextType, truncate(tmpl.Name, maxOptionTextChars), false, false),
+			description)
+		options = append(options, option)
+		if tmpl.Name == opts.Metadata.Template {
+			selected = option
+		}
+	}
+
+	templateSelect := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic,
+		slack.NewTextBlockObject(slack.PlainTextType, "Choose a template...", false, false),
+		issueTemplateActionID, options...)
+	templateSelect.InitialOption = selected
+
+	return slack.NewActionBlock("template_block", templateSelect)
+}
+
+// issueFieldBlocks renders optional label, assignee and milestone pickers
+// populated from the selected repository.  Values in the modal metadata, such
+// as a template's default labels, are preselected.
+func issueFieldBlocks(opts issueModalOptions) []slack.Block {
+	var blocks []slack.Block
+
+	if len(opts.Labels) > 0 {
+		var options []*slack.OptionBlockObject
+		for _, label := range opts.Labels {
+			var description *slack.TextBlockObject
+			if label.Description != "" {
+				description = slack.NewTextBlockObject(slack.PlainTextType, truncate(label.Description, maxOptionTextChars), false, false)
+			}
+			options = append(options, slack.NewOptionBlockObject(label.Name,
+				slack.NewTextBlockObject(slack.PlainTextType, label.Name, false, false), description))
+		}
+		blocks = append(blocks, multiSelectInputBlock("labels_block", "Labels", "Choose labels...",
+			issueLabelsActionID, options, opts.Metadata.Labels, partialListHint(len(options), opts.LabelsTotal, "labels")))
+	}
+
+	if len(opts.Assignable) > 0 {
+		var options []*slack.OptionBlockObject
+		for _, user := range opts.Assignable {
+			text := user.Login
+			if user.Name != "" {
+				text = fmt.Sprintf("%s (%s)", user.Login, user.Name)
+			}
+			options = append(options, slack.NewOptionBlockObject(user.Login,
+				slack.NewTextBlockObject(slack.PlainTextType, truncate(text, maxOptionTextChars), false, false), nil))
+		}
+		blocks = append(blocks, multiSelectInputBlock("assignees_block", "Assignees", "Choose assignees...",
+			issueAssigneesActionID, options, opts.Metadata.Assignees, partialListHint(len(options), opts.AssignableTotal, "assignable users")))
+	}
+
+	if len(opts.Milestones) > 0 {
+		var options []*slack.OptionBlockObject
+		var selected *slack.OptionBlockObject
+		for _, milestone := range opts.Milestones {
+			option := slack.NewOptionBlockObject(milestone.Title,
+				slack.NewTextBlockObject(slack.PlainTextType, truncate(milestone.Title, maxOptionTextChars), false, false), nil)
+			options = append(options, option)
+			if milestone.Title == opts.Metadata.Milestone {
+				selected = option
+			}
+		}
+		milestoneSelect := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic,
+			slack.NewTextBlockObject(slack.PlainTextType, "Choose a milestone...", false, false),
+			issueMilestoneActionID, options...)
+		if len(options) > maxSelectOptions {
+			milestoneSelect.Options = nil
+			milestoneSelect.OptionGroups = optionGroups(options)
+		}
+		milestoneSelect.InitialOption = selected
+		milestoneBlock := slack.NewInputBlock("milestone_block",
+			slack.NewTextBlockObject(slack.PlainTextType, "Milestone", false, false),
+			partialListHint(len(options), opts.MilestonesTotal, "open milestones"), milestoneSelect)
+		milestoneBlock.Optional = true
+		blocks = append(blocks, milestoneBlock)
+	}
+
+	return blocks
+}
+
+// multiSelectInputBlock builds an optional static multi-select input with the
+// options whose values appear in selected preselected.
+func multiSelectInputBlock(blockID, label, placeholder, actionID string, options []*slack.OptionBlockObject, selected []string, hint *slack.TextBlockObject) *slack.InputBlock {
+	var initial []*slack.OptionBlockObject
+	for _, option := range options {
+		for _, value := range selected {
+			if option.Value == value {
+				initial = append(initial, option)
+				break
+			}
+		}
+	}
+
+	element := slack.NewOptionsMultiSelectBlockElement(slack.MultiOptTypeStatic,
+		slack.NewTextBlockObject(slack.PlainTextType, placeholder, false, false), actionID, options...)
+	if len(options) > maxSelectOptions {
+		element.Options = nil
+		element.OptionGroups = optionGroups(options)
+	}
+	element.InitialOptions = initial
+
+	block := slack.NewInputBlock(blockID, slack.NewTextBlockObject(slack.PlainTextType, label, false, false), hint, element)
+	block.Optional = true
+	return block
+}
+
+// optionGroups splits options that are too many for one static select into
+// groups of maxSelectOptions, each labelled with its first and last option.
+func optionGroups(options []*slack.OptionBlockObject) []*slack.OptionGroupBlockObject {
+	var groups []*slack.OptionGroupBlockObject
+	for start := 0; start < len(options); start += maxSelectOptions {
+		group := options[start:min(start+maxSelectOptions, len(options))]
+		label := fmt.Sprintf("%s – %s", truncate(group[0].Text.Text, 35), truncate(group[len(group)-1].Text.Text, 35))
+		groups = append(groups, slack.NewOptionGroupBlockElement(
+			slack.NewTextBlockObject(slack.PlainTextType, label, false, false), group...))
+	}
+	return groups
+}
+
+// partialListHint says how many of a repository's labels, users or
+// milestones a picker leaves out, or is nil when it shows them all.
+func partialListHint(shown, total int, noun string) *slack.TextBlockObject {
+	if total <= shown {
+		return nil
+	}
+	return slack.NewTextBlockObject(slack.PlainTextType,
+		fmt.Sprintf("Showing the first %d of %d %s; add others to the issue on GitHub.", shown, total, noun), false, false)
+}
+
+// encodeModalMetadata serialises the modal metadata for private_metadata.
+func encodeModalMetadata(metadata IssueModalMetadata) string {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		Error("Error encoding modal metadata: %v", err)
+		return ""
+	}
+	// Every field is omitempty, so empty metadata is "{}"
+	if string(data) == "{}" {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeModalMetadata parses a modal's private_metadata.  Empty or malformed
+// metadata decodes to the zero value.
+func decodeModalMetadata(privateMetadata string) IssueModalMetadata {
+	var metadata IssueModalMetadata
+	if privateMetadata == "" {
+		return metadata
+	}
+	if err := json.Unmarshal([]byte(privateMetadata), &metadata); err != nil {
+		Warn("Ignoring malformed modal metadata: %v", err)
+		return IssueModalMetadata{}
+	}
+	return metadata
+}
+
+// templateOption returns the template chosen by a template picker option value.
+func templateOption(templates []IssueTemplate, value string) (IssueTemplate, error) {
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 || i >= len(templates) {
+		return IssueTemplate{}, fmt.Errorf("unknown issue template option %q", value)
 	}
+	return templates[i], nil
 }
@@ -3,68 +3,58 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/redis/go-redis/v9"
-	"github.com/slack-go/slack"
 )
 
-func subscribeToSlashCommands(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, config Config) {
-	pubsub := rdb.Subscribe(ctx, config.RedisChannel)
-	defer pubsub.Close()
-
-	Info("Subscribed to Redis channel: %s", config.RedisChannel)
-
-	ch := pubsub.Channel()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case msg := <-ch:
-			if msg == nil {
-				continue
-			}
-			handleSlashCommand(ctx, slackClient, msg.Payload, config)
-		}
+func subscribeToSlashCommands(ctx context.Context, rdb *redis.Client, slackClient SlackAPI, config Config) error {
+	handler := func(ctx context.Context, payload string) error {
+		return handleSlashCommand(ctx, rdb, slackClient, payload, currentConfig())
 	}
+	return consumeChannel(ctx, rdb, config.RedisChannel, "slash-commands", config,
+		withIdempotency(rdb, "slash-commands", config, payloadKey("trigger_id"), handler))
 }
 
-func handleSlashCommand(ctx context.Context, slackClient *slack.Client, payload string, config Config) {
+func handleSlashCommand(ctx context.Context, rdb RedisClient, slackClient SlackAPI, payload string, config Config) error {
 	var cmd SlackCommand
 	if err := json.Unmarshal([]byte(payload), &cmd); err != nil {
-		Error("Error unmarshaling slash command: %v", err)
-		return
+		return fmt.Errorf("error unmarshaling slash command: %v", err)
 	}
 
 	// Only handle /issue command
 	if cmd.Command != "/issue" {
-		return
+		ignoreEvent(ctx)
+		return nil
 	}
 
-	Info("Received /issue command from user %s", cmd.UserName)
+	InfoContext(ctx, "Received /issue command from user %s", cmd.UserName)
 
-	// Check if the text is the sparkles emoji for setup-ai command
 	text := strings.TrimSpace(cmd.Text)
-	var initialTitle, initialDescription string
-	var preselectCopilot bool
 
-	if text == ":sparkles:" {
-		initialTitle = "✨ Set up Copilot instructions"
-		initialDescription = "Configure instructions for this repository as documented in [Best practices for Copilot coding agent in your repository](https://gh.io/copilot-coding-agent-tips).\n\n<Onboard this repo>"
-		preselectCopilot = true
-	} else {
-		initialTitle = text
-		initialDescription = ""
-		preselectCopilot = false
+	// Subcommands take precedence over free text titles
+	if sub, args, ok := lookupSubcommand(text); ok {
+		DebugContext(ctx, "Dispatching /issue %s subcommand", sub.Name)
+		return sub.Handle(ctx, rdb, slackClient, cmd, args, config)
+	}
+
+	// Trigger text such as :sparkles: opens a preset
+	if preset, rest, ok := matchPresetTrigger(config.Presets, text); ok {
+		return openPresetModal(ctx, rdb, slackClient, cmd, preset, rest, config)
 	}
 
-	// Open modal with pre-populated values
-	modal := createIssueModal(initialTitle, initialDescription, preselectCopilot)
+	// Open modal with the text as the title
+	modal := createIssueModalWithOptions(issueModalOptions{
+		Title:        text,
+		AddToProject: true,
+		Metadata:     IssueModalMetadata{SourceChannel: cmd.ChannelID},
+	})
 	_, err := slackClient.OpenView(cmd.TriggerID, modal)
 	if err != nil {
-		Error("Error opening modal: %v", err)
-		return
+		return fmt.Errorf("error opening modal: %v", err)
 	}
 
-	Debug("Modal opened successfully")
+	DebugContext(ctx, "Modal opened successfully")
+	return nil
 }
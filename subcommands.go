@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxListedIssues = 20
+	maxFoundIssues  = 10
+)
+
+// subcommandHandler handles "/issue <name> <args>".  args is the text after
+// the subcommand name, with surrounding whitespace removed.
+type subcommandHandler func(ctx context.Context, rdb RedisClient, slackClient SlackAPI, cmd SlackCommand, args string, config Config) error
+
+type subcommand struct {
+	Name        string
+	Usage       string
+	Description string
+	Handle      subcommandHandler
+	// Accepts reports whether non-empty args have the subcommand's shape;
+	// text that doesn't, such as "close button is broken", is an issue title.
+	// Nil accepts any args.
+	Accepts func(args string) bool
+}
+
+// subcommands is the /issue subcommand registry; help text is generated from
+// it.  It is a function rather than a variable because "help" refers back to it.
+func subcommands() []subcommand {
+	return []subcommand{
+		{Name: "help", Usage: "/issue help", Description: "Show this help", Handle: handleHelpSubcommand, Accepts: noArgs},
+		{Name: "list", Usage: "/issue list <repo>", Description: "List open issues in a repository", Handle: handleListSubcommand, Accepts: maxArgs(1)},
+		{Name: "close", Usage: "/issue close <issue-url>", Description: "Close an issue", Handle: handleCloseSubcommand, Accepts: issueURLArgs(1)},
+		{Name: "assign", Usage: "/issue assign <issue-url> copilot|jules|@user", Description: "Assign an issue to Copilot, Jules or a GitHub user", Handle: handleAssignSubcommand, Accepts: issueURLArgs(2)},
+		{Name: "search", Usage: "/issue search <query>", Description: "Search issues", Handle: handleSearchSubcommand},
+		{Name: "preset", Usage: "/issue preset <name> [text]", Description: "Open the modal pre-filled from a preset", Handle: handlePresetSubcommand},
+		{Name: "link-github", Usage: "/issue link-github [@user] [login]", Description: "Show your GitHub login link; admins link accounts", Handle: handleLinkGitHubSubcommand, Accepts: maxArgs(2)},
+	}
+}
+
+// lookupSubcommand finds the subcommand named by the first word of text,
+// provided the rest of text has the subcommand's shape.
+func lookupSubcommand(text string) (subcommand, string, bool) {
+	name, args, _ := strings.Cut(strings.TrimSpace(text), " ")
+	args = strings.TrimSpace(args)
+	for _, sub := range subcommands() {
+		if !strings.EqualFold(sub.Name, name) {
+			continue
+		}
+		if args != "" && sub.Accepts != nil && !sub.Accepts(args) {
+			return subcommand{}, "", false
+		}
+		return sub, args, true
+	}
+	return subcommand{}, "", false
+}
+
+func noArgs(args string) bool {
+	return false
+}
+
+// maxArgs accepts up to max whitespace-separated args.
+func maxArgs(max int) func(string) bool {
+	return func(args string) bool {
+		return len(strings.Fields(args)) <= max
+	}
+}
+
+// issueURLArgs accepts up to max args of which the first is an issue URL.
+// The handler reports a missing or invalid second argument.
+func issueURLArgs(max int) func(string) bool {
+	return func(args string) bool {
+		fields := strings.Fields(args)
+		return len(fields) <= max && validateIssueURL(strings.Trim(fields[0], "<>")) == nil
+	}
+}
+
+// subcommandHelp renders the usage of every registered subcommand.
+func subcommandHelp() string {
+	lines := []string{
+		"*Usage:*",
+		"• `/issue` — Open the new issue modal",
+		"• `/issue <title>` — Open the modal with a title",
+	}
+	for _, sub := range subcommands() {
+		lines = append(lines, fmt.Sprintf("• `%s` — %s", sub.Usage, sub.Description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// respondEphemeral replies to a slash command with a message only the
+// invoking user can see.
+func respondEphemeral(ctx context.Context, responseURL, text string) error {
+	return postToResponseURL(ctx, responseURL, SlackResponseMessage{
+		ResponseType: "ephemeral",
+		Text:         text,
+	})
+}
+
+// respondUsage replies with a subcommand's usage after invalid arguments.
+func respondUsage(ctx context.Context, cmd SlackCommand, sub, problem string) error {
+	for _, s := range subcommands() {
+		if s.Name == sub {
+			return respondEphemeral(ctx, cmd.ResponseURL, fmt.Sprintf("❌ %s\nUsage: `%s`", problem, s.Usage))
+		}
+	}
+	return respondEphemeral(ctx, cmd.ResponseURL, "❌ "+problem)
+}
+
+func handleHelpSubcommand(ctx context.Context, rdb RedisClient, slackClient SlackAPI, cmd SlackCommand, args string, config Config) error {
+	return respondEphemeral(ctx, cmd.ResponseURL, subcommandHelp())
+}
+
+func handleLinkGitHubSubcommand(ctx context.Context, rdb RedisClient, slackClient SlackAPI, cmd SlackCommand, args string, config Config) error {
+	return handleLinkGitHubCommand(ctx, rdb, cmd, args, config)
+}
+
+func handleListSubcommand(ctx context.Context, rdb RedisClient, slackClient SlackAPI, cmd SlackCommand, args string, config Config) error {
+	if args == "" {
+		return respondUsage(ctx, cmd, "list", "Please give a repository.")
+	}
+	repoFullName := parseRepoFullName(args, config.GitHubOrg)
+	if err := validateRepoFullName(repoFullName); err != nil {
+		return respondUsage(ctx, cmd, "list", fmt.Sprintf("`%s` is not a valid repository.", args))
+	}
+
+	ghCmd := newShellCommand("gh", "issue", "list").
+		Flag("--repo", repoFullName).
+		Flag("--state", "open").
+		Flag("--limit", fmt.Sprint(maxListedIssues)).
+		Flag("--json", "number,title,url")
+
+	return pushSubcommand(ctx, rdb, "slash-vibe-issue-list", repoFullName, ghCmd, cmd,
+		map[string]interface{}{"repo": repoFullName}, config)
+}
+
+func handleSearchSubcommand(ctx context.Context, rdb RedisClient, slackClient SlackAPI, cmd SlackCommand, args string, config Config) error {
+	if args == "" {
+		return respondUsage(ctx, cmd, "search", "Please give a search query.")
+	}
+
+	ghCmd := newShellCommand("gh", "search", "issues").
+		Flag("--limit", fmt.Sprint(maxFoundIssues)).
+		Flag("--json", "number,title,url,repository")
+	if config.GitHubOrg != "" {
+		ghCmd.Flag("--owner", config.GitHubOrg)
+	}
+	// "--" keeps a query such as "-label:bug" from being read as a flag
+	ghCmd.Arg("--").Arg(args)
+
+	return pushSubcommand(ctx, rdb, "slash-vibe-issue-search", fmt.Sprintf("%s/SlashVibeIssue", config.GitHubOrg), ghCmd, cmd,
+		map[string]interface{}{"query": args}, config)
+}
+
+func handleCloseSubcommand(ctx context.Context, rdb RedisClient, slackClient SlackAPI, cmd SlackCommand, args string, config Config) error {
+	issueURL := strings.Trim(args, "<>")
+	if err := validateIssueURL(issueURL); err != nil {
+		return respondUsage(ctx, cmd, "close", "Please give a GitHub issue URL.")
+	}
+
+	ghCmd := newShellCommand("gh", "issue", "close", issueURL)
+
+	return pushSubcommand(ctx, rdb, "slash-vibe-issue-close", repoFromIssueURL(issueURL), ghCmd, cmd,
+		map[string]interface{}{"issueURL": issueURL}, config)
+}
+
+func handleAssignSubcommand(ctx context.Context, rdb RedisClient, slackClient SlackAPI, cmd SlackCommand, args string, config Config) error {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return respondUsage(ctx, cmd, "assign", "Please give an issue URL and an assignee.")
+	}
+
+	issueURL := strings.Trim(fields[0], "<>")
+	if err := validateIssueURL(issueURL); err != nil {
+		return respondUsage(ctx, cmd, "assign", "Please give a GitHub issue URL.")
+	}
+	repo := repoFromIssueURL(issueURL)
+
+	switch assignee := fields[1]; strings.ToLower(assignee) {
+	case "copilot":
+		if err := assignIssueToCopilot(ctx, rdb, issueURL, repo, cmd.UserID, config); err != nil {
+			return err
+		}
+		return respondEphemeral(ctx, cmd.ResponseURL, fmt.Sprintf("⏳ Assigning %s to Copilot…", issueURL))
+	case "jules":
+		if err := assignIssueToJules(ctx, rdb, issueURL, repo, cmd.UserID, config); err != nil {
+			return err
+		}
+		return respondEphemeral(ctx, cmd.ResponseURL, fmt.Sprintf("⏳ Labelling %s for Jules…", issueURL))
+	default:
+		login, err := normaliseGitHubLogin(assignee)
+		if err != nil {
+			return respondUsage(ctx, cmd, "assign", fmt.Sprintf("`%s` is not copilot, jules or a GitHub login.", assignee))
+		}
+
+		ghCmd := newShellCommand("gh", "issue", "edit").
+			Flag("--add-assignee", login).
+			Arg(issueURL)
+
+		return pushSubcommand(ctx, rdb, "slash-vibe-issue-assign-user", repo, ghCmd, cmd,
+			map[string]interface{}{"issueURL": issueURL, "assignee": login}, config)
+	}
+}
+
+func handlePresetSubcommand(ctx context.Context, rdb RedisClient, slackClient SlackAPI, cmd SlackCommand, args string, config Config) error {
+	name, text, _ := strings.Cut(args, " ")
+	preset, ok := findPreset(config.Presets, name)
+	if !ok {
+		var names []string
+		for _, p := range config.Presets {
+			names = append(names, "`"+p.Name+"`")
+		}
+		return respondUsage(ctx, cmd, "preset", fmt.Sprintf("Unknown preset `%s`. Available presets: %s", name, strings.Join(names, ", ")))
+	}
+	return openPresetModal(ctx, rdb, slackClient, cmd, preset, strings.TrimSpace(text), config)
+}
+
+// pushSubcommand sends a subcommand's gh command to Poppit.  The response_url
+// travels in the metadata so handleSubcommandOutput can reply to the user.
+func pushSubcommand(ctx context.Context, rdb RedisClient, commandType, repo string, ghCmd *shellCommand, cmd SlackCommand, metadata map[string]interface{}, config Config) error {
+	metadata["response_url"] = cmd.ResponseURL
+	metadata["user_id"] = cmd.UserID
+
+	poppitCmd := PoppitCommand{
+		Repo:     repo,
+		Branch:   "refs/heads/main",
+		Type:     commandType,
+		Dir:      config.WorkingDir,
+		Commands: []string{ghCmd.String()},
+		Metadata: metadata,
+	}
+
+	if err := pushPoppitCommand(ctx, rdb, config.RedisPoppitList, poppitCmd); err != nil {
+		return err
+	}
+
+	DebugContext(ctx, "%s command sent to Poppit for user %s", commandType, cmd.UserName)
+	return nil
+}
+
+// issueSummary is one entry of gh issue list / gh search issues JSON output.
+type issueSummary struct {
+	Number     int    `json:"number"`
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	Repository struct {
+		NameWithOwner string `json:"nameWithOwner"`
+	} `json:"repository"`
+}
+
+// handleSubcommandOutput replies to the user who ran a Poppit-backed
+// subcommand with its result.
+func handleSubcommandOutput(ctx context.Context, output PoppitOutput) error {
+	responseURL, _ := output.Metadata["response_url"].(string)
+	if responseURL == "" {
+		WarnContext(ctx, "No response_url in %s output", output.Type)
+		return nil
+	}
+
+	text, err := formatSubcommandOutput(output)
+	if err != nil {
+		return err
+	}
+	return respondEphemeral(ctx, responseURL, text)
+}
+
+// formatSubcommandOutput renders the reply for a subcommand's Poppit output.
+func formatSubcommandOutput(output PoppitOutput) (string, error) {
+	if reason, failed := poppitFailure(output); failed {
+		return fmt.Sprintf("❌ Command failed:\n```%s```", truncate(reason, maxFailureReasonLength)), nil
+	}
+
+	metadata := output.Metadata
+	switch output.Type {
+	case "slash-vibe-issue-list":
+		repo, _ := metadata["repo"].(string)
+		issues, err := parseIssueSummaries(output.Output)
+		if err != nil {
+			return "", err
+		}
+		if len(issues) == 0 {
+			return fmt.Sprintf("No open issues in *%s*.", repo), nil
+		}
+		return fmt.Sprintf("*Open issues in %s:*\n%s", repo, formatIssueSummaries(issues)), nil
+	case "slash-vibe-issue-search":
+		query, _ := metadata["query"].(string)
+		issues, err := parseIssueSummaries(output.Output)
+		if err != nil {
+			return "", err
+		}
+		if len(issues) == 0 {
+			return fmt.Sprintf("No issues match `%s`.", escapeSlackText(query)), nil
+		}
+		return fmt.Sprintf("*Issues matching* `%s`*:*\n%s", escapeSlackText(query), formatIssueSummaries(issues)), nil
+	case "slash-vibe-issue-close":
+		issueURL, _ := metadata["issueURL"].(string)
+		return fmt.Sprintf("✅ Closed %s", issueURL), nil
+	case "slash-vibe-issue-assign-user":
+		issueURL, _ := metadata["issueURL"].(string)
+		assignee, _ := metadata["assignee"].(string)
+		return fmt.Sprintf("✅ Assigned %s to %s", issueURL, assignee), nil
+	}
+	return "", fmt.Errorf("unknown subcommand output type %q", output.Type)
+}
+
+func parseIssueSummaries(output string) ([]issueSummary, error) {
+	var issues []issueSummary
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &issues); err != nil {
+		return nil, fmt.Errorf("error unmarshaling issue list: %v", err)
+	}
+	return issues, nil
+}
+
+func formatIssueSummaries(issues []issueSummary) string {
+	lines := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		ref := fmt.Sprintf("#%d", issue.Number)
+		if issue.Repository.NameWithOwner != "" {
+			ref = issue.Repository.NameWithOwner + ref
+		}
+		lines = append(lines, fmt.Sprintf("• <%s|%s> %s", issue.URL, ref, escapeSlackText(issue.Title)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeSlackText escapes the characters Slack treats as control sequences in
+// message text.
+func escapeSlackText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	subscriberMinBackoff = time.Second
+	subscriberMaxBackoff = time.Minute
+)
+
+// Reasons a subscriber is restarted, counted in slashvibeissue_subscriber_restarts_total.
+const (
+	restartClosed = "closed"
+	restartError  = "error"
+	restartPanic  = "panic"
+)
+
+// errSubscriptionClosed is returned by a subscriber whose Redis subscription
+// was closed underneath it, e.g. because Redis restarted.
+var errSubscriptionClosed = errors.New("subscription closed")
+
+var subscriberRestarts = newCounterVec("slashvibeissue_subscriber_restarts_total",
+	"Subscriber restarts after the subscription closed, failed or panicked, by subscriber and reason.", "subscriber", "reason")
+
+// run starts the named subscriber in a goroutine and keeps it running until
+// ctx is cancelled.  It is marked running before run returns, so readiness
+// never passes before every subscriber has been started.  A subscriber that
+// returns or panics is restarted after an exponential backoff, during which it
+// is reported as stopped; the backoff resets once it has run for longer than
+// the maximum backoff.
+func (s *subscriberStatus) run(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	s.set(name, true)
+	go func() {
+		defer s.set(name, false)
+
+		backoff := subscriberMinBackoff
+		for {
+			started := time.Now()
+			reason, err := runSubscriber(ctx, fn)
+			if ctx.Err() != nil {
+				return
+			}
+
+			subscriberRestarts.inc(name, reason)
+			s.set(name, false)
+			if time.Since(started) > subscriberMaxBackoff {
+				backoff = subscriberMinBackoff
+			}
+			Error("Subscriber %s stopped (%s): %v; restarting in %s", name, reason, err, backoff)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, subscriberMaxBackoff)
+
+			Info("Restarting subscriber %s", name)
+			s.set(name, true)
+		}
+	}()
+}
+
+// runSubscriber runs fn once, turning a panic into an error.  It returns why
+// fn stopped as one of the restart reasons.
+func runSubscriber(ctx context.Context, fn func(ctx context.Context) error) (reason string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			Error("Subscriber panic: %v\n%s", r, debug.Stack())
+			reason, err = restartPanic, fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	err = fn(ctx)
+	switch {
+	case err == nil:
+		return restartClosed, errors.New("subscriber returned")
+	case errors.Is(err, errSubscriptionClosed):
+		return restartClosed, err
+	default:
+		return restartError, err
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack"
+)
+
+const (
+	includeThreadActionID = "include_thread_replies"
+	// maxThreadMessages caps how much of a very long thread goes into an issue
+	maxThreadMessages = 200
+	threadHeading     = "### Slack thread"
+	// maxSummariserInput caps the text passed to issue-summariser
+	maxSummariserInput = 8000
+)
+
+// handleIncludeThreadToggled fires when "Include thread replies" is ticked or
+// unticked in a modal opened from the message shortcut.  The title and
+// description are generated again, from the whole thread or from the message
+// alone, keeping the rest of the modal's input.  The transcript itself is too
+// long for the modal, so it is kept in Redis and added on submission.
+func handleIncludeThreadToggled(ctx context.Context, rdb RedisClient, slackClient SlackAPI, event BlockActionEvent, config Config) error {
+	metadata := applyModalSelections(decodeModalMetadata(event.View.PrivateMetadata), event.View.State.Values)
+	if metadata.SourceChannel == "" || metadata.SourceTs == "" {
+		WarnContext(ctx, "No source message for view %s, ignoring thread toggle", event.View.ID)
+		return nil
+	}
+	if metadata.CorrelationID != "" {
+		ctx = withCorrelationID(ctx, metadata.CorrelationID)
+	}
+
+	opts := issueModalOptionsFromView(event.View.State.Values, event.View.Blocks)
+	opts.Metadata = metadata
+	details, found, err := loadRepoDetails(ctx, rdb, event.View.ID, config)
+	if err != nil {
+		return err
+	}
+	if found {
+		opts.setRepoDetails(details)
+	}
+
+	messages, err := fetchThread(slackClient, metadata.SourceChannel, metadata.SourceTs)
+	if err != nil {
+		return err
+	}
+	message := sourceMessageText(messages, metadata.SourceTs)
+	text := message
+	if opts.IncludeThread {
+		text = formatThread(slackClient, messages)
+		if err := storeTranscript(ctx, rdb, event.View.ID, text, config); err != nil {
+			return err
+		}
+	} else if err := rdb.Del(ctx, transcriptKey(event.View.ID, config)).Err(); err != nil {
+		return fmt.Errorf("failed to delete thread transcript: %v", err)
+	}
+
+	// Show the message while the new title is generated
+	opts.Title = ""
+	opts.Description = message
+	if _, err := slackClient.UpdateView(createIssueModalWithOptions(opts), "", "", event.View.ID); err != nil {
+		// The user may already have submitted or closed the modal
+		WarnContext(ctx, "Error updating modal %s for thread toggle: %v", event.View.ID, err)
+		return nil
+	}
+
+	InfoContext(ctx, "Regenerating title for user %s from %d thread messages (include replies: %t)",
+		event.User.Username, len(messages), opts.IncludeThread)
+	return generateIssueTitleViaCopilot(ctx, rdb, text, event.User.Username, event.View.ID, event.View.Hash, opts, config)
+}
+
+// transcriptKey returns the Redis key holding the thread transcript for a modal.
+func transcriptKey(viewID string, config Config) string {
+	return config.RedisTranscriptPrefix + viewID
+}
+
+// storeTranscript keeps a modal's thread transcript for as long as its repo
+// details.
+func storeTranscript(ctx context.Context, rdb RedisClient, viewID, transcript string, config Config) error {
+	ttl := time.Duration(config.RepoDetailsTTL) * time.Second
+	if err := rdb.Set(ctx, transcriptKey(viewID, config), transcript, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store thread transcript: %v", err)
+	}
+	return nil
+}
+
+// loadTranscript returns the thread transcript stored for a modal, or "" if
+// there is none.
+func loadTranscript(ctx context.Context, rdb RedisClient, viewID string, config Config) (string, error) {
+	transcript, err := rdb.Get(ctx, transcriptKey(viewID, config)).Result()
+	if errors.Is(err, redis.Nil) {
+		WarnContext(ctx, "No thread transcript for view %s, it may have expired", viewID)
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load thread transcript: %v", err)
+	}
+	return transcript, nil
+}
+
+// withThread appends a thread transcript to an issue description.
+func withThread(description, transcript string) string {
+	if transcript == "" {
+		return description
+	}
+	section := threadHeading + "\n\n" + transcript
+	if strings.TrimSpace(description) == "" {
+		return section
+	}
+	return description + "\n\n" + section
+}
+
+// fetchThread returns the thread that the message at ts belongs to, parent
+// first, up to maxThreadMessages messages.
+func fetchThread(slackClient SlackAPI, channelID, ts string) ([]slack.Message, error) {
+	params := &slack.GetConversationRepliesParameters{
+		ChannelID: channelID,
+		Timestamp: ts,
+		Limit:     maxThreadMessages,
+	}
+
+	var messages []slack.Message
+	for {
+		page, hasMore, cursor, err := slackClient.GetConversationReplies(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get thread replies: %v", err)
+		}
+		messages = append(messages, page...)
+		if !hasMore || cursor == "" || len(messages) >= maxThreadMessages {
+			break
+		}
+		params.Cursor = cursor
+	}
+
+	if len(messages) > maxThreadMessages {
+		messages = messages[:maxThreadMessages]
+	}
+	return messages, nil
+}
+
+// sourceMessageText returns the text of the message at ts, or of the first
+// message if it is not in messages.
+func sourceMessageText(messages []slack.Message, ts string) string {
+	for _, message := range messages {
+		if message.Timestamp == ts {
+			return message.Text
+		}
+	}
+	if len(messages) > 0 {
+		return messages[0].Text
+	}
+	return ""
+}
+
+// formatThread renders a thread as Markdown for an issue body, each message
+// quoted under its author's name and time.
+func formatThread(slackClient SlackAPI, messages []slack.Message) string {
+	names := make(map[string]string)
+	var b strings.Builder
+	for i, message := range messages {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "**%s** · %s\n", authorName(slackClient, message, names), formatSlackTimestamp(message.Timestamp))
+		b.WriteString("> " + strings.ReplaceAll(strings.TrimSpace(message.Text), "\n", "\n> "))
+	}
+	return b.String()
+}
+
+// authorName returns the display name of a message's author, looking users up
+// once per thread.  The user ID is used if the lookup fails.
+func authorName(slackClient SlackAPI, message slack.Message, names map[string]string) string {
+	if message.User == "" {
+		if message.BotProfile != nil && message.BotProfile.Name != "" {
+			return message.BotProfile.Name
+		}
+		return firstNonEmpty(message.Username, "unknown")
+	}
+
+	if name, ok := names[message.User]; ok {
+		return name
+	}
+	name := message.User
+	if user, err := slackClient.GetUserInfo(message.User); err != nil {
+		Warn("Error looking up Slack user %s: %v", message.User, err)
+	} else {
+		name = firstNonEmpty(user.Profile.DisplayName, user.RealName, user.Name, message.User)
+	}
+	names[message.User] = name
+	return name
+}
+
+// formatSlackTimestamp turns a message ts such as "1700000000.000100" into a
+// UTC time.
+func formatSlackTimestamp(ts string) string {
+	seconds, _, _ := strings.Cut(ts, ".")
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return ts
+	}
+	return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04 UTC")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// issueThreadKey returns the Redis key recording the source message thread of
+// an issue created from a message shortcut.
+func issueThreadKey(issueURL string, config Config) string {
+	return config.RedisIssueThreadPrefix + issueURL
+}
+
+// postIssueThreadReply replies in the thread of the message an issue was
+// created from, so its author learns about the issue, and records the thread
+// for follow-ups.  Issues not created from a message are skipped, as are
+// issues whose thread is already recorded, so a retried event does not reply
+// twice.
+func postIssueThreadReply(ctx context.Context, rdb RedisClient, issue IssueConfirmation, config Config) error {
+	if issue.SourceChannel == "" || issue.SourceTs == "" {
+		return nil
+	}
+
+	ref, err := json.Marshal(IssueMessageRef{Channel: issue.SourceChannel, Ts: issue.SourceTs})
+	if err != nil {
+		return fmt.Errorf("failed to marshal issue thread reference: %v", err)
+	}
+	ttl := time.Duration(config.IssueThreadTTL) * time.Second
+	first, err := rdb.SetNX(ctx, issueThreadKey(issue.IssueURL, config), ref, ttl).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record issue thread: %v", err)
+	}
+	if !first {
+		DebugContext(ctx, "Already replied in the source thread of %s", issue.IssueURL)
+		return nil
+	}
+
+	text := fmt.Sprintf("📝 @%s opened an issue from this message: %s",
+		issue.Username, slackIssueLink(issue.IssueURL, parseRepoFullName(issue.Repo, config.GitHubOrg), issue.Title))
+	if err := pushThreadReply(ctx, rdb, IssueMessageRef{Channel: issue.SourceChannel, Ts: issue.SourceTs}, text, config); err != nil {
+		// Let a retry of the event reply instead
+		if delErr := rdb.Del(ctx, issueThreadKey(issue.IssueURL, config)).Err(); delErr != nil {
+			WarnContext(ctx, "Error releasing issue thread %s: %v", issueThreadKey(issue.IssueURL, config), delErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// postIssueThreadFollowUp posts text in the recorded source thread of
+// issueURL.  It does nothing for issues that have no recorded thread.
+func postIssueThreadFollowUp(ctx context.Context, rdb RedisClient, issueURL, text string, config Config) error {
+	data, err := rdb.Get(ctx, issueThreadKey(issueURL, config)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up issue thread: %v", err)
+	}
+
+	var thread IssueMessageRef
+	if err := json.Unmarshal([]byte(data), &thread); err != nil {
+		return fmt.Errorf("failed to parse issue thread reference: %v", err)
+	}
+	return pushThreadReply(ctx, rdb, thread, text, config)
+}
+
+// pushThreadReply sends a reply in thread via SlackLiner.  Replies in the
+// source conversation are kept, so they have no TTL.
+func pushThreadReply(ctx context.Context, rdb RedisClient, thread IssueMessageRef, text string, config Config) error {
+	payload, err := json.Marshal(SlackLinerMessage{
+		Channel:  thread.Channel,
+		Text:     text,
+		ThreadTs: thread.Ts,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling thread reply: %v", err)
+	}
+	if err := rdb.RPush(ctx, config.RedisSlackLinerList, payload).Err(); err != nil {
+		return fmt.Errorf("error pushing thread reply to SlackLiner list: %v", err)
+	}
+	DebugContext(ctx, "Thread reply sent to SlackLiner for channel=%s, ts=%s", thread.Channel, thread.Ts)
+	return nil
+}
+
+// slackIssueLink formats an issue as "<url|org/repo#123> title".
+func slackIssueLink(issueURL, repoFullName, title string) string {
+	return fmt.Sprintf("<%s|%s#%d> %s", issueURL, repoFullName, extractIssueNumber(issueURL), escapeSlackText(title))
+}
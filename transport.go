@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// streamPayloadField is the stream entry field holding the event payload,
+	// i.e. what would have been the pub/sub message body.
+	streamPayloadField = "payload"
+	streamReadCount    = 10
+	streamBlockTimeout = 5 * time.Second
+	streamErrorBackoff = time.Second
+)
+
+// messageHandler processes one payload received from Redis.  A nil error means
+// the message was handled (or deliberately ignored) and must not be redelivered.
+type messageHandler func(ctx context.Context, payload string) error
+
+// consumeChannel delivers every message for channel to handle.  Channels listed
+// in RedisStreamChannels are read from a Redis Stream of the same name through a
+// consumer group, giving at-least-once delivery across restarts; all other
+// channels use pub/sub.  name identifies the handler in logs and group names.
+// Once ctx is cancelled no new messages are handled; handlers already running
+// are left to finish under inFlight.  It returns nil once ctx is cancelled, or
+// an error if the subscription can no longer be read.
+func consumeChannel(ctx context.Context, rdb *redis.Client, channel, name string, config Config, handle messageHandler) error {
+	handle = inFlight.track(name, instrumentHandler(name, recoverPanics(rdb, channel, name, config, handle)))
+	if usesStream(channel, config) {
+		return consumeStream(ctx, rdb, channel, name, config, handle)
+	}
+	return consumePubSub(ctx, rdb, channel, name, config, handle)
+}
+
+// usesStream reports whether channel is configured for the Streams transport.
+func usesStream(channel string, config Config) bool {
+	return slices.Contains(config.RedisStreamChannels, channel)
+}
+
+// consumePubSub handles each message once.  Pub/sub cannot redeliver, so a
+// message whose handler fails is moved to the dead-letter list.
+func consumePubSub(ctx context.Context, rdb *redis.Client, channel, name string, config Config, handle messageHandler) error {
+	pubsub := rdb.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	// Fail fast, so the subscriber is restarted, if Redis is unreachable
+	if _, err := pubsub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("error subscribing to %s: %w", channel, err)
+	}
+
+	Info("Subscribed to Redis channel: %s", channel)
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("%s: %w", channel, errSubscriptionClosed)
+			}
+			if ctx.Err() != nil {
+				Warn("Dropping %s message received during shutdown", name)
+				return nil
+			}
+			if err := handle(ctx, msg.Payload); err != nil {
+				Error("Error handling %s message: %v", name, err)
+				if !errors.Is(err, errDeadLettered) {
+					deadLetterEvent(ctx, rdb, channel, name, msg.Payload, err, config)
+				}
+			}
+		}
+	}
+}
+
+// streamGroupName returns the consumer group used for the named handler.
+func streamGroupName(name string, config Config) string {
+	return config.RedisStreamGroupPrefix + ":" + name
+}
+
+func consumeStream(ctx context.Context, rdb *redis.Client, stream, name string, config Config, handle messageHandler) error {
+	group := streamGroupName(name, config)
+
+	err := rdb.XGroupCreateMkStream(ctx, stream, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("error creating consumer group %s on stream %s: %w", group, stream, err)
+	}
+
+	Info("Consuming Redis stream: %s (group=%s, consumer=%s)", stream, group, config.RedisStreamConsumer)
+
+	// Re-deliver anything this consumer read but did not acknowledge before a restart
+	readStreamGroup(ctx, rdb, stream, group, "0", name, config, handle)
+
+	lastClaim := time.Now()
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if time.Since(lastClaim) >= streamClaimIdle(config) {
+			claimStalePending(ctx, rdb, stream, group, name, config, handle)
+			lastClaim = time.Now()
+		}
+
+		readStreamGroup(ctx, rdb, stream, group, ">", name, config, handle)
+	}
+}
+
+// readStreamGroup reads one batch from the consumer group starting at id ("0"
+// for this consumer's pending entries, ">" for new ones) and processes it.
+func readStreamGroup(ctx context.Context, rdb *redis.Client, stream, group, id, name string, config Config, handle messageHandler) {
+	streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: config.RedisStreamConsumer,
+		Streams:  []string{stream, id},
+		Count:    streamReadCount,
+		Block:    streamBlockTimeout,
+	}).Result()
+	if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		Error("Error reading from stream %s: %v", stream, err)
+		time.Sleep(streamErrorBackoff)
+		return
+	}
+
+	for _, s := range streams {
+		for _, msg := range s.Messages {
+			// Entries not handled before shutdown stay pending for the next run
+			if ctx.Err() != nil {
+				return
+			}
+			processStreamMessage(ctx, rdb, stream, group, name, msg, handle)
+		}
+	}
+}
+
+// claimStalePending takes over entries that another (probably dead) consumer
+// read but never acknowledged.  Entries that have already been delivered
+// RedisStreamMaxDeliveries times are moved to the dead-letter list.
+func claimStalePending(ctx context.Context, rdb *redis.Client, stream, group, name string, config Config, handle messageHandler) {
+	pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Idle:   streamClaimIdle(config),
+		Start:  "-",
+		End:    "+",
+		Count:  streamReadCount,
+	}).Result()
+	if err != nil {
+		Error("Error listing pending entries on stream %s: %v", stream, err)
+		return
+	}
+
+	var ids []string
+	for _, p := range pending {
+		if config.RedisStreamMaxDeliveries > 0 && p.RetryCount >= int64(config.RedisStreamMaxDeliveries) {
+			Error("Dropping %s stream entry %s after %d delivery attempts", name, p.ID, p.RetryCount)
+			deadLetterStreamEntry(ctx, rdb, stream, name, p.ID, p.RetryCount, config)
+			if err := rdb.XAck(ctx, stream, group, p.ID).Err(); err != nil {
+				Error("Error acknowledging stream entry %s: %v", p.ID, err)
+			}
+			continue
+		}
+		ids = append(ids, p.ID)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	messages, err := rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: config.RedisStreamConsumer,
+		MinIdle:  streamClaimIdle(config),
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		Error("Error claiming pending entries on stream %s: %v", stream, err)
+		return
+	}
+
+	Info("Claimed %d stale %s stream entries", len(messages), name)
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			return
+		}
+		processStreamMessage(ctx, rdb, stream, group, name, msg, handle)
+	}
+}
+
+// processStreamMessage runs the handler for one stream entry and acknowledges it
+// on success, or once it is in the dead-letter list.  Failed entries stay
+// pending and are retried by claimStalePending.
+func processStreamMessage(ctx context.Context, rdb *redis.Client, stream, group, name string, msg redis.XMessage, handle messageHandler) {
+	payload, ok := msg.Values[streamPayloadField].(string)
+	if !ok {
+		Warn("Stream entry %s on %s has no %q field, acknowledging", msg.ID, stream, streamPayloadField)
+	} else if err := handle(ctx, payload); errors.Is(err, errDeadLettered) {
+		Error("Handler for %s message %s panicked, acknowledging: %v", name, msg.ID, err)
+	} else if err != nil {
+		Error("Error handling %s message %s, leaving it pending: %v", name, msg.ID, err)
+		return
+	}
+
+	// Acknowledge even when shutdown started while the handler was running
+	if err := rdb.XAck(context.WithoutCancel(ctx), stream, group, msg.ID).Err(); err != nil {
+		Error("Error acknowledging stream entry %s: %v", msg.ID, err)
+	}
+}
+
+// deadLetterStreamEntry copies a stream entry that keeps failing to the
+// dead-letter list before it is dropped.
+func deadLetterStreamEntry(ctx context.Context, rdb *redis.Client, stream, name, id string, deliveries int64, config Config) {
+	messages, err := rdb.XRangeN(ctx, stream, id, id, 1).Result()
+	if err != nil || len(messages) == 0 {
+		Error("Error reading stream entry %s for the dead-letter list: %v", id, err)
+		return
+	}
+	payload, _ := messages[0].Values[streamPayloadField].(string)
+	deadLetterEvent(ctx, rdb, stream, name, payload,
+		fmt.Errorf("dropped after %d delivery attempts", deliveries), config)
+}
+
+func streamClaimIdle(config Config) time.Duration {
+	if config.RedisStreamClaimIdle <= 0 {
+		return time.Minute
+	}
+	return time.Duration(config.RedisStreamClaimIdle) * time.Second
+}
+
+// parseList splits a comma-separated setting into trimmed, non-empty values.
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// defaultStreamConsumer names this process within its consumer groups.
+func defaultStreamConsumer(hostname string, err error) string {
+	if err != nil || hostname == "" {
+		return fmt.Sprintf("slashvibeissue-%d", time.Now().UnixNano())
+	}
+	return hostname
+}
@@ -8,21 +8,20 @@ type SlackCommand struct {
 	UserID      string `json:"user_id"`
 	UserName    string `json:"user_name"`
 	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
 }
 
 type ViewSubmission struct {
 	Type string `json:"type"`
 	View struct {
-		CallbackID string `json:"callback_id"`
-		State      struct {
+		ID              string `json:"id"`
+		Hash            string `json:"hash"`
+		CallbackID      string `json:"callback_id"`
+		PrivateMetadata string `json:"private_metadata"`
+		State           struct {
 			Values map[string]map[string]interface{} `json:"values"`
 		} `json:"state"`
-		Blocks []struct {
-			BlockID string `json:"block_id"`
-			Element struct {
-				InitialValue string `json:"initial_value"`
-			} `json:"element"`
-		} `json:"blocks"`
+		Blocks []ViewBlock `json:"blocks"`
 	} `json:"view"`
 	User struct {
 		ID       string `json:"id"`
@@ -30,10 +29,20 @@ type ViewSubmission struct {
 	} `json:"user"`
 }
 
+// ViewBlock is the subset of a view block needed to recover initial values,
+// which Slack leaves out of state when the user has not edited the field.
+type ViewBlock struct {
+	BlockID string `json:"block_id"`
+	Element struct {
+		InitialValue string `json:"initial_value"`
+	} `json:"element"`
+}
+
 type SlackLinerMessage struct {
 	Channel  string                 `json:"channel"`
 	Text     string                 `json:"text"`
 	TTL      int                    `json:"ttl"`
+	ThreadTs string                 `json:"thread_ts,omitempty"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -51,6 +60,78 @@ type PoppitOutput struct {
 	Type     string                 `json:"type"`
 	Command  string                 `json:"command"`
 	Output   string                 `json:"output"`
+	ExitCode *int                   `json:"exit_code,omitempty"`
+	Stderr   string                 `json:"stderr,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// IssueRequest holds everything needed to create a GitHub issue from a modal submission.
+type IssueRequest struct {
+	Repo            string   `json:"repo"`
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	AssignToCopilot bool     `json:"assignToCopilot"`
+	AddToProject    bool     `json:"addToProject"`
+	SanitiseIssue   bool     `json:"sanitiseIssue"`
+	Labels          []string `json:"labels,omitempty"`
+	Assignees       []string `json:"assignees,omitempty"`
+	Milestone       string   `json:"milestone,omitempty"`
+	AssignToMe      bool     `json:"assignToMe,omitempty"`
+	GitHubLogin     string   `json:"github_login,omitempty"`
+	Username        string   `json:"username"`
+	UserID          string   `json:"user_id"`
+	CorrelationID   string   `json:"correlation_id,omitempty"`
+	SourceChannel   string   `json:"source_channel,omitempty"`
+	SourceTs        string   `json:"source_ts,omitempty"`
+	SourcePermalink string   `json:"source_permalink,omitempty"`
+	// Thread and Attachments are added to the body after Description, which
+	// is kept as the user entered it so that a retry can show it again
+	Thread      string            `json:"thread,omitempty"`
+	Attachments []IssueAttachment `json:"attachments,omitempty"`
+}
+
+// FailedCommand is stored in Redis when a Poppit command fails so the user can
+// retry it from the failure notification.
+type FailedCommand struct {
+	Type     string                 `json:"type"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+type BlockActionEvent struct {
+	Type        string `json:"type"`
+	TriggerID   string `json:"trigger_id"`
+	ResponseURL string `json:"response_url"`
+	User        struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Container struct {
+		Type      string `json:"type"`
+		ChannelID string `json:"channel_id"`
+		MessageTs string `json:"message_ts"`
+		ViewID    string `json:"view_id"`
+	} `json:"container"`
+	View struct {
+		ID              string `json:"id"`
+		Hash            string `json:"hash"`
+		CallbackID      string `json:"callback_id"`
+		PrivateMetadata string `json:"private_metadata"`
+		State           struct {
+			Values map[string]map[string]interface{} `json:"values"`
+		} `json:"state"`
+		Blocks []ViewBlock `json:"blocks"`
+	} `json:"view"`
+	Actions []BlockAction `json:"actions"`
+}
+
+type BlockAction struct {
+	ActionID       string `json:"action_id"`
+	BlockID        string `json:"block_id"`
+	Type           string `json:"type"`
+	Value          string `json:"value"`
+	SelectedOption *struct {
+		Value string `json:"value"`
+	} `json:"selected_option,omitempty"`
 }
 
 type ReactionAddedEvent struct {
@@ -90,11 +171,13 @@ type GitHubWebhookEvent struct {
 		Name string `json:"name"`
 	} `json:"label"`
 	Issue struct {
+		ID            int64  `json:"id"`
 		URL           string `json:"url"`
 		HTMLURL       string `json:"html_url"`
 		RepositoryURL string `json:"repository_url"`
 		Number        int    `json:"number"`
 		Title         string `json:"title"`
+		UpdatedAt     string `json:"updated_at"`
 	} `json:"issue"`
 }
 
@@ -105,6 +188,13 @@ type SlackReaction struct {
 	Remove   bool   `json:"remove,omitempty"` // If true, removes the reaction instead of adding it
 }
 
+// SlackResponseMessage is posted to an interaction response_url.
+type SlackResponseMessage struct {
+	ResponseType    string `json:"response_type,omitempty"`
+	Text            string `json:"text"`
+	ReplaceOriginal bool   `json:"replace_original,omitempty"`
+}
+
 type TimeBombMessage struct {
 	Channel string `json:"channel"`
 	Ts      string `json:"ts"`
@@ -128,13 +218,24 @@ type MessageActionEvent struct {
 		Name string `json:"name"`
 	} `json:"channel"`
 	Message struct {
-		Type string `json:"type"`
-		User string `json:"user"`
-		Ts   string `json:"ts"`
-		Text string `json:"text"`
+		Type  string      `json:"type"`
+		User  string      `json:"user"`
+		Ts    string      `json:"ts"`
+		Text  string      `json:"text"`
+		Files []SlackFile `json:"files"`
 	} `json:"message"`
 }
 
+// SlackFile is a file attached to a Slack message.
+type SlackFile struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Mimetype           string `json:"mimetype"`
+	Size               int    `json:"size"`
+	URLPrivateDownload string `json:"url_private_download"`
+	Permalink          string `json:"permalink"`
+}
+
 type TitleGenerationOutput struct {
 	Version int    `json:"version"`
 	Title   string `json:"title"`
@@ -145,3 +246,98 @@ type SlackLinerHTTPResponse struct {
 	Channel string `json:"channel"`
 	Ts      string `json:"ts"`
 }
+
+// IssueMessageRef is the value stored in the Redis issue index, pointing at the
+// Slack confirmation message for a GitHub issue.
+type IssueMessageRef struct {
+	Channel string `json:"channel"`
+	Ts      string `json:"ts"`
+}
+
+// IssueTemplate is a repository issue template, parsed from either a Markdown
+// template or a YAML issue form under .github/ISSUE_TEMPLATE.
+type IssueTemplate struct {
+	Name      string   `json:"name"`
+	About     string   `json:"about,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	Body      string   `json:"body,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+}
+
+// RepoDetails is what we know about the repository selected in an open modal.
+// It is cached in Redis by view ID while the modal is open.  The totals are
+// how many the repository has, which can be more than were fetched.
+type RepoDetails struct {
+	Repo            string          `json:"repo"`
+	Templates       []IssueTemplate `json:"templates,omitempty"`
+	Labels          []RepoLabel     `json:"labels,omitempty"`
+	Assignees       []RepoUser      `json:"assignees,omitempty"`
+	Milestones      []RepoMilestone `json:"milestones,omitempty"`
+	LabelsTotal     int             `json:"labels_total,omitempty"`
+	AssigneesTotal  int             `json:"assignees_total,omitempty"`
+	MilestonesTotal int             `json:"milestones_total,omitempty"`
+}
+
+type RepoLabel struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// RepoUser is a user who can be assigned issues in a repository.
+type RepoUser struct {
+	Login string `json:"login"`
+	Name  string `json:"name,omitempty"`
+}
+
+type RepoMilestone struct {
+	Title  string `json:"title"`
+	Number int    `json:"number"`
+}
+
+// IssueModalMetadata is carried in the create-issue modal's private_metadata
+// between interactions and read back on submission.
+type IssueModalMetadata struct {
+	Template  string   `json:"template,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+	Milestone string   `json:"milestone,omitempty"`
+	// CorrelationID follows a message shortcut's title generation through to
+	// the submission of the modal it opened
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// SourceChannel is where /issue or the message shortcut was used, for
+	// routing the confirmation
+	SourceChannel string `json:"source_channel,omitempty"`
+	// SourceTs is the message the shortcut was used on, whose thread is told
+	// about the issue
+	SourceTs string `json:"source_ts,omitempty"`
+	// SourcePermalink links the issue back to that message
+	SourcePermalink string `json:"source_permalink,omitempty"`
+	// Attachments are the source message's files, linked at the end of the
+	// issue body
+	Attachments []IssueAttachment `json:"attachments,omitempty"`
+}
+
+// IssueAttachment is a file linked from an issue body.
+type IssueAttachment struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Image is set for uploaded images, which are embedded rather than linked
+	Image bool `json:"image,omitempty"`
+}
+
+// IssueConfirmation describes a created issue for its confirmation message.
+type IssueConfirmation struct {
+	Repo              string
+	Title             string
+	Username          string
+	IssueURL          string
+	AssignedToCopilot bool
+	Labels            []string
+	Assignees         []string
+	Milestone         string
+	GitHubLogin       string
+	CorrelationID     string
+	SourceChannel     string
+	SourceTs          string
+}
@@ -3,146 +3,206 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/slack-go/slack"
 )
 
-func subscribeToViewSubmissions(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, config Config) {
-	pubsub := rdb.Subscribe(ctx, config.RedisViewSubmissionChannel)
-	defer pubsub.Close()
-
-	Info("Subscribed to Redis channel: %s", config.RedisViewSubmissionChannel)
-
-	ch := pubsub.Channel()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case msg := <-ch:
-			if msg == nil {
-				continue
-			}
-			handleViewSubmission(ctx, rdb, slackClient, msg.Payload, config)
-		}
+func subscribeToViewSubmissions(ctx context.Context, rdb *redis.Client, slackClient SlackAPI, config Config) error {
+	handler := func(ctx context.Context, payload string) error {
+		return handleViewSubmission(ctx, rdb, slackClient, payload, currentConfig())
 	}
+	return consumeChannel(ctx, rdb, config.RedisViewSubmissionChannel, "view-submissions", config,
+		withIdempotency(rdb, "view-submissions", config, payloadKey("view.id", "view.hash"), handler))
 }
 
-func handleViewSubmission(ctx context.Context, rdb *redis.Client, slackClient *slack.Client, payload string, config Config) {
+func handleViewSubmission(ctx context.Context, rdb RedisClient, slackClient SlackAPI, payload string, config Config) error {
 	var submission ViewSubmission
 	if err := json.Unmarshal([]byte(payload), &submission); err != nil {
-		Error("Error unmarshaling view submission: %v", err)
-		return
+		return fmt.Errorf("error unmarshaling view submission: %v", err)
 	}
 
 	// Only handle our specific callback_id
 	if submission.View.CallbackID != "create_github_issue_modal" {
-		return
+		ignoreEvent(ctx)
+		return nil
 	}
 
-	Debug("Received view submission from user %s", submission.User.Username)
-
 	// Extract values from the submission
-	values := submission.View.State.Values
-
-	// Get repository
-	var repo string
-	if repoBlock, ok := values["repo_selection_block"]; ok {
-		if repoData, ok := repoBlock["SlashVibeIssue"]; ok {
-			if repoMap, ok := repoData.(map[string]interface{}); ok {
-				if selectedOption, ok := repoMap["selected_option"].(map[string]interface{}); ok {
-					if value, ok := selectedOption["value"].(string); ok {
-						repo = value
-					}
-				}
-			}
-		}
+	opts := issueModalOptionsFromView(submission.View.State.Values, submission.View.Blocks)
+	metadata := applyModalSelections(decodeModalMetadata(submission.View.PrivateMetadata), submission.View.State.Values)
+	repo := opts.Repo
+	title := opts.Title
+
+	// Every log line and Poppit command for this issue carries the same ID;
+	// modals opened from a message shortcut already have one
+	if metadata.CorrelationID == "" {
+		metadata.CorrelationID = newCorrelationID()
 	}
+	ctx = withCorrelationID(ctx, metadata.CorrelationID)
 
-	// Get title
-	var title string
-	if titleBlock, ok := values["title_block"]; ok {
-		if titleData, ok := titleBlock["issue_title"]; ok {
-			if titleMap, ok := titleData.(map[string]interface{}); ok {
-				if value, ok := titleMap["value"].(string); ok {
-					title = value
-				}
-			}
-		}
+	InfoContext(ctx, "Received view submission from user %s", submission.User.Username)
+
+	if repo == "" || title == "" {
+		WarnContext(ctx, "Missing required fields: repo or title")
+		return nil
 	}
 
-	// If title is empty from state (happens when initial_value was set via UpdateView
-	// and the user did not modify the field), fall back to initial_value from blocks
-	if title == "" {
-		for _, block := range submission.View.Blocks {
-			if block.BlockID == "title_block" {
-				title = block.Element.InitialValue
-				break
-			}
-		}
+	githubLogin, err := resolveGitHubLogin(ctx, rdb, submission.User.ID, config)
+	if err != nil {
+		return err
+	}
+	if opts.AssignToMe && githubLogin == "" {
+		notifyUnlinkedAssignToMe(slackClient, submission.User.ID, config)
 	}
 
-	// Get description
-	var description string
-	if descBlock, ok := values["description_block"]; ok {
-		if descData, ok := descBlock["issue_description"]; ok {
-			if descMap, ok := descData.(map[string]interface{}); ok {
-				if value, ok := descMap["value"].(string); ok {
-					description = value
-				}
-			}
+	var thread string
+	if opts.IncludeThread {
+		thread, err = loadTranscript(ctx, rdb, submission.View.ID, config)
+		if err != nil {
+			return err
 		}
 	}
 
-	// Check if copilot assignment is selected
-	assignToCopilot := false
-	if assignBlock, ok := values["assignment_block"]; ok {
-		if assignData, ok := assignBlock["assign_copilot"]; ok {
-			if assignMap, ok := assignData.(map[string]interface{}); ok {
-				if selectedOptions, ok := assignMap["selected_options"].([]interface{}); ok {
-					assignToCopilot = len(selectedOptions) > 0
-				}
-			}
-		}
+	// Create GitHub issue via Poppit
+	req := IssueRequest{
+		Repo:            repo,
+		Title:           title,
+		Description:     opts.Description,
+		AssignToCopilot: opts.AssignToCopilot,
+		AddToProject:    opts.AddToProject,
+		SanitiseIssue:   opts.SanitiseIssue,
+		Labels:          metadata.Labels,
+		Assignees:       metadata.Assignees,
+		Milestone:       metadata.Milestone,
+		AssignToMe:      opts.AssignToMe,
+		GitHubLogin:     githubLogin,
+		Username:        submission.User.Username,
+		UserID:          submission.User.ID,
+		CorrelationID:   metadata.CorrelationID,
+		SourceChannel:   metadata.SourceChannel,
+		SourceTs:        metadata.SourceTs,
+		SourcePermalink: metadata.SourcePermalink,
+		Thread:          thread,
+		Attachments:     metadata.Attachments,
+	}
+	err = submitIssue(ctx, rdb, req, config)
+	if err != nil {
+		return fmt.Errorf("error creating GitHub issue: %v", err)
 	}
 
-	// Check if add to project is selected
-	addToProject := false
-	if assignBlock, ok := values["assignment_block"]; ok {
-		if projectData, ok := assignBlock["add_to_project"]; ok {
-			if projectMap, ok := projectData.(map[string]interface{}); ok {
-				if selectedOptions, ok := projectMap["selected_options"].([]interface{}); ok {
-					addToProject = len(selectedOptions) > 0
-				}
-			}
-		}
+	// Log the full repo name (supports both "org/repo" and "repo" formats)
+	repoFullName := parseRepoFullName(repo, config.GitHubOrg)
+	InfoContext(ctx, "GitHub issue creation command sent to Poppit for repo: %s", repoFullName)
+	return nil
+}
+
+// notifyUnlinkedAssignToMe tells a user who ticked "Assign to me" that the issue
+// will be created unassigned because their GitHub login is unknown.
+func notifyUnlinkedAssignToMe(slackClient SlackAPI, userID string, config Config) {
+	text := "Your issue is being created without you as assignee because your Slack account is not linked to a GitHub login. " + howToLinkGitHub(userID, config)
+	if _, _, err := slackClient.PostMessage(userID, slack.MsgOptionText(text, false)); err != nil {
+		Error("Error notifying user %s about missing GitHub login: %v", userID, err)
 	}
+}
 
-	// Check if sanitise issue is selected
-	sanitiseIssue := false
-	if assignBlock, ok := values["assignment_block"]; ok {
-		if sanitiseData, ok := assignBlock["sanitise_issue"]; ok {
-			if sanitiseMap, ok := sanitiseData.(map[string]interface{}); ok {
-				if selectedOptions, ok := sanitiseMap["selected_options"].([]interface{}); ok {
-					sanitiseIssue = len(selectedOptions) > 0
-				}
-			}
+// issueModalOptionsFromView reads the user's current input from a create-issue
+// modal.  Text fields that still hold their initial_value are missing from
+// state, so they fall back to the value in the view's blocks.
+func issueModalOptionsFromView(values map[string]map[string]interface{}, blocks []ViewBlock) issueModalOptions {
+	opts := issueModalOptions{
+		Repo:            stateSelectedValue(values, "repo_selection_block", repoSelectActionID),
+		Title:           stateTextValue(values, "title_block", "issue_title"),
+		Description:     stateTextValue(values, "description_block", "issue_description"),
+		AssignToCopilot: stateChecked(values, "assignment_block", "assign_copilot"),
+		AddToProject:    stateChecked(values, "assignment_block", "add_to_project"),
+		SanitiseIssue:   stateChecked(values, "assignment_block", "sanitise_issue"),
+		AssignToMe:      stateChecked(values, "assignment_block", "assign_to_me"),
+		IncludeThread:   stateChecked(values, "thread_block", includeThreadActionID),
+	}
+
+	if opts.Title == "" {
+		opts.Title = blockInitialValue(blocks, "title_block")
+	}
+	if opts.Description == "" {
+		opts.Description = blockInitialValue(blocks, "description_block")
+	}
+
+	return opts
+}
+
+// applyModalSelections overlays the label, assignee and milestone pickers onto
+// the modal metadata.  Pickers are only present once the repository details
+// have loaded; until then the metadata (template defaults, or the values of a
+// retried issue) is used as is.
+func applyModalSelections(metadata IssueModalMetadata, values map[string]map[string]interface{}) IssueModalMetadata {
+	if labels, ok := stateSelectedValues(values, "labels_block", issueLabelsActionID); ok {
+		metadata.Labels = labels
+	}
+	if assignees, ok := stateSelectedValues(values, "assignees_block", issueAssigneesActionID); ok {
+		metadata.Assignees = assignees
+	}
+	if element := stateElement(values, "milestone_block", issueMilestoneActionID); element != nil {
+		metadata.Milestone = stateSelectedValue(values, "milestone_block", issueMilestoneActionID)
+	}
+	return metadata
+}
+
+func stateElement(values map[string]map[string]interface{}, blockID, actionID string) map[string]interface{} {
+	if block, ok := values[blockID]; ok {
+		if element, ok := block[actionID].(map[string]interface{}); ok {
+			return element
 		}
 	}
+	return nil
+}
 
-	if repo == "" || title == "" {
-		Warn("Missing required fields: repo or title")
-		return
+// stateTextValue returns the value of a plain-text input.
+func stateTextValue(values map[string]map[string]interface{}, blockID, actionID string) string {
+	value, _ := stateElement(values, blockID, actionID)["value"].(string)
+	return value
+}
+
+// stateSelectedValue returns the value of a select menu's selected option.
+func stateSelectedValue(values map[string]map[string]interface{}, blockID, actionID string) string {
+	if selectedOption, ok := stateElement(values, blockID, actionID)["selected_option"].(map[string]interface{}); ok {
+		value, _ := selectedOption["value"].(string)
+		return value
 	}
+	return ""
+}
 
-	// Create GitHub issue via Poppit
-	err := createGitHubIssue(ctx, rdb, repo, title, description, assignToCopilot, addToProject, sanitiseIssue, submission.User.Username, config)
-	if err != nil {
-		Error("Error creating GitHub issue: %v", err)
-		return
+// stateSelectedValues returns the values of a multi-select's selected options,
+// and whether the multi-select is present in state at all.
+func stateSelectedValues(values map[string]map[string]interface{}, blockID, actionID string) ([]string, bool) {
+	element := stateElement(values, blockID, actionID)
+	if element == nil {
+		return nil, false
+	}
+	selectedOptions, _ := element["selected_options"].([]interface{})
+	var selected []string
+	for _, option := range selectedOptions {
+		if optionMap, ok := option.(map[string]interface{}); ok {
+			if value, ok := optionMap["value"].(string); ok && value != "" {
+				selected = append(selected, value)
+			}
+		}
 	}
+	return selected, true
+}
 
-	// Log the full repo name (supports both "org/repo" and "repo" formats)
-	repoFullName := parseRepoFullName(repo, config.GitHubOrg)
-	Info("GitHub issue creation command sent to Poppit for repo: %s", repoFullName)
+// stateChecked reports whether any option of a checkbox group is selected.
+func stateChecked(values map[string]map[string]interface{}, blockID, actionID string) bool {
+	selectedOptions, _ := stateElement(values, blockID, actionID)["selected_options"].([]interface{})
+	return len(selectedOptions) > 0
+}
+
+func blockInitialValue(blocks []ViewBlock, blockID string) string {
+	for _, block := range blocks {
+		if block.BlockID == blockID {
+			return block.Element.InitialValue
+		}
+	}
+	return ""
 }